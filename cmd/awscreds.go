@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/pkg/errors"
+	"os"
+	"time"
+)
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var awsVaultRole string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var awsVaultMount string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var awsVaultSTS bool
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var awsVaultTTL string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var awsExternalID string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var awsMFASerial string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var awsSessionDuration time.Duration
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&awsVaultRole, "aws-vault-role", "", os.Getenv("AWS_VAULT_ROLE"), "Get AWS credentials from this role of Vault's AWS secrets engine, rather than from AWS_PROFILE or the default chain.  (env AWS_VAULT_ROLE)")
+	rootCmd.PersistentFlags().StringVarP(&awsVaultMount, "aws-vault-mount", "", envOrDefault("AWS_VAULT_MOUNT", aws.DefaultVaultAWSMount), "Mount of Vault's AWS secrets engine.  (env AWS_VAULT_MOUNT)")
+	rootCmd.PersistentFlags().BoolVarP(&awsVaultSTS, "aws-vault-sts", "", false, "Read STS credentials from <mount>/sts/<role> rather than <mount>/creds/<role>.")
+	rootCmd.PersistentFlags().StringVarP(&awsVaultTTL, "aws-vault-ttl", "", "", "TTL to request for AWS credentials from Vault, e.g. 1h.")
+	rootCmd.PersistentFlags().StringVarP(&awsExternalID, "aws-external-id", "", os.Getenv("AWS_EXTERNAL_ID"), "External ID to pass when assuming AWS_ROLE.  (env AWS_EXTERNAL_ID)")
+	rootCmd.PersistentFlags().StringVarP(&awsMFASerial, "aws-mfa-serial", "", os.Getenv("AWS_MFA_SERIAL"), "MFA device to use when assuming AWS_ROLE.  The code is prompted for on stdin, which must be a terminal.  (env AWS_MFA_SERIAL)")
+	rootCmd.PersistentFlags().DurationVarP(&awsSessionDuration, "aws-session-duration", "", 0, "Duration of assumed role sessions, e.g. 1h.  0 uses the STS default, or 1h with MFA.")
+}
+
+// awsCredentialsConfig works out where AWS credentials come from.  AWS_PROFILE and AWS_ROLE are read from the environment.  AWS_ROLE may be a comma separated chain of roles.  If --aws-vault-role is set, Vault supplies the source credentials.
+func awsCredentialsConfig() (creds aws.AWSCredentialsConfig, err error) {
+	creds = aws.AWSCredentialsConfig{
+		Profile: os.Getenv("AWS_PROFILE"),
+		Role:    os.Getenv("AWS_ROLE"),
+
+		ExternalID:      awsExternalID,
+		MFASerial:       awsMFASerial,
+		SessionDuration: awsSessionDuration,
+	}
+
+	if awsVaultRole == "" {
+		return creds, err
+	}
+
+	client, clientErr := vaultClient()
+	if clientErr != nil {
+		err = errors.Wrapf(clientErr, "failed creating vault client for AWS credentials")
+		return creds, err
+	}
+
+	creds.Provider = aws.NewVaultCredentialsProvider(client, awsVaultMount, awsVaultRole, awsVaultSTS, awsVaultTTL, verbose)
+
+	return creds, err
+}
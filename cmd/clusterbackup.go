@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/backup"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var backupDest string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var backupS3Endpoint string
+
+// clusterBackupCmd represents the cluster backup command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var clusterBackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up a K8S Cluster",
+	Long: `
+Back up a K8S Cluster.
+
+Backups go to --backup-dest (env BACKUP_DEST), which is either a local directory, or an s3://bucket/prefix URL.  For S3 compatible stores other than AWS, give the endpoint with --s3-endpoint (env S3_ENDPOINT).
+`,
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	clusterCmd.AddCommand(clusterBackupCmd)
+
+	clusterBackupCmd.PersistentFlags().StringVar(&backupDest, "backup-dest", os.Getenv("BACKUP_DEST"), "Where backups are kept: a local directory, or s3://bucket/prefix")
+	clusterBackupCmd.PersistentFlags().StringVar(&backupS3Endpoint, "s3-endpoint", os.Getenv("S3_ENDPOINT"), "Endpoint of an S3 compatible store, if not AWS")
+}
+
+// backupTarget returns the backup target given with --backup-dest.  S3 targets use the same AWS credentials as everything else.
+func backupTarget(ctx context.Context) (target backup.Target, err error) {
+	target, err = backup.NewTarget(backupDest, func() (client backup.S3API, clientErr error) {
+		awsCreds, awsCredsErr := awsCredentialsConfig()
+		if awsCredsErr != nil {
+			clientErr = awsCredsErr
+			return client, clientErr
+		}
+
+		cfg, cfgErr := aws.NewAWSConfig(ctx, awsCreds)
+		if cfgErr != nil {
+			clientErr = cfgErr
+			return client, clientErr
+		}
+
+		client = backup.NewS3Client(cfg, backupS3Endpoint)
+
+		return client, clientErr
+	})
+
+	return target, err
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+// clusterBackupEtcdCmd represents the cluster backup etcd command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var clusterBackupEtcdCmd = &cobra.Command{
+	Use:   "etcd [cluster-name]",
+	Short: "Back up a cluster's etcd",
+	Long: `
+Take an etcd snapshot from a healthy control plane node through the Talos API, and store it in --backup-dest.
+
+Each snapshot is stored as etcd-<cluster>-<time>.db, next to a sha256sum style checksum in etcd-<cluster>-<time>.db.sha256, and metadata (cluster, time, etcd revision, node, size, checksum) in etcd-<cluster>-<time>.json.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		if len(args) > 0 {
+			if clusterName == "" {
+				clusterName = args[0]
+			}
+		}
+
+		if clusterName == "" {
+			log.Fatalf("Cannot back up without a cluster name")
+		}
+
+		target, targetErr := backupTarget(ctx)
+		if targetErr != nil {
+			log.Fatalf("Failed getting backup destination: %s", targetErr)
+		}
+
+		cfZoneID, cfToken, err := DNSCredentialsFromEnvOrVault()
+		if err != nil {
+			log.Fatalf("Failed getting DNS credentials: %s", err)
+		}
+
+		talosconfig, tcErr := TalosconfigFromVaultOrFile()
+		if tcErr != nil {
+			log.Fatalf("Failed getting talosconfig: %s", tcErr)
+		}
+
+		switch cloudProvider {
+		case cloudProviderAWS:
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
+			if cmErr != nil {
+				log.Fatalf("Failed creating cluster manager: %s", cmErr)
+			}
+
+			kubeErr := setKubeClients(cm, true)
+			if kubeErr != nil {
+				log.Fatalf("Failed getting Kubernetes clients: %s", kubeErr)
+			}
+
+			cm.Talosconfig = talosconfig
+
+			_, backupErr := cm.BackupEtcd(target)
+			if backupErr != nil {
+				log.Fatalf("error backing up etcd for cluster %s: %s", clusterName, backupErr)
+			}
+
+		default:
+			log.Fatalf("Cloud provider %q is not yet supported.", cloudProvider)
+		}
+	},
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	clusterBackupCmd.AddCommand(clusterBackupEtcdCmd)
+}
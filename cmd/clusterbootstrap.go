@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"reflect"
+	"time"
+)
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var bootstrapNodeName string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var bootstrapTimeout time.Duration
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var bootstrapOutput string
+
+// clusterBootstrapCmd represents the cluster bootstrap command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var clusterBootstrapCmd = &cobra.Command{
+	Use:   "bootstrap [cluster-name]",
+	Short: "Bring up a new cluster's first control plane node",
+	Long: `
+Bring up a brand new cluster.
+
+First, the cluster DNS records named in the cluster config are pointed at their load balancers, as 'cluster reconcile --fix-dns' would.  The configs may use the apiserver name as the cluster endpoint.
+
+The first control plane node (-n, default <cluster>-cp-1) is created just as 'node create -r controlplane' would create it.  Once it's up, etcd is bootstrapped on it through the Talos API.  That's only ever done once per cluster, so the cluster must have no other nodes.
+
+The command then waits for etcd, and for the apiserver to answer behind the apiserver load balancer, and fetches an admin kubeconfig through the Talos API.  The kubeconfig is written to -o, or otherwise stored under 'kubeconfig' in the cluster's controlplane secret.
+
+If it's interrupted, run it again.  An existing first node isn't created again, and etcd isn't bootstrapped twice.
+
+Create the remaining nodes with 'node create' once it's done.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		if len(args) > 0 {
+			if clusterName == "" {
+				clusterName = args[0]
+			}
+		}
+
+		if clusterName == "" {
+			log.Fatalf("Cannot bootstrap without a cluster name")
+		}
+
+		// The first node is a control plane node, so its configs are the control plane ones.
+		nodeRole = manager.NodeRoleCp
+
+		if bootstrapNodeName == "" {
+			name, nameErr := aws.NodeName(clusterName, "cp", 1)
+			if nameErr != nil {
+				log.Fatalf("Failed naming first node: %s", nameErr)
+			}
+
+			bootstrapNodeName = name
+		}
+
+		// Find out where the kubeconfig goes before there's a cluster to lose it for.
+		if bootstrapOutput == "" {
+			backend, backendErr := secretBackend()
+			if backendErr != nil {
+				log.Fatalf("Failed creating secret backend: %s", backendErr)
+			}
+
+			if backend == nil {
+				log.Fatalf("Nowhere to store the kubeconfig.  Use -o, or -m or --sops-dir for a secret backend.")
+			}
+		}
+
+		configBytes, patches, nodeBytes, cfZoneID, cfToken, err := ConfigsFromVaultOrFile()
+		if err != nil {
+			log.Fatalf("Failed getting required node data: %s", err)
+		}
+
+		talosconfig, tcErr := TalosconfigFromVaultOrFile()
+		if tcErr != nil {
+			log.Fatalf("Failed getting talosconfig: %s", tcErr)
+		}
+
+		switch cloudProvider {
+		case cloudProviderAWS:
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
+			if cmErr != nil {
+				log.Fatalf("Failed creating cluster manager: %s", cmErr)
+			}
+
+			cm.Talosconfig = talosconfig
+
+			nodeConfig, ncErr := aws.LoadAWSNodeConfig(nodeBytes)
+			if ncErr != nil {
+				log.Fatalf("Failed loading node config %s: %s", nodeConfigFile, ncErr)
+			}
+
+			if nodeType != "" {
+				nodeConfig.InstanceType = nodeType
+			}
+
+			if reflect.DeepEqual(nodeConfig, aws.AWSNodeConfig{}) {
+				log.Fatalf("No Node Config.  Cannot continue.")
+			}
+
+			// The configs and kubeconfig may point at the apiserver name in the cluster config, so its record has to be there before anything waits on it.
+			clusterConfig, ccErr := ClusterConfigFromVaultOrFile()
+			if ccErr != nil {
+				log.Fatalf("Failed getting cluster config: %s", ccErr)
+			}
+
+			cm.ClusterConfig = clusterConfig
+
+			_, syncErr := cm.SyncClusterRecords()
+			if syncErr != nil {
+				log.Fatalf("Failed setting cluster DNS records: %s", syncErr)
+			}
+
+			kubeconfig, bootstrapErr := cm.BootstrapCluster(bootstrapNodeName, nodeConfig, configBytes, nodePatches(patches, bootstrapNodeName, ""), bootstrapTimeout)
+			if bootstrapErr != nil {
+				log.Fatalf("error bootstrapping cluster %s: %s", clusterName, bootstrapErr)
+			}
+
+			storeErr := storeKubeconfig(kubeconfig)
+			if storeErr != nil {
+				log.Fatalf("Failed storing kubeconfig: %s", storeErr)
+			}
+
+			fmt.Printf("Cluster %s is bootstrapped\n", clusterName)
+
+		default:
+			log.Fatalf("Cloud provider %q is not yet supported.", cloudProvider)
+		}
+	},
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	clusterCmd.AddCommand(clusterBootstrapCmd)
+
+	clusterBootstrapCmd.Flags().StringVarP(&bootstrapNodeName, "name", "n", "", "Name of the first control plane node.  Defaults to <cluster>-cp-1.")
+	clusterBootstrapCmd.Flags().StringVarP(&nodeType, "type", "t", "", "Instance type of the first control plane node.  Defaults to the node config's.")
+	clusterBootstrapCmd.Flags().DurationVar(&bootstrapTimeout, "timeout", 20*time.Minute, "How long to wait for each step: the node's Talos API, etcd, the kubeconfig, and the apiserver")
+	clusterBootstrapCmd.Flags().StringVarP(&bootstrapOutput, "output", "o", "", "File to write the admin kubeconfig to.  Defaults to storing it in the secret backend.")
+}
+
+// storeKubeconfig writes the kubeconfig to the file given with -o, or into the cluster's control plane secret.
+func storeKubeconfig(kubeconfig []byte) (err error) {
+	if bootstrapOutput != "" {
+		err = os.WriteFile(bootstrapOutput, kubeconfig, 0600)
+		if err != nil {
+			err = errors.Wrapf(err, "failed writing kubeconfig to %s", bootstrapOutput)
+			return err
+		}
+
+		fmt.Printf("Wrote kubeconfig to %s\n", bootstrapOutput)
+
+		return err
+	}
+
+	backend, backendErr := secretBackend()
+	if backendErr != nil {
+		err = backendErr
+		return err
+	}
+
+	if backend == nil {
+		err = errors.New("no secret backend to store the kubeconfig in")
+		return err
+	}
+
+	// Like the talosconfig, the admin kubeconfig only goes in the control plane secret.
+	name := manager.SecretName(clusterName, manager.NodeRoleCp)
+
+	data, readErr := backend.ReadSecret(name, verbose)
+	if readErr != nil {
+		err = errors.Wrapf(readErr, "failed reading secret %s", name)
+		return err
+	}
+
+	data[manager.KubeconfigKey] = string(kubeconfig)
+
+	writeErr := backend.WriteSecret(name, data, verbose)
+	if writeErr != nil {
+		err = errors.Wrapf(writeErr, "failed writing secret %s", name)
+		return err
+	}
+
+	fmt.Printf("Stored kubeconfig in %s\n", name)
+
+	return err
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// clusterConfigCmd represents the cluster config command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var clusterConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Operations on cluster configs",
+	Long: `
+Operations on the Talos machine configs and other configs for a cluster.
+`,
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	clusterCmd.AddCommand(clusterConfigCmd)
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/talos"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"log"
+)
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var clusterEndpoint string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var kubernetesVersion string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var talosVersion string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var forceGenerate bool
+
+// clusterConfigGenerateCmd represents the cluster config generate command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var clusterConfigGenerateCmd = &cobra.Command{
+	Use:   "generate [cluster-name]",
+	Short: "Generate Talos secrets and machine configs for a new cluster",
+	Long: `
+Generate a Talos secrets bundle, and the controlplane and worker machine configs that go with it, and write them to the secret backend (Vault with -m, or SOPS files with --sops-dir).
+
+Each role gets a secret named cluster-<cluster>-<role> holding config.yaml, a starter patch.yaml and node-<provider>.yaml.  Only the controlplane secret holds the admin talosconfig, and the secrets bundle as secrets.yaml.  Other keys already in the secrets, such as the Cloudflare credentials, are kept.
+
+The cluster endpoint is taken from --endpoint, or else the apiserver name in the cluster config, or else the DNS name of the cluster's apiserver load balancer.
+
+Existing machine configs are not overwritten unless --force is given.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		if len(args) > 0 {
+			if clusterName == "" {
+				clusterName = args[0]
+			}
+		}
+
+		if clusterName == "" {
+			log.Fatalf("Cannot generate configs without a cluster name")
+		}
+
+		backend, backendErr := secretBackend()
+		if backendErr != nil {
+			log.Fatalf("Failed creating secret backend: %s", backendErr)
+		}
+
+		if backend == nil {
+			log.Fatalf("Cannot generate configs without a secret backend.  Use -m or --sops-dir.")
+		}
+
+		endpoint, endpointErr := generateEndpoint(ctx)
+		if endpointErr != nil {
+			log.Fatalf("Failed finding cluster endpoint: %s", endpointErr)
+		}
+
+		configs, genErr := talos.GenerateConfigs(clusterName, endpoint, kubernetesVersion, talosVersion, verbose)
+		if genErr != nil {
+			log.Fatalf("Failed generating configs: %s", genErr)
+		}
+
+		nodeConfig, nodeErr := starterNodeConfig()
+		if nodeErr != nil {
+			log.Fatalf("Failed creating starter node config: %s", nodeErr)
+		}
+
+		roleConfigs := map[string][]byte{
+			manager.NodeRoleCp:     configs.ControlPlane,
+			manager.NodeRoleWorker: configs.Worker,
+		}
+
+		// Check everything before writing anything, so we don't end up with configs from two different bundles.
+		existingSecrets := make(map[string]map[string]interface{})
+
+		for role := range roleConfigs {
+			name := manager.SecretName(clusterName, role)
+
+			// Only a secret that isn't there counts as empty.  Starting from nothing after any other failure would wipe the secret's other keys.
+			existing, readErr := backend.ReadSecret(name, verbose)
+			if errors.Is(readErr, manager.ErrSecretNotFound) {
+				manager.VerboseOutput(verbose, "No existing secret %s", name)
+				existing = make(map[string]interface{})
+			} else if readErr != nil {
+				log.Fatalf("Failed reading secret %s: %s", name, readErr)
+			}
+
+			_, hasConfig := existing[manager.TalosMachineConfigKey]
+			if hasConfig && !forceGenerate {
+				log.Fatalf("Secret %s already holds a machine config.  Use --force to replace it.", name)
+			}
+
+			existingSecrets[role] = existing
+		}
+
+		for role, machineConfig := range roleConfigs {
+			name := manager.SecretName(clusterName, role)
+			data := existingSecrets[role]
+
+			data[manager.TalosMachineConfigKey] = string(machineConfig)
+
+			// The admin talosconfig, like the secrets bundle, only goes in the control plane secret.  Drop any a worker secret got from an older version.
+			if role == manager.NodeRoleCp {
+				data[manager.TalosconfigKey] = string(configs.Talosconfig)
+				data[manager.TalosSecretsBundleKey] = string(configs.SecretsBundle)
+			} else {
+				delete(data, manager.TalosconfigKey)
+			}
+
+			// Keep any patch and node config that have already been worked on.
+			if _, ok := data[manager.TalosMachineConfigPatchKey]; !ok {
+				data[manager.TalosMachineConfigPatchKey] = talos.StarterPatch
+			}
+
+			nodeKey := manager.NodeConfigKey(cloudProvider)
+			if _, ok := data[nodeKey]; !ok {
+				data[nodeKey] = string(nodeConfig)
+			}
+
+			writeErr := backend.WriteSecret(name, data, verbose)
+			if writeErr != nil {
+				log.Fatalf("Failed writing secret %s: %s", name, writeErr)
+			}
+
+			fmt.Printf("Wrote %s configs for cluster %s to %s\n", role, clusterName, name)
+		}
+	},
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	clusterConfigCmd.AddCommand(clusterConfigGenerateCmd)
+	clusterConfigGenerateCmd.Flags().StringVarP(&clusterEndpoint, "endpoint", "e", "", "Cluster endpoint, e.g. https://api.prod.some.domain:6443.  A bare host name gets https and port 6443.")
+	clusterConfigGenerateCmd.Flags().StringVarP(&kubernetesVersion, "kubernetes-version", "", talos.DefaultKubernetesVersion, "Kubernetes version")
+	clusterConfigGenerateCmd.Flags().StringVarP(&talosVersion, "talos-version", "", "", "Talos version the configs are for, e.g. v1.9.  Defaults to the version of the Talos library.")
+	clusterConfigGenerateCmd.Flags().BoolVarP(&forceGenerate, "force", "f", false, "Replace existing machine configs.")
+}
+
+// generateEndpoint works out the cluster endpoint for new configs.
+func generateEndpoint(ctx context.Context) (endpoint string, err error) {
+	if clusterEndpoint != "" {
+		endpoint = talos.ClusterEndpoint(clusterEndpoint)
+		return endpoint, err
+	}
+
+	clusterConfig, ccErr := ClusterConfigFromVaultOrFile()
+	if ccErr != nil {
+		manager.VerboseOutput(verbose, "No cluster config: %s", ccErr)
+	}
+
+	if clusterConfig.DNS.APIServer != "" {
+		endpoint = talos.ClusterEndpoint(clusterConfig.DNS.APIServer)
+		return endpoint, err
+	}
+
+	switch cloudProvider {
+	case cloudProviderAWS:
+		awsCreds, awsCredsErr := awsCredentialsConfig()
+		if awsCredsErr != nil {
+			err = awsCredsErr
+			return endpoint, err
+		}
+
+		host, hostErr := aws.APIServerHost(ctx, clusterName, awsCreds)
+		if hostErr != nil {
+			err = errors.Wrapf(hostErr, "failed looking up apiserver load balancer.  Use --endpoint to set it.")
+			return endpoint, err
+		}
+
+		endpoint = talos.ClusterEndpoint(host)
+
+	default:
+		err = errors.Errorf("cloud provider %q is not yet supported.  Use --endpoint.", cloudProvider)
+		return endpoint, err
+	}
+
+	return endpoint, err
+}
+
+// starterNodeConfig is the node config written for a new cluster.  The image, subnet, and such still need filling in.
+func starterNodeConfig() (nodeConfig []byte, err error) {
+	switch cloudProvider {
+	case cloudProviderAWS:
+		nodeConfig, err = yaml.Marshal(aws.AWSNodeConfig{
+			BlockDeviceGb:   "100",
+			BlockDeviceName: "/dev/xvda",
+			BlockDeviceType: "gp3",
+		})
+		if err != nil {
+			err = errors.Wrapf(err, "failed marshalling node config")
+			return nodeConfig, err
+		}
+
+	default:
+		err = errors.Errorf("cloud provider %q is not yet supported", cloudProvider)
+		return nodeConfig, err
+	}
+
+	return nodeConfig, err
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+)
+
+// clusterDriftCmd represents the cluster drift command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var clusterDriftCmd = &cobra.Command{
+	Use:   "drift [cluster-name]",
+	Short: "Check whether nodes run the machine config they should",
+	Long: `
+Check whether each node runs the machine config it should.
+
+For every node, the expected config is rendered from the machine config and patch for its role in the secret backend, plus the hostname patch, just as 'node apply-config' would.  It's compared with the config the node is running, fetched through the Talos API.  Secrets are ignored.
+
+Differences are printed per node:
+  - path: value            expected, but not on the node
+  + path: value            on the node, but not expected
+  ~ path: expected -> live  different on the node
+
+Exits non-zero if any node has drifted, or couldn't be checked.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		if len(args) > 0 {
+			if clusterName == "" {
+				clusterName = args[0]
+			}
+		}
+
+		if clusterName == "" {
+			log.Fatalf("Cannot check drift without a cluster name")
+		}
+
+		roles, rolesErr := awsRoleConfigs()
+		if rolesErr != nil {
+			log.Fatalf("Failed getting node configs: %s", rolesErr)
+		}
+
+		cfZoneID, cfToken, err := DNSCredentialsFromEnvOrVault()
+		if err != nil {
+			log.Fatalf("Failed getting DNS credentials: %s", err)
+		}
+
+		talosconfig, tcErr := TalosconfigFromVaultOrFile()
+		if tcErr != nil {
+			log.Fatalf("Failed getting talosconfig: %s", tcErr)
+		}
+
+		switch cloudProvider {
+		case cloudProviderAWS:
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
+			if cmErr != nil {
+				log.Fatalf("Failed creating cluster manager: %s", cmErr)
+			}
+
+			kubeErr := setKubeClients(cm, true)
+			if kubeErr != nil {
+				log.Fatalf("Failed getting Kubernetes clients: %s", kubeErr)
+			}
+
+			cm.Talosconfig = talosconfig
+
+			drift, driftErr := cm.ConfigDrift(roles)
+			if driftErr != nil {
+				log.Fatalf("Failed checking config drift: %s", driftErr)
+			}
+
+			drifted := 0
+
+			for _, d := range drift {
+				switch {
+				case d.Err != nil:
+					drifted++
+					fmt.Printf("✗ %s (%s): %s\n", d.Node, d.Role, d.Err)
+				case len(d.Diffs) > 0:
+					drifted++
+					fmt.Printf("⚠ %s (%s): %d difference(s)\n", d.Node, d.Role, len(d.Diffs))
+					for _, diff := range d.Diffs {
+						fmt.Printf("    %s\n", diff)
+					}
+				default:
+					fmt.Printf("✓ %s (%s): in sync\n", d.Node, d.Role)
+				}
+			}
+
+			if drifted > 0 {
+				fmt.Printf("\n%d of %d node(s) drifted\n", drifted, len(drift))
+				os.Exit(1)
+			}
+
+		default:
+			log.Fatalf("Cloud provider %q is not yet supported.", cloudProvider)
+		}
+	},
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	clusterCmd.AddCommand(clusterDriftCmd)
+}
+
+// awsRoleConfigs loads the machine config, patches, and node config for each node role from the secret backend, with any patches from --patches-dir layered on.
+func awsRoleConfigs() (roles map[string]aws.RoleConfig, err error) {
+	backend, backendErr := secretBackend()
+	if backendErr != nil {
+		err = backendErr
+		return roles, err
+	}
+
+	if backend == nil {
+		err = errors.New("no secret backend.  Use -m for Vault, or --sops-dir for SOPS files")
+		return roles, err
+	}
+
+	roles = make(map[string]aws.RoleConfig)
+
+	for _, role := range []string{manager.NodeRoleCp, manager.NodeRoleWorker} {
+		data, dataErr := manager.ConfigsFromBackend(backend, clusterName, role, cloudProvider, verbose)
+		if dataErr != nil {
+			err = errors.Wrapf(dataErr, "failed getting %s configs", role)
+			return roles, err
+		}
+
+		nodeConfig, ncErr := aws.LoadAWSNodeConfig(data.NodeConfig)
+		if ncErr != nil {
+			err = errors.Wrapf(ncErr, "failed loading %s node config", role)
+			return roles, err
+		}
+
+		roleConfig := aws.RoleConfig{
+			MachineConfig: data.TalosMachineConfig,
+			NodeConfig:    nodeConfig,
+			Patches:       data.Patches,
+		}
+
+		if len(data.TalosMachineConfigPatch) > 0 {
+			roleConfig.Patches.Role = []manager.Patch{{Source: manager.TalosMachineConfigPatchKey, Content: data.TalosMachineConfigPatch}}
+		}
+
+		if patchesDir != "" {
+			dirPatches, dirErr := manager.LoadPatchDir(patchesDir, role)
+			if dirErr != nil {
+				err = dirErr
+				return roles, err
+			}
+
+			roleConfig.Patches = roleConfig.Patches.Merge(dirPatches)
+		}
+
+		roles[role] = roleConfig
+	}
+
+	return roles, err
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/kubernetes"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var writeIdentity bool
+
+// clusterIdentityCmd represents the cluster identity command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var clusterIdentityCmd = &cobra.Command{
+	Use:   "identity [cluster-name]",
+	Short: "Check that the kubeconfig points at the named cluster",
+	Long: fmt.Sprintf(`
+Check that the kubeconfig points at the named cluster.
+
+Commands that delete, upgrade, or label nodes make the same check first, so a kubeconfig for the wrong cluster can't be used by mistake.
+
+A cluster knows its name if it has the %s/%s ConfigMap, which 'cluster bootstrap' writes.  Otherwise most of its Kubernetes nodes have to be EC2 instances tagged with the cluster's name.
+
+With --write, the ConfigMap is written, after checking the nodes.  Do that once for clusters bootstrapped before the ConfigMap existed.
+`, kubernetes.IdentityNamespace, kubernetes.IdentityConfigMapName),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		if len(args) > 0 {
+			if clusterName == "" {
+				clusterName = args[0]
+			}
+		}
+
+		if clusterName == "" {
+			log.Fatalf("Cannot check identity without a cluster name")
+		}
+
+		cfZoneID, cfToken, err := DNSCredentialsFromEnvOrVault()
+		if err != nil {
+			log.Fatalf("Failed getting DNS credentials: %s", err)
+		}
+
+		switch cloudProvider {
+		case cloudProviderAWS:
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
+			if cmErr != nil {
+				log.Fatalf("Failed creating cluster manager: %s", cmErr)
+			}
+
+			kubeErr := setKubeClients(cm, true)
+			if kubeErr != nil {
+				log.Fatalf("Failed getting Kubernetes clients: %s", kubeErr)
+			}
+
+			if writeIdentity {
+				writeErr := cm.WriteClusterIdentity()
+				if writeErr != nil {
+					log.Fatalf("Failed writing identity of cluster %s: %s", clusterName, writeErr)
+				}
+
+				return
+			}
+
+			// An explicit check is never skipped.
+			cm.SkipIdentityCheck = false
+
+			verifyErr := cm.VerifyClusterIdentity()
+			if verifyErr != nil {
+				log.Fatalf("Identity check failed: %s", verifyErr)
+			}
+
+			fmt.Printf("Kubeconfig points at cluster %s\n", clusterName)
+
+		default:
+			log.Fatalf("Cloud provider %q is not yet supported.", cloudProvider)
+		}
+	},
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	clusterCmd.AddCommand(clusterIdentityCmd)
+
+	clusterIdentityCmd.Flags().BoolVar(&writeIdentity, "write", false, "Write the identity ConfigMap, after checking the nodes")
+}
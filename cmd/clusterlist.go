@@ -6,10 +6,8 @@ package cmd
 import (
 	"context"
 	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
-	"github.com/nikogura/k8s-cluster-manager/pkg/manager/cloudflare"
 	"github.com/spf13/cobra"
 	"log"
-	"os"
 )
 
 // clusterlistCmd represents the clusterlist command.
@@ -41,14 +39,24 @@ List information about a K8S Cluster
 
 		switch cloudProvider {
 		case cloudProviderAWS:
-			profile := os.Getenv("AWS_PROFILE")
-			role := os.Getenv("AWS_ROLE")
-			dnsManager := cloudflare.NewCloudFlareManager(cfZoneID, cfToken)
-			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, profile, role, dnsManager, verbose)
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
 			if cmErr != nil {
 				log.Fatalf("Failed creating cluster manager: %s", cmErr)
 			}
 
+			clusterConfig, ccErr := ClusterConfigFromVaultOrFile()
+			if ccErr != nil {
+				log.Fatalf("Failed getting cluster config: %s", ccErr)
+			}
+
+			cm.ClusterConfig = clusterConfig
+
 			info, descErr := cm.DescribeCluster(clusterName)
 			if descErr != nil {
 				log.Fatalf("Failed describing cluster: %s", descErr)
@@ -6,17 +6,22 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
 	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
-	"github.com/nikogura/k8s-cluster-manager/pkg/manager/cloudflare"
 	"github.com/nikogura/k8s-cluster-manager/pkg/manager/kubernetes"
 	"github.com/spf13/cobra"
 	"log"
-	"os"
 )
 
 //nolint:gochecknoglobals // Cobra boilerplate
 var fixTags bool
 
+//nolint:gochecknoglobals // Cobra boilerplate
+var fixDNS bool
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var dnsDomain string
+
 // clusterreconcileCmd represents the clusterreconcile command.
 //
 //nolint:gochecknoglobals // Cobra boilerplate
@@ -30,8 +35,13 @@ This command will:
 - List all EC2 instances (with and without Cluster tag)
 - List all Kubernetes nodes
 - List all load balancer targets
+- List all DNS records for the cluster's domain (requires --domain or --nodeconfig)
+- Check the cluster level DNS records for the load balancers (requires a cluster config)
 - Report any discrepancies
 - Optionally fix missing Cluster tags with --fix-tags
+- Optionally fix stale, missing, and mismatched DNS records with --fix-dns
+
+After 'cluster bootstrap', --fix-dns is the only way the cluster level DNS records get created or updated.  Run it when a load balancer is replaced, or a name is added to the cluster config.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
@@ -48,17 +58,34 @@ This command will:
 
 		switch cloudProvider {
 		case cloudProviderAWS:
-			profile := os.Getenv("AWS_PROFILE")
-			role := os.Getenv("AWS_ROLE")
-			cfZoneID := os.Getenv("CLOUDFLARE_ZONE_ID")
-			cfAPIToken := os.Getenv("CLOUDFLARE_API_TOKEN")
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			cfZoneID, cfAPIToken, credErr := DNSCredentialsFromEnvOrVault()
+			if credErr != nil {
+				log.Fatalf("Failed getting DNS credentials: %s", credErr)
+			}
 
-			dnsManager := cloudflare.NewCloudFlareManager(cfZoneID, cfAPIToken)
-			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, profile, role, dnsManager, verbose)
+			dnsManager := newDNSManager(cfZoneID, cfAPIToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
 			if cmErr != nil {
 				log.Fatalf("Failed creating cluster manager: %s", cmErr)
 			}
 
+			kubeErr := setKubeClients(cm, true)
+			if kubeErr != nil {
+				log.Fatalf("Failed getting Kubernetes clients: %s", kubeErr)
+			}
+
+			clusterConfig, ccErr := ClusterConfigFromVaultOrFile()
+			if ccErr != nil {
+				log.Fatalf("Failed getting cluster config: %s", ccErr)
+			}
+
+			cm.ClusterConfig = clusterConfig
+
 			// Get cluster info
 			fmt.Printf("Reconciling cluster %s\n", clusterName)
 			fmt.Println("====================================")
@@ -70,7 +97,7 @@ This command will:
 			}
 
 			// Get K8s nodes
-			k8sNodes, k8sErr := kubernetes.ListNodes(ctx, verbose)
+			k8sNodes, k8sErr := kubernetes.ListNodes(ctx, cm.K8sClients, verbose)
 			if k8sErr != nil {
 				log.Fatalf("Failed listing Kubernetes nodes: %s", k8sErr)
 			}
@@ -196,8 +223,18 @@ This command will:
 				fmt.Println()
 			}
 
+			// Check DNS records
+			dnsIssues := reconcileClusterRecords(cm, clusterInfo.DNSRecords)
+			domain := reconcileDomain()
+			if domain != "" {
+				dnsIssues += reconcileDNS(ctx, cm, clusterInfo.Nodes, domain)
+			} else {
+				fmt.Println("Skipping DNS checks.  Run with --domain to check DNS records.")
+				fmt.Println()
+			}
+
 			// Summary
-			if len(untaggedNodes) == 0 && len(notInK8s) == 0 && len(notInEC2) == 0 && len(notInLB) == 0 && len(lbWithoutEC2) == 0 {
+			if len(untaggedNodes) == 0 && len(notInK8s) == 0 && len(notInEC2) == 0 && len(notInLB) == 0 && len(lbWithoutEC2) == 0 && dnsIssues == 0 {
 				fmt.Println("✓ No discrepancies found - cluster is in sync")
 			} else {
 				fmt.Println("Reconciliation complete - see warnings above for discrepancies")
@@ -213,4 +250,171 @@ This command will:
 func init() {
 	clusterCmd.AddCommand(clusterreconcileCmd)
 	clusterreconcileCmd.Flags().BoolVar(&fixTags, "fix-tags", false, "Automatically fix missing Cluster tags")
+	clusterreconcileCmd.Flags().BoolVar(&fixDNS, "fix-dns", false, "Automatically fix stale, missing, and mismatched DNS records")
+	clusterreconcileCmd.Flags().StringVar(&dnsDomain, "domain", "", "Domain of the cluster's DNS records (defaults to the domain in --nodeconfig)")
+}
+
+// reconcileDomain figures out which domain the cluster's node records live in.
+func reconcileDomain() (domain string) {
+	domain = dnsDomain
+	if domain != "" || nodeConfigFile == "" {
+		return domain
+	}
+
+	nodeConfig, ncErr := aws.LoadAWSNodeConfigFromFile(nodeConfigFile)
+	if ncErr != nil {
+		log.Fatalf("Failed loading node config %s: %s", nodeConfigFile, ncErr)
+	}
+
+	domain = nodeConfig.Domain
+
+	return domain
+}
+
+// reconcileClusterRecords reports cluster level DNS records that don't point at their load balancers, fixing them if asked.  Returns the number of discrepancies found.
+func reconcileClusterRecords(cm *aws.AWSClusterManager, records []manager.ClusterRecord) (issues int) {
+	outOfSync := make([]manager.ClusterRecord, 0)
+	for _, record := range records {
+		if !record.InSync() {
+			outOfSync = append(outOfSync, record)
+		}
+	}
+
+	issues = len(outOfSync)
+	if issues == 0 {
+		return issues
+	}
+
+	fmt.Printf("⚠ Cluster DNS Records Not Pointing at Their Load Balancer: %d\n", issues)
+	for _, record := range outOfSync {
+		record.ConsolePrint("  - ")
+	}
+	fmt.Println()
+
+	if !fixDNS {
+		fmt.Println("Run with --fix-dns to automatically fix these DNS records")
+		fmt.Println()
+		return issues
+	}
+
+	fmt.Println("Fixing cluster DNS records...")
+
+	_, syncErr := cm.SyncClusterRecords()
+	if syncErr != nil {
+		log.Fatalf("Failed fixing cluster DNS records: %s", syncErr)
+	}
+
+	fmt.Printf("✓ Fixed %d cluster DNS records\n", issues)
+	fmt.Println()
+
+	return issues
+}
+
+// reconcileDNS compares the cluster's instances with its DNS records, fixing them if asked.  Returns the number of discrepancies found.
+//
+//nolint:gocognit // Reconciliation reports and fixes several kinds of discrepancy
+func reconcileDNS(ctx context.Context, cm *aws.AWSClusterManager, nodes []manager.NodeInfo, domain string) (issues int) {
+	records, listErr := cm.DnsManager.ListRecords(ctx, domain, verbose)
+	if listErr != nil {
+		log.Fatalf("Failed listing DNS records: %s", listErr)
+	}
+
+	report := manager.ReconcileDNS(clusterName, nodes, records)
+	issues = report.IssueCount()
+
+	fmt.Printf("DNS Records (under %s): %d\n", domain, len(report.Records))
+	fmt.Println()
+
+	if len(report.Orphaned) > 0 {
+		fmt.Printf("⚠ DNS Records Not Pointing at a Cluster Instance: %d\n", len(report.Orphaned))
+		for _, record := range report.Orphaned {
+			fmt.Printf("  - %s %s %s\n", record.Name, record.Type, record.Content)
+		}
+		fmt.Println()
+	}
+
+	if len(report.Unclaimed) > 0 {
+		fmt.Printf("⚠ DNS Records Named Like the Cluster's, Not Pointing at a Cluster Instance: %d\n", len(report.Unclaimed))
+		fmt.Println("  Nothing marks these as the cluster's, so they won't be removed.  Check and remove them by hand if they're stale.")
+		for _, record := range report.Unclaimed {
+			fmt.Printf("  - %s %s %s\n", record.Name, record.Type, record.Content)
+		}
+		fmt.Println()
+	}
+
+	if len(report.Missing) > 0 {
+		fmt.Printf("⚠ EC2 Instances Without DNS Records: %d\n", len(report.Missing))
+		for _, node := range report.Missing {
+			fmt.Printf("  - %s (%s) %s\n", node.Name, node.ID, node.IP)
+		}
+		fmt.Println()
+	}
+
+	if len(report.Mismatched) > 0 {
+		fmt.Printf("⚠ DNS Records With Wrong IP: %d\n", len(report.Mismatched))
+		for _, mismatch := range report.Mismatched {
+			fmt.Printf("  - %s points to %s, instance %s has %s\n", mismatch.Record.Name, mismatch.Record.Content, mismatch.Node.ID, mismatch.Node.IP)
+		}
+		fmt.Println()
+	}
+
+	if issues == 0 {
+		return issues
+	}
+
+	if !fixDNS {
+		fmt.Println("Run with --fix-dns to automatically fix these DNS records")
+		fmt.Println()
+		return issues
+	}
+
+	fmt.Println("Fixing DNS records...")
+
+	// With ownership tracking, records without an ownership record would be refused, so they're skipped up front and counted apart.
+	fix := report.Fix(dnsOwnerID != "")
+
+	deleted := 0
+	deregistered := make(map[string]bool)
+
+	for _, record := range fix.Delete {
+		// Deregistering a name removes all its address records, so each name is only done once.
+		if !deregistered[record.Name] {
+			deregErr := cm.DnsManager.DeregisterNode(ctx, record.Name, domain, verbose)
+			if deregErr != nil {
+				log.Fatalf("Failed removing DNS record %s: %s", record.Name, deregErr)
+			}
+
+			deregistered[record.Name] = true
+		}
+
+		deleted++
+	}
+
+	// Registration is an upsert, so the same call fixes both missing and mismatched records.
+	for _, node := range fix.Register {
+		awsNode := aws.AWSNode{
+			NodeName:   stripDomainSuffix(node.Name),
+			IPAddress:  node.IP,
+			NodeID:     node.ID,
+			NodeDomain: domain,
+		}
+
+		regErr := cm.DnsManager.RegisterNode(ctx, awsNode, verbose)
+		if regErr != nil {
+			log.Fatalf("Failed registering DNS for %s: %s", node.Name, regErr)
+		}
+	}
+
+	fmt.Printf("✓ Deleted %d stale DNS records, and registered %d\n", deleted, len(fix.Register))
+
+	if len(fix.Skipped) > 0 {
+		fmt.Printf("⚠ Skipped %d DNS records not owned by %s:\n", len(fix.Skipped), dnsOwnerID)
+		for _, record := range fix.Skipped {
+			fmt.Printf("  - %s %s %s\n", record.Name, record.Type, record.Content)
+		}
+	}
+
+	fmt.Println()
+
+	return issues
 }
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"os"
+)
+
+// clusterRestoreCmd represents the cluster restore command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var clusterRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a K8S Cluster from backup",
+	Long: `
+Restore a K8S Cluster from backups made with 'cluster backup'.
+`,
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	clusterCmd.AddCommand(clusterRestoreCmd)
+
+	clusterRestoreCmd.PersistentFlags().StringVar(&backupDest, "backup-dest", os.Getenv("BACKUP_DEST"), "Where backups are kept: a local directory, or s3://bucket/prefix")
+	clusterRestoreCmd.PersistentFlags().StringVar(&backupS3Endpoint, "s3-endpoint", os.Getenv("S3_ENDPOINT"), "Endpoint of an S3 compatible store, if not AWS")
+}
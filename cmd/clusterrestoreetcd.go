@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var snapshotName string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var restoreForce bool
+
+// clusterRestoreEtcdCmd represents the cluster restore etcd command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var clusterRestoreEtcdCmd = &cobra.Command{
+	Use:   "etcd [cluster-name]",
+	Short: "Restore a cluster's etcd from a snapshot",
+	Long: `
+Restore etcd from a snapshot taken with 'cluster backup etcd'.
+
+The snapshot named with --snapshot is fetched from --backup-dest, and checked against its checksum.  It's then uploaded to the control plane node given with -n, and etcd is bootstrapped from it.
+
+The node has to be a fresh control plane node, created with 'node create -r controlplane', and not bootstrapped.  Create the remaining control plane nodes once it's up, and they'll join it.
+
+Snapshots taken from another cluster are refused, unless --force is given.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		if len(args) > 0 {
+			if clusterName == "" {
+				clusterName = args[0]
+			}
+		}
+
+		if clusterName == "" {
+			log.Fatalf("Cannot restore without a cluster name")
+		}
+
+		if nodeName == "" {
+			log.Fatalf("Cannot restore without a control plane node to restore onto")
+		}
+
+		if snapshotName == "" {
+			log.Fatalf("Cannot restore without a snapshot name")
+		}
+
+		target, targetErr := backupTarget(ctx)
+		if targetErr != nil {
+			log.Fatalf("Failed getting backup destination: %s", targetErr)
+		}
+
+		cfZoneID, cfToken, err := DNSCredentialsFromEnvOrVault()
+		if err != nil {
+			log.Fatalf("Failed getting DNS credentials: %s", err)
+		}
+
+		talosconfig, tcErr := TalosconfigFromVaultOrFile()
+		if tcErr != nil {
+			log.Fatalf("Failed getting talosconfig: %s", tcErr)
+		}
+
+		switch cloudProvider {
+		case cloudProviderAWS:
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
+			if cmErr != nil {
+				log.Fatalf("Failed creating cluster manager: %s", cmErr)
+			}
+
+			cm.Talosconfig = talosconfig
+
+			restoreErr := cm.RestoreEtcd(nodeName, target, snapshotName, restoreForce)
+			if restoreErr != nil {
+				log.Fatalf("error restoring etcd for cluster %s: %s", clusterName, restoreErr)
+			}
+
+		default:
+			log.Fatalf("Cloud provider %q is not yet supported.", cloudProvider)
+		}
+	},
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	clusterRestoreCmd.AddCommand(clusterRestoreEtcdCmd)
+
+	clusterRestoreEtcdCmd.Flags().StringVarP(&nodeName, "name", "n", "", "Control plane node to restore etcd onto")
+	clusterRestoreEtcdCmd.Flags().BoolVar(&restoreForce, "force", false, "Restore a snapshot taken from another cluster")
+	clusterRestoreEtcdCmd.Flags().StringVar(&snapshotName, "snapshot", "", "Name of the snapshot to restore, e.g. etcd-prod-20261019T120000Z")
+}
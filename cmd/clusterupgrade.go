@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/spf13/cobra"
+	"log"
+	"time"
+)
+
+// clusterUpgradeCmd represents the cluster upgrade command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var clusterUpgradeCmd = &cobra.Command{
+	Use:   "upgrade [cluster-name]",
+	Short: "Upgrade Talos on every node in a cluster",
+	Long: `
+Upgrade Talos on every node in the cluster to the installer image given with --image, e.g. ghcr.io/siderolabs/installer:v1.9.5.
+
+Control plane nodes are upgraded first, then workers, one node at a time.  etcd has to be healthy before each control plane node is taken down, and each node has to come back running the new Talos version, and be Ready in Kubernetes, before the next one is started.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		if len(args) > 0 {
+			if clusterName == "" {
+				clusterName = args[0]
+			}
+		}
+
+		if clusterName == "" {
+			log.Fatalf("Cannot upgrade without a cluster name")
+		}
+
+		if upgradeImage == "" {
+			log.Fatalf("Cannot upgrade without an installer image")
+		}
+
+		cfZoneID, cfToken, err := DNSCredentialsFromEnvOrVault()
+		if err != nil {
+			log.Fatalf("Failed getting DNS credentials: %s", err)
+		}
+
+		talosconfig, tcErr := TalosconfigFromVaultOrFile()
+		if tcErr != nil {
+			log.Fatalf("Failed getting talosconfig: %s", tcErr)
+		}
+
+		switch cloudProvider {
+		case cloudProviderAWS:
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
+			if cmErr != nil {
+				log.Fatalf("Failed creating cluster manager: %s", cmErr)
+			}
+
+			kubeErr := setKubeClients(cm, true)
+			if kubeErr != nil {
+				log.Fatalf("Failed getting Kubernetes clients: %s", kubeErr)
+			}
+
+			cm.Talosconfig = talosconfig
+
+			upgradeErr := cm.UpgradeCluster(upgradeImage, upgradeTimeout, upgradeForce)
+			if upgradeErr != nil {
+				log.Fatalf("error upgrading cluster %s: %s", clusterName, upgradeErr)
+			}
+
+		default:
+			log.Fatalf("Cloud provider %q is not yet supported.", cloudProvider)
+		}
+	},
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	clusterCmd.AddCommand(clusterUpgradeCmd)
+
+	clusterUpgradeCmd.Flags().StringVar(&upgradeImage, "image", "", "Talos installer image to upgrade to, e.g. ghcr.io/siderolabs/installer:v1.9.5")
+	clusterUpgradeCmd.Flags().DurationVar(&upgradeTimeout, "timeout", 15*time.Minute, "How long to wait for each node to come back from its upgrade")
+	clusterUpgradeCmd.Flags().BoolVar(&upgradeForce, "force", false, "Upgrade nodes even if they already run the image's Talos version")
+}
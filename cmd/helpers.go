@@ -1,6 +1,9 @@
 package cmd
 
-import "strings"
+import (
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/cloudflare"
+	"strings"
+)
 
 // stripDomainSuffix removes domain suffix from node names for comparison.
 // E.g., "charlie-cp-1.terrace.fi" -> "charlie-cp-1".
@@ -9,3 +12,13 @@ func stripDomainSuffix(name string) (shortName string) {
 	shortName = parts[0]
 	return shortName
 }
+
+// newDNSManager creates the DNS manager for the cluster from the command line options.
+func newDNSManager(cfZoneID string, cfToken string) (dnsManager cloudflare.CloudFlareManager) {
+	dnsManager = cloudflare.NewCloudFlareManager(cfZoneID, cfToken).
+		WithOwnerID(dnsOwnerID).
+		WithClusterName(clusterName).
+		WithTTL(dnsTTL).
+		WithProxied(dnsProxied)
+	return dnsManager
+}
@@ -6,18 +6,27 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
 	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
-	"github.com/nikogura/k8s-cluster-manager/pkg/manager/cloudflare"
 	"github.com/nikogura/k8s-cluster-manager/pkg/manager/kubernetes"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/talos"
 	"github.com/spf13/cobra"
 	"log"
-	"os"
 	"time"
 )
 
 //nolint:gochecknoglobals // Cobra boilerplate
 var monitorInterval int
 
+//nolint:gochecknoglobals // Cobra boilerplate
+var monitorTalosHealth bool
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var monitorTalosTimeout time.Duration
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var monitorDiskThreshold float64
+
 // monitorCmd represents the monitor command.
 //
 //nolint:gochecknoglobals // Cobra boilerplate
@@ -31,6 +40,14 @@ Continuously monitor cluster health by periodically checking:
 - Load balancer target health
 - Discrepancies between systems
 
+With --talos-health, each node's Talos API is also asked about:
+- Service states (apid, kubelet, and etcd on control plane nodes)
+- etcd alarms
+- Time sync
+- Disk usage of /var and /system/state, against --disk-threshold
+
+Each node gets --talos-timeout to answer, and the nodes are asked at once, so one slow node doesn't stall the loop.
+
 The monitor will run indefinitely, checking every interval (default 60 seconds).
 Press Ctrl+C to stop monitoring.
 `,
@@ -49,17 +66,36 @@ Press Ctrl+C to stop monitoring.
 
 		switch cloudProvider {
 		case cloudProviderAWS:
-			profile := os.Getenv("AWS_PROFILE")
-			role := os.Getenv("AWS_ROLE")
-			cfZoneID := os.Getenv("CLOUDFLARE_ZONE_ID")
-			cfAPIToken := os.Getenv("CLOUDFLARE_API_TOKEN")
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			cfZoneID, cfAPIToken, credErr := DNSCredentialsFromEnvOrVault()
+			if credErr != nil {
+				log.Fatalf("Failed getting DNS credentials: %s", credErr)
+			}
 
-			dnsManager := cloudflare.NewCloudFlareManager(cfZoneID, cfAPIToken)
-			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, profile, role, dnsManager, verbose)
+			dnsManager := newDNSManager(cfZoneID, cfAPIToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
 			if cmErr != nil {
 				log.Fatalf("Failed creating cluster manager: %s", cmErr)
 			}
 
+			kubeErr := setKubeClients(cm, true)
+			if kubeErr != nil {
+				log.Fatalf("Failed getting Kubernetes clients: %s", kubeErr)
+			}
+
+			if monitorTalosHealth {
+				talosconfig, tcErr := TalosconfigFromVaultOrFile()
+				if tcErr != nil {
+					log.Fatalf("Failed getting talosconfig: %s", tcErr)
+				}
+
+				cm.Talosconfig = talosconfig
+			}
+
 			fmt.Printf("Starting continuous monitoring of cluster %s (interval: %ds)\n", clusterName, monitorInterval)
 			fmt.Printf("Press Ctrl+C to stop\n")
 			fmt.Println("====================================")
@@ -86,6 +122,9 @@ Press Ctrl+C to stop monitoring.
 func init() {
 	rootCmd.AddCommand(monitorCmd)
 	monitorCmd.Flags().IntVarP(&monitorInterval, "interval", "i", 60, "Monitoring interval in seconds")
+	monitorCmd.Flags().BoolVar(&monitorTalosHealth, "talos-health", false, "Also check each node's health through the Talos API")
+	monitorCmd.Flags().DurationVar(&monitorTalosTimeout, "talos-timeout", 10*time.Second, "How long each node gets to answer the Talos health checks")
+	monitorCmd.Flags().Float64Var(&monitorDiskThreshold, "disk-threshold", 85, "Percent disk usage above which a node is flagged")
 }
 
 //nolint:gocognit,funlen // Monitoring logic requires multiple checks and reporting
@@ -101,7 +140,7 @@ func monitorOnce(ctx context.Context, cm *aws.AWSClusterManager, clusterName str
 	}
 
 	// Get K8s nodes
-	k8sNodes, k8sErr := kubernetes.ListNodes(ctx, false)
+	k8sNodes, k8sErr := kubernetes.ListNodes(ctx, cm.K8sClients, false)
 	if k8sErr != nil {
 		fmt.Printf("❌ ERROR: Failed listing Kubernetes nodes: %s\n\n", k8sErr)
 		return
@@ -207,6 +246,11 @@ func monitorOnce(ctx context.Context, cm *aws.AWSClusterManager, clusterName str
 		}
 	}
 
+	// Check each node's own idea of its health
+	if monitorTalosHealth {
+		issueCount += monitorTalos(ctx, cm.Talosconfig, clusterInfo.Nodes)
+	}
+
 	// Summary
 	if issueCount == 0 {
 		fmt.Printf("  ✓ All systems healthy - EC2: %d, K8s: %d, LB Targets: %d\n", len(clusterInfo.Nodes), len(k8sNodes), len(lbTargetMap))
@@ -216,3 +260,34 @@ func monitorOnce(ctx context.Context, cm *aws.AWSClusterManager, clusterName str
 
 	fmt.Println()
 }
+
+// monitorTalos checks each node's health through its Talos API, and prints the nodes that have problems.  It returns the number of issues found.
+func monitorTalos(ctx context.Context, talosconfig []byte, nodes []manager.NodeInfo) (issueCount int) {
+	names := make([]string, 0, len(nodes))
+	ips := make(map[string]string)
+	for _, node := range nodes {
+		if node.IP == "" {
+			continue
+		}
+
+		names = append(names, node.Name)
+		ips[node.Name] = node.IP
+	}
+
+	results := talos.CheckNodesHealth(ctx, talosconfig, names, ips, monitorTalosTimeout, monitorDiskThreshold)
+
+	for _, health := range results {
+		problems := health.Problems()
+		if len(problems) == 0 {
+			continue
+		}
+
+		issueCount++
+		fmt.Printf("  ⚠ Node %s (%s) Degraded: %d problem(s)\n", health.Node, health.IP, len(problems))
+		for _, problem := range problems {
+			fmt.Printf("    - %s\n", problem)
+		}
+	}
+
+	return issueCount
+}
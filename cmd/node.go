@@ -7,9 +7,14 @@ import (
 	"fmt"
 	"github.com/mitchellh/go-homedir"
 	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/kubernetes"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/sops"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/talos"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -48,39 +53,396 @@ func init() {
 	nodeCmd.PersistentFlags().StringVarP(&purpose, "purpose", "p", "", "Node Purpose (adds label and taint)")
 }
 
-// ConfigsFromVaultOrFile will return byte arrays representing the machine config, patch, and node config, pulled either from Vault (if -m is specified) or.
-func ConfigsFromVaultOrFile() (configBytes []byte, patchBytes []byte, nodeBytes []byte, cfZoneID string, cfToken string, err error) {
+// secretBackend returns the backend holding the cluster's secrets: SOPS files if --sops-dir is given, or Vault if -m is given.  If neither is given the backend is nil.
+func secretBackend() (backend manager.SecretBackend, err error) {
+	if sopsDir != "" {
+		backend = sops.NewSOPSBackend(sopsDir, sopsAgeRecipients)
+		return backend, err
+	}
+
+	if secretPath == "" {
+		return backend, err
+	}
+
+	client, clientErr := vaultClient()
+	if clientErr != nil {
+		err = clientErr
+		return backend, err
+	}
+
+	backend = manager.NewVaultBackend(client, secretPath, vaultSecretVersion)
+
+	return backend, err
+}
+
+// configDataFromSecretBackend loads the cluster's secret from the secret backend.  If there is no backend, the data is empty.
+func configDataFromSecretBackend() (data manager.ConfigData, err error) {
+	backend, backendErr := secretBackend()
+	if backendErr != nil {
+		err = backendErr
+		return data, err
+	}
+
+	if backend == nil {
+		return data, err
+	}
+
+	data, err = manager.ConfigsFromBackend(backend, clusterName, nodeRole, cloudProvider, verbose)
+	if err != nil {
+		err = errors.Wrapf(err, "Failed getting secrets")
+		return data, err
+	}
+
+	return data, err
+}
+
+// adminConfigDataFromSecretBackend loads the cluster's control plane secret, which alone holds the admin credentials, whatever role -r names.  If there is no backend, the data is empty.
+func adminConfigDataFromSecretBackend() (data manager.ConfigData, err error) {
+	backend, backendErr := secretBackend()
+	if backendErr != nil {
+		err = backendErr
+		return data, err
+	}
+
+	if backend == nil {
+		return data, err
+	}
+
+	data, err = manager.ConfigsFromBackend(backend, clusterName, manager.NodeRoleCp, cloudProvider, verbose)
+	if err != nil {
+		err = errors.Wrapf(err, "Failed getting secrets")
+		return data, err
+	}
+
+	return data, err
+}
+
+// ClusterConfigFromVaultOrFile returns the cluster config from the file given with --clusterconfig, or from the cluster.yaml key of the secret.  If neither is available the config is empty.
+func ClusterConfigFromVaultOrFile() (config manager.ClusterConfig, err error) {
+	if clusterConfigFile != "" {
+		config, err = manager.LoadClusterConfigFromFile(clusterConfigFile)
+		if err != nil {
+			err = errors.Wrapf(err, "Failed loading cluster config file %s", clusterConfigFile)
+			return config, err
+		}
+
+		return config, err
+	}
+
+	configDataFromSecret, secretErr := configDataFromSecretBackend()
+	if secretErr != nil {
+		err = secretErr
+		return config, err
+	}
+
+	if len(configDataFromSecret.ClusterConfig) == 0 {
+		return config, err
+	}
+
+	config, err = manager.LoadClusterConfig(configDataFromSecret.ClusterConfig)
+	if err != nil {
+		err = errors.Wrapf(err, "Failed loading cluster config from secret")
+		return config, err
+	}
+
+	return config, err
+}
+
+// clusterFilesDir is where a cluster's kubeconfig and talosconfig are looked for if they're not given with flags or in the secret: ~/.k8s-cluster-manager/<cluster>.
+func clusterFilesDir() (dir string, err error) {
 	hd, hdErr := homedir.Dir()
 	if hdErr != nil {
 		err = errors.Wrapf(hdErr, "unable to look up homedir")
-		return configBytes, patchBytes, nodeBytes, cfZoneID, cfToken, err
+		return dir, err
+	}
+
+	dir = filepath.Join(hd, clusterFilesDirName, clusterName)
+
+	return dir, err
+}
+
+// clusterFile reads the named file from the cluster's files dir.  found is false if there's no such file.
+func clusterFile(name string) (content []byte, found bool, err error) {
+	dir, dirErr := clusterFilesDir()
+	if dirErr != nil {
+		err = dirErr
+		return content, found, err
+	}
+
+	path := filepath.Join(dir, name)
+
+	content, err = os.ReadFile(path)
+	if os.IsNotExist(err) {
+		err = nil
+		return content, found, err
 	}
 
-	var configDataFromSecret manager.ConfigData
+	if err != nil {
+		err = errors.Wrapf(err, "Failed loading %s", path)
+		return content, found, err
+	}
 
-	if secretPath != "" {
-		tokenFile := fmt.Sprintf("%s/.vault-token", hd)
+	found = true
+	manager.VerboseOutput(verbose, "Using %s", path)
 
-		tokBytes, tokErr := os.ReadFile(tokenFile)
-		if tokErr != nil {
-			err = errors.Wrapf(tokErr, "No vault token found at %s", tokenFile)
-			return configBytes, patchBytes, nodeBytes, cfZoneID, cfToken, err
+	return content, found, err
+}
+
+// TalosconfigFromVaultOrFile returns the cluster's talosconfig from the file given with --talosconfig, or from the talosconfig key of the control plane secret, or from ~/.k8s-cluster-manager/<cluster>/talosconfig.  Failing those, the context named for the cluster in $TALOSCONFIG or ~/.talos/config is used.
+func TalosconfigFromVaultOrFile() (talosconfig []byte, err error) {
+	if talosconfigFile != "" {
+		talosconfig, err = os.ReadFile(talosconfigFile)
+		if err != nil {
+			err = errors.Wrapf(err, "Failed loading talosconfig file %s", talosconfigFile)
+			return talosconfig, err
 		}
 
-		tokString := strings.TrimRight(string(tokBytes), "\n")
+		return talosconfig, err
+	}
 
-		client, clientErr := manager.NewVaultClient(tokString, verbose)
-		if clientErr != nil {
-			err = errors.Wrapf(clientErr, "failed creating vault client")
-			return configBytes, patchBytes, nodeBytes, cfZoneID, cfToken, err
+	configDataFromSecret, secretErr := adminConfigDataFromSecretBackend()
+	if secretErr != nil {
+		err = secretErr
+		return talosconfig, err
+	}
+
+	if len(configDataFromSecret.Talosconfig) > 0 {
+		talosconfig = configDataFromSecret.Talosconfig
+		return talosconfig, err
+	}
+
+	talosconfig, found, fileErr := clusterFile(manager.TalosconfigKey)
+	if fileErr != nil || found {
+		err = fileErr
+		return talosconfig, err
+	}
+
+	defaultFile := os.Getenv("TALOSCONFIG")
+	if defaultFile == "" {
+		hd, hdErr := homedir.Dir()
+		if hdErr != nil {
+			err = errors.Wrapf(hdErr, "unable to look up homedir")
+			return talosconfig, err
 		}
 
-		var secretErr error
-		configDataFromSecret, secretErr = manager.ConfigsFromSecret(client, secretPath, clusterName, nodeRole, cloudProvider, verbose)
-		if secretErr != nil {
-			err = errors.Wrapf(secretErr, "Failed getting secrets")
-			return configBytes, patchBytes, nodeBytes, cfZoneID, cfToken, err
+		defaultFile = filepath.Join(hd, ".talos", "config")
+	}
+
+	talosconfig, err = os.ReadFile(defaultFile)
+	if err != nil {
+		err = errors.Wrapf(err, "No talosconfig given, none in the secret, and failed loading %s", defaultFile)
+		return talosconfig, err
+	}
+
+	// The default talosconfig may hold any number of clusters.
+	talosconfig, err = talos.ClusterTalosconfig(talosconfig, clusterName)
+	if err != nil {
+		err = errors.Wrapf(err, "No talosconfig given, none in the secret, and none for cluster %s in %s", clusterName, defaultFile)
+		return talosconfig, err
+	}
+
+	return talosconfig, err
+}
+
+// KubeconfigFromVaultOrFile returns the cluster's kubeconfig, and the context in it to use, from the file given with --kubeconfig, or from the kubeconfig key of the control plane secret, or from ~/.k8s-cluster-manager/<cluster>/kubeconfig.  Failing those, $KUBECONFIG or ~/.kube/config is used, but only if it has a context named for the cluster, or the one given with --kube-context.  Whatever the current context is doesn't matter.
+func KubeconfigFromVaultOrFile() (kubeconfig []byte, kubeContext string, err error) {
+	kubeContext = kubeContextName
+
+	if kubeconfigFile != "" {
+		kubeconfig, err = os.ReadFile(kubeconfigFile)
+		if err != nil {
+			err = errors.Wrapf(err, "Failed loading kubeconfig file %s", kubeconfigFile)
+			return kubeconfig, kubeContext, err
+		}
+
+		return kubeconfig, kubeContext, err
+	}
+
+	configDataFromSecret, secretErr := adminConfigDataFromSecretBackend()
+	if secretErr != nil {
+		err = secretErr
+		return kubeconfig, kubeContext, err
+	}
+
+	if len(configDataFromSecret.Kubeconfig) > 0 {
+		kubeconfig = configDataFromSecret.Kubeconfig
+		return kubeconfig, kubeContext, err
+	}
+
+	kubeconfig, found, fileErr := clusterFile(manager.KubeconfigKey)
+	if fileErr != nil || found {
+		err = fileErr
+		return kubeconfig, kubeContext, err
+	}
+
+	defaultFile := filepath.SplitList(os.Getenv("KUBECONFIG"))
+	if len(defaultFile) == 0 || defaultFile[0] == "" {
+		hd, hdErr := homedir.Dir()
+		if hdErr != nil {
+			err = errors.Wrapf(hdErr, "unable to look up homedir")
+			return kubeconfig, kubeContext, err
+		}
+
+		defaultFile = []string{filepath.Join(hd, ".kube", "config")}
+	}
+
+	kubeconfig, err = os.ReadFile(defaultFile[0])
+	if err != nil {
+		err = errors.Wrapf(err, "No kubeconfig given, none in the secret, and failed loading %s", defaultFile[0])
+		return kubeconfig, kubeContext, err
+	}
+
+	if kubeContext != "" {
+		return kubeconfig, kubeContext, err
+	}
+
+	// The default kubeconfig may hold any number of clusters, and its current context may be any of them.
+	kubeContext, found, err = kubernetes.ClusterContext(kubeconfig, clusterName)
+	if err != nil {
+		return kubeconfig, kubeContext, err
+	}
+
+	if !found {
+		err = errors.Errorf("No kubeconfig given, none in the secret, and no context named %s in %s.  Use --kube-context to pick one", strings.Join(kubernetes.ClusterContextNames(clusterName), " or "), defaultFile[0])
+		return kubeconfig, kubeContext, err
+	}
+
+	return kubeconfig, kubeContext, err
+}
+
+// setKubeClients gives the cluster manager Kubernetes clients for the cluster, built from the cluster's kubeconfig.  If required is false, a missing kubeconfig is only an error for the steps that need it.
+func setKubeClients(cm *aws.AWSClusterManager, required bool) (err error) {
+	kubeconfig, kubeContext, kcErr := KubeconfigFromVaultOrFile()
+	if kcErr != nil {
+		if required {
+			err = kcErr
+			return err
 		}
+
+		manager.VerboseOutput(verbose, "No kubeconfig: %s", kcErr)
+
+		return err
+	}
+
+	clients, clientsErr := kubernetes.NewClients(kubeconfig, kubeContext)
+	if clientsErr != nil {
+		err = clientsErr
+		return err
+	}
+
+	err = cm.SetKubeClients(clients)
+	if err != nil {
+		return err
+	}
+
+	cm.SkipIdentityCheck = skipIdentityCheck
+
+	return err
+}
+
+// existingNodePurpose returns the purpose of a node that's already in the cluster: the one given with -p, or else the purpose label on the node in Kubernetes, as drift checks use.
+func existingNodePurpose(cmd *cobra.Command, cm *aws.AWSClusterManager, name string) (nodePurpose string, err error) {
+	if cmd.Flags().Changed("purpose") {
+		nodePurpose = purpose
+		return nodePurpose, err
+	}
+
+	nodePurpose, err = cm.NodePurpose(name)
+	if err != nil {
+		err = errors.Wrapf(err, "failed finding the purpose of node %s.  Give it with -p", name)
+		return nodePurpose, err
+	}
+
+	return nodePurpose, err
+}
+
+// existingNodeRole returns the role of a node that's already in the cluster, from whether Kubernetes labels it as a control plane node, as drift checks do.  A role given with -r has to agree, so one node's config is never pushed onto a node of the other role.
+func existingNodeRole(cmd *cobra.Command, cm *aws.AWSClusterManager, name string) (role string, err error) {
+	role, err = cm.NodeRole(name)
+	if err != nil {
+		err = errors.Wrapf(err, "failed finding the role of node %s", name)
+		return role, err
+	}
+
+	err = checkRoleFlag(cmd, name, role)
+
+	return role, err
+}
+
+// checkRoleFlag makes sure a role given with -r agrees with the node's actual role.
+func checkRoleFlag(cmd *cobra.Command, name string, role string) (err error) {
+	if cmd.Flags().Changed("role") && nodeRole != role {
+		err = errors.Errorf("node %s is a %s node, but -r says %s", name, role, nodeRole)
+		return err
+	}
+
+	return err
+}
+
+// configsForRole loads the configs for nodes of a role, as ConfigsFromVaultOrFile does for the role given with -r.
+func configsForRole(role string) (configBytes []byte, patches manager.PatchSet, nodeBytes []byte, err error) {
+	flagRole := nodeRole
+	nodeRole = role
+
+	defer func() { nodeRole = flagRole }()
+
+	configBytes, patches, nodeBytes, _, _, err = ConfigsFromVaultOrFile()
+	if err != nil {
+		err = errors.Wrapf(err, "failed getting %s configs", role)
+		return configBytes, patches, nodeBytes, err
+	}
+
+	return configBytes, patches, nodeBytes, err
+}
+
+// optionalTalosconfig returns the cluster's talosconfig if one can be found, or nil if not.  It's for commands that only need the talosconfig for some nodes, such as deleting control plane nodes.
+func optionalTalosconfig() (talosconfig []byte) {
+	talosconfig, err := TalosconfigFromVaultOrFile()
+	if err != nil {
+		manager.VerboseOutput(verbose, "No talosconfig: %s", err)
+		talosconfig = nil
+	}
+
+	return talosconfig
+}
+
+// layeredPatches puts the role patch into the patches from the secret, and adds any from --patches-dir after them.
+func layeredPatches(secretPatches manager.PatchSet, rolePatchSource string, rolePatch []byte) (patches manager.PatchSet, err error) {
+	patches = secretPatches
+	patches.Role = []manager.Patch{{Source: rolePatchSource, Content: rolePatch}}
+
+	if patchesDir == "" {
+		return patches, err
+	}
+
+	dirPatches, dirErr := manager.LoadPatchDir(patchesDir, nodeRole)
+	if dirErr != nil {
+		err = dirErr
+		return patches, err
+	}
+
+	patches = patches.Merge(dirPatches)
+
+	return patches, err
+}
+
+// nodePatches returns the patches for a node, in the order they're applied, and says which they are.  It writes to stderr so it doesn't get mixed into rendered configs.
+func nodePatches(patches manager.PatchSet, name string, nodePurpose string) (contents []string) {
+	nodeSet := patches.ForNode(name, nodePurpose)
+
+	fmt.Fprintf(os.Stderr, "Patches for node %s: %s\n", name, strings.Join(manager.PatchSources(nodeSet), ", "))
+
+	contents = manager.PatchContents(nodeSet)
+
+	return contents
+}
+
+// ConfigsFromVaultOrFile will return the machine config, its layered patches, and the node config, pulled either from the secret backend (Vault if -m is specified, or SOPS files if --sops-dir is) or from files.  Patches from --patches-dir are layered after those in the secret.
+func ConfigsFromVaultOrFile() (configBytes []byte, patches manager.PatchSet, nodeBytes []byte, cfZoneID string, cfToken string, err error) {
+	configDataFromSecret, secretErr := configDataFromSecretBackend()
+	if secretErr != nil {
+		err = secretErr
+		return configBytes, patches, nodeBytes, cfZoneID, cfToken, err
 	}
 
 	// if a file is has not been specified, and a secret path has, we'll try to get the data out of vault.
@@ -90,39 +452,53 @@ func ConfigsFromVaultOrFile() (configBytes []byte, patchBytes []byte, nodeBytes
 		configBytes, err = os.ReadFile(machineConfigFile)
 		if err != nil {
 			err = errors.Wrapf(err, "Failed loading machine config file %s", machineConfigFile)
-			return configBytes, patchBytes, nodeBytes, cfZoneID, cfToken, err
+			return configBytes, patches, nodeBytes, cfZoneID, cfToken, err
 		}
 	}
 
 	if len(configBytes) == 0 {
 		err = errors.Wrapf(err, "Cannot proceed without a Talos machine configuration.")
-		return configBytes, patchBytes, nodeBytes, cfZoneID, cfToken, err
+		return configBytes, patches, nodeBytes, cfZoneID, cfToken, err
 	}
 
-	// Load Talos Machine Config Patch from Vault if a patch has not been provided manually but a secret path has.
-	// This is a little magic as the Talos patch loader expects to get yaml as a string or in a filename, so we only handle the case where there is no patch provided, in which case we load it from the secret.
+	// Load Talos Machine Config Patch from the secret if a patch file has not been provided.
+	var patchBytes []byte
+	patchSource := manager.TalosMachineConfigPatchKey
+
 	if machineConfigPatch == "" {
-		machineConfigPatch = string(configDataFromSecret.TalosMachineConfigPatch)
+		patchBytes = configDataFromSecret.TalosMachineConfigPatch
+	} else {
+		patchSource = machineConfigPatch
+		patchBytes, err = os.ReadFile(machineConfigPatch)
+		if err != nil {
+			err = errors.Wrapf(err, "Failed loading machine config patch file %s", machineConfigPatch)
+			return configBytes, patches, nodeBytes, cfZoneID, cfToken, err
+		}
 	}
 
-	if machineConfigPatch == "" {
+	if len(patchBytes) == 0 {
 		err = errors.Wrapf(err, "Cannot proceed with out a talos machine config patch.")
-		return configBytes, patchBytes, nodeBytes, cfZoneID, cfToken, err
+		return configBytes, patches, nodeBytes, cfZoneID, cfToken, err
+	}
+
+	patches, err = layeredPatches(configDataFromSecret.Patches, patchSource, patchBytes)
+	if err != nil {
+		return configBytes, patches, nodeBytes, cfZoneID, cfToken, err
 	}
 
 	if nodeConfigFile == "" {
 		nodeBytes = configDataFromSecret.NodeConfig
 	} else {
-		configBytes, err = os.ReadFile(nodeConfigFile)
+		nodeBytes, err = os.ReadFile(nodeConfigFile)
 		if err != nil {
-			err = errors.Wrapf(err, "Failed loading node config file %s", machineConfigFile)
-			return configBytes, patchBytes, nodeBytes, cfZoneID, cfToken, err
+			err = errors.Wrapf(err, "Failed loading node config file %s", nodeConfigFile)
+			return configBytes, patches, nodeBytes, cfZoneID, cfToken, err
 		}
 	}
 
 	if len(nodeBytes) == 0 {
 		err = errors.Wrapf(err, "Cannot proceed without a nodeconfiguration.")
-		return configBytes, patchBytes, nodeBytes, cfZoneID, cfToken, err
+		return configBytes, patches, nodeBytes, cfZoneID, cfToken, err
 	}
 
 	cfZoneID = os.Getenv(manager.CloudflareZoneIDEnvVar)
@@ -135,6 +511,32 @@ func ConfigsFromVaultOrFile() (configBytes []byte, patchBytes []byte, nodeBytes
 		cfToken = configDataFromSecret.CloudflareAPIToken
 	}
 
-	return configBytes, patchBytes, nodeBytes, cfZoneID, cfToken, err
+	return configBytes, patches, nodeBytes, cfZoneID, cfToken, err
+
+}
+
+// DNSCredentialsFromEnvOrVault returns the Cloudflare credentials from the environment, falling back on the secret backend.
+func DNSCredentialsFromEnvOrVault() (cfZoneID string, cfToken string, err error) {
+	cfZoneID = os.Getenv(manager.CloudflareZoneIDEnvVar)
+	cfToken = os.Getenv(manager.CloudflareAPITokenEnvVar)
+
+	if cfZoneID != "" && cfToken != "" {
+		return cfZoneID, cfToken, err
+	}
+
+	configDataFromSecret, secretErr := configDataFromSecretBackend()
+	if secretErr != nil {
+		err = secretErr
+		return cfZoneID, cfToken, err
+	}
+
+	if cfZoneID == "" {
+		cfZoneID = configDataFromSecret.CloudflareZoneID
+	}
+
+	if cfToken == "" {
+		cfToken = configDataFromSecret.CloudflareAPIToken
+	}
 
+	return cfZoneID, cfToken, err
 }
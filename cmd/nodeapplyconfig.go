@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/talos"
+	"github.com/spf13/cobra"
+	"log"
+	"time"
+)
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var applyMode string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var applyTryTimeout time.Duration
+
+// nodeApplyConfigCmd represents the node apply-config command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var nodeApplyConfigCmd = &cobra.Command{
+	Use:   "apply-config <node name> [node name...]",
+	Short: "Push an updated machine config to existing nodes",
+	Long: `
+Push the machine config and patch for each node's role to nodes that are already in the cluster.  The role comes from whether Kubernetes labels the node as control plane; if -r is given, it has to agree.  Each node gets the patches for the purpose on its purpose label in Kubernetes, unless -p is given.
+
+The nodes are reached over the Talos API and verified with the cluster's talosconfig.  Unlike node creation, nothing is sent insecurely.
+
+--mode picks how the nodes take the config:
+
+  auto       Apply without a reboot if possible, otherwise reboot.
+  reboot     Always reboot.
+  no-reboot  Fail if the change needs a reboot.
+  staged     Apply on the next reboot.
+  try        Apply without a reboot, and roll back after --try-timeout unless confirmed.  After a minute, the config is confirmed if the node's Talos services are healthy and it's Ready in Kubernetes, and rolled back otherwise.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		nodeNames := args
+		if nodeName != "" {
+			nodeNames = append([]string{nodeName}, nodeNames...)
+		}
+
+		if len(nodeNames) == 0 {
+			log.Fatalf("Cannot apply config without a node name")
+		}
+
+		if clusterName == "" {
+			log.Fatalf("Cannot apply config without a cluster name")
+		}
+
+		mode, modeErr := talos.ParseApplyMode(applyMode)
+		if modeErr != nil {
+			log.Fatalf("Bad apply mode: %s", modeErr)
+		}
+
+		cfZoneID, cfToken, err := DNSCredentialsFromEnvOrVault()
+		if err != nil {
+			log.Fatalf("Failed getting DNS credentials: %s", err)
+		}
+
+		talosconfig, tcErr := TalosconfigFromVaultOrFile()
+		if tcErr != nil {
+			log.Fatalf("Failed getting talosconfig: %s", tcErr)
+		}
+
+		switch cloudProvider {
+		case cloudProviderAWS:
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
+			if cmErr != nil {
+				log.Fatalf("Failed creating cluster manager: %s", cmErr)
+			}
+
+			kubeErr := setKubeClients(cm, true)
+			if kubeErr != nil {
+				log.Fatalf("Failed getting Kubernetes clients: %s", kubeErr)
+			}
+
+			cm.Talosconfig = talosconfig
+
+			// Each node gets the configs for its own role, loaded once per role.
+			roles := make(map[string]aws.RoleConfig)
+
+			for _, name := range nodeNames {
+				role, roleErr := existingNodeRole(cmd, cm, name)
+				if roleErr != nil {
+					log.Fatalf("Failed getting role of node %s: %s", name, roleErr)
+				}
+
+				roleConfig, loaded := roles[role]
+				if !loaded {
+					configBytes, patches, nodeBytes, configsErr := configsForRole(role)
+					if configsErr != nil {
+						log.Fatalf("Failed getting required node data: %s", configsErr)
+					}
+
+					nodeConfig, ncErr := aws.LoadAWSNodeConfig(nodeBytes)
+					if ncErr != nil {
+						log.Fatalf("Failed loading %s node config: %s", role, ncErr)
+					}
+
+					roleConfig = aws.RoleConfig{MachineConfig: configBytes, NodeConfig: nodeConfig, Patches: patches}
+					roles[role] = roleConfig
+				}
+
+				namePurpose, purposeErr := existingNodePurpose(cmd, cm, name)
+				if purposeErr != nil {
+					log.Fatalf("Failed getting purpose of node %s: %s", name, purposeErr)
+				}
+
+				applyErr := cm.ApplyNodeConfig(name, role, roleConfig.NodeConfig, roleConfig.MachineConfig, nodePatches(roleConfig.Patches, name, namePurpose), mode, applyTryTimeout)
+				if applyErr != nil {
+					log.Fatalf("error applying config to node %s: %s", name, applyErr)
+				}
+			}
+
+		default:
+			log.Fatalf("Cloud provider %q is not yet supported.", cloudProvider)
+		}
+	},
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	nodeCmd.AddCommand(nodeApplyConfigCmd)
+
+	nodeApplyConfigCmd.Flags().StringVar(&applyMode, "mode", string(talos.ApplyModeAuto), "How to apply the config: auto, reboot, no-reboot, staged or try")
+	nodeApplyConfigCmd.Flags().DurationVar(&applyTryTimeout, "try-timeout", talos.DefaultTryTimeout, "How long a config applied in try mode lasts before Talos rolls it back, unless confirmed")
+}
@@ -6,10 +6,8 @@ package cmd
 import (
 	"context"
 	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
-	"github.com/nikogura/k8s-cluster-manager/pkg/manager/cloudflare"
 	"github.com/spf13/cobra"
 	"log"
-	"os"
 	"reflect"
 )
 
@@ -41,21 +39,29 @@ Create a new Kubernetes Node
 			log.Fatalf("Cannot list without a cluster name")
 		}
 
-		configBytes, patchBytes, nodeBytes, cfZoneID, cfToken, err := ConfigsFromVaultOrFile()
+		configBytes, patches, nodeBytes, cfZoneID, cfToken, err := ConfigsFromVaultOrFile()
 		if err != nil {
 			log.Fatalf("Failed getting required node data: %s", err)
 		}
 
 		switch cloudProvider {
 		case cloudProviderAWS:
-			profile := os.Getenv("AWS_PROFILE")
-			role := os.Getenv("AWS_ROLE")
-			dnsManager := cloudflare.NewCloudFlareManager(cfZoneID, cfToken)
-			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, profile, role, dnsManager, verbose)
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
 			if cmErr != nil {
 				log.Fatalf("Failed creating cluster manager: %s", cmErr)
 			}
 
+			kubeErr := setKubeClients(cm, false)
+			if kubeErr != nil {
+				log.Fatalf("Failed getting Kubernetes clients: %s", kubeErr)
+			}
+
 			nodeConfig, ncErr := aws.LoadAWSNodeConfig(nodeBytes)
 			if ncErr != nil {
 				log.Fatalf("Failed loading node config %s: %s", nodeConfigFile, ncErr)
@@ -72,7 +78,7 @@ Create a new Kubernetes Node
 			}
 
 			// Create Node
-			createErr := cm.CreateNode(nodeName, nodeRole, nodeConfig, configBytes, []string{string(patchBytes)}, purpose)
+			createErr := cm.CreateNode(nodeName, nodeRole, nodeConfig, configBytes, nodePatches(patches, nodeName, purpose), purpose)
 			if createErr != nil {
 				log.Fatalf("error creating node %s: %s", nodeName, createErr)
 			}
@@ -6,12 +6,17 @@ package cmd
 import (
 	"context"
 	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
-	"github.com/nikogura/k8s-cluster-manager/pkg/manager/cloudflare"
 	"github.com/spf13/cobra"
 	"log"
-	"os"
+	"time"
 )
 
+//nolint:gochecknoglobals // Cobra boilerplate
+var resetNode bool
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var resetTimeout time.Duration
+
 // nodedeleteCmd represents the nodedelete command.
 //
 //nolint:gochecknoglobals // Cobra boilerplate
@@ -20,6 +25,10 @@ var nodedeleteCmd = &cobra.Command{
 	Short: "Delete a Kubernetes Node from a Cluster",
 	Long: `
 Delete a Kubernetes Node from a Cluster.
+
+Control plane nodes are taken out of etcd first.  The deletion is refused if the remaining etcd members couldn't keep quorum.  This needs the cluster's talosconfig.
+
+With --reset the node is gracefully reset through the Talos API first, wiping its STATE and EPHEMERAL partitions, so it leaves etcd and Kubernetes cleanly.  If the reset isn't done within --reset-timeout, the node is terminated anyway.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		ctx := context.Background()
@@ -34,21 +43,42 @@ Delete a Kubernetes Node from a Cluster.
 			log.Fatalf("Cannot list without a cluster name")
 		}
 
-		_, _, _, cfZoneID, cfToken, err := ConfigsFromVaultOrFile()
+		_, _, nodeBytes, cfZoneID, cfToken, err := ConfigsFromVaultOrFile()
 		if err != nil {
 			log.Fatalf("Failed getting required node data: %s", err)
 		}
 
 		switch cloudProvider {
 		case cloudProviderAWS:
-			profile := os.Getenv("AWS_PROFILE")
-			role := os.Getenv("AWS_ROLE")
-			dnsManager := cloudflare.NewCloudFlareManager(cfZoneID, cfToken)
-			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, profile, role, dnsManager, verbose)
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
 			if cmErr != nil {
 				log.Fatalf("Failed creating cluster manager: %s", cmErr)
 			}
 
+			kubeErr := setKubeClients(cm, true)
+			if kubeErr != nil {
+				log.Fatalf("Failed getting Kubernetes clients: %s", kubeErr)
+			}
+
+			nodeConfig, ncErr := aws.LoadAWSNodeConfig(nodeBytes)
+			if ncErr != nil {
+				log.Fatalf("Failed loading node config %s: %s", nodeConfigFile, ncErr)
+			}
+
+			// The domain is needed to find the node's DNS records.
+			cm.Domain = nodeConfig.Domain
+
+			// The talosconfig is needed to take control plane nodes out of etcd, and to reset nodes.
+			cm.Talosconfig = optionalTalosconfig()
+			cm.GracefulReset = resetNode
+			cm.ResetTimeout = resetTimeout
+
 			// Delete Node
 			delErr := cm.DeleteNode(nodeName)
 			if delErr != nil {
@@ -65,4 +95,7 @@ Delete a Kubernetes Node from a Cluster.
 //nolint:gochecknoinits // Cobra boilerplate
 func init() {
 	nodeCmd.AddCommand(nodedeleteCmd)
+
+	nodedeleteCmd.Flags().BoolVar(&resetNode, "reset", false, "Gracefully reset the node through the Talos API before terminating it")
+	nodedeleteCmd.Flags().DurationVar(&resetTimeout, "reset-timeout", 5*time.Minute, "How long to wait for a reset before terminating the node anyway")
 }
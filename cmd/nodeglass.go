@@ -5,14 +5,18 @@ package cmd
 
 import (
 	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
 	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
-	"github.com/nikogura/k8s-cluster-manager/pkg/manager/cloudflare"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"log"
-	"os"
 	"reflect"
+	"time"
 )
 
+//nolint:gochecknoglobals // Cobra boilerplate
+var etcdJoinTimeout time.Duration
+
 // nodeglassCmd represents the nodeglass command.
 //
 //nolint:gochecknoglobals // Cobra boilerplate
@@ -22,6 +26,10 @@ var nodeglassCmd = &cobra.Command{
 	Long: `
 Deletes and Creates a Kubernetes Node
 Convenience wrapper that calls Delete() and then Create().
+
+The new node gets the old node's role: control plane if Kubernetes lists it as a control plane node, and worker otherwise.  If -r is given and doesn't agree, nothing is deleted.
+
+For control plane nodes the old node is taken out of etcd, and the glass waits for the new node to join etcd before finishing.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -37,28 +45,39 @@ Convenience wrapper that calls Delete() and then Create().
 			log.Fatalf("Cannot list without a cluster name")
 		}
 
-		configBytes, patchBytes, nodeBytes, cfZoneID, cfToken, err := ConfigsFromVaultOrFile()
+		cfZoneID, cfToken, err := DNSCredentialsFromEnvOrVault()
 		if err != nil {
-			log.Fatalf("Failed getting required node data: %s", err)
+			log.Fatalf("Failed getting DNS credentials: %s", err)
 		}
 
 		switch cloudProvider {
 		case cloudProviderAWS:
-			profile := os.Getenv("AWS_PROFILE")
-			role := os.Getenv("AWS_ROLE")
-			dnsManager := cloudflare.NewCloudFlareManager(cfZoneID, cfToken)
-			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, profile, role, dnsManager, verbose)
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
 			if cmErr != nil {
 				log.Fatalf("Failed creating cluster manager: %s", cmErr)
 			}
 
-			// Delete Node
-			delErr := cm.DeleteNode(nodeName)
-			if delErr != nil {
-				log.Fatalf("error deleting node %s: %s", nodeName, delErr)
+			kubeErr := setKubeClients(cm, true)
+			if kubeErr != nil {
+				log.Fatalf("Failed getting Kubernetes clients: %s", kubeErr)
 			}
 
-			// TODO Wait for Node Termination
+			// The old node's role decides whether it leaves etcd, so the new node gets the same role, and the configs for it.
+			role, roleErr := glassNodeRole(cmd, cm, nodeName)
+			if roleErr != nil {
+				log.Fatalf("Failed getting role of node %s: %s", nodeName, roleErr)
+			}
+
+			configBytes, patches, nodeBytes, configsErr := configsForRole(role)
+			if configsErr != nil {
+				log.Fatalf("Failed getting required node data: %s", configsErr)
+			}
 
 			nodeConfig, ncErr := aws.LoadAWSNodeConfig(nodeBytes)
 			if ncErr != nil {
@@ -70,12 +89,36 @@ Convenience wrapper that calls Delete() and then Create().
 				log.Fatalf("No Node Config.  Cannot continue.")
 			}
 
+			// The domain is needed to find the node's DNS records.
+			cm.Domain = nodeConfig.Domain
+
+			// The talosconfig is needed to take control plane nodes out of etcd, and to reset nodes.
+			cm.Talosconfig = optionalTalosconfig()
+			cm.GracefulReset = resetNode
+			cm.ResetTimeout = resetTimeout
+
+			// Delete Node
+			delErr := cm.DeleteNode(nodeName)
+			if delErr != nil {
+				log.Fatalf("error deleting node %s: %s", nodeName, delErr)
+			}
+
+			// TODO Wait for Node Termination
+
 			// Create Node
-			createErr := cm.CreateNode(nodeName, nodeRole, nodeConfig, configBytes, []string{string(patchBytes)}, purpose)
+			createErr := cm.CreateNode(nodeName, role, nodeConfig, configBytes, nodePatches(patches, nodeName, purpose), purpose)
 			if createErr != nil {
 				log.Fatalf("error creating node %s: %s", nodeName, createErr)
 			}
 
+			// A control plane glass isn't done until the new node has taken the old one's place in etcd.
+			if role == manager.NodeRoleCp {
+				joinErr := cm.WaitForEtcdJoin(nodeName, etcdJoinTimeout)
+				if joinErr != nil {
+					log.Fatalf("error waiting for node %s to join etcd: %s", nodeName, joinErr)
+				}
+			}
+
 		default:
 			log.Fatalf("Cloud provider %q is not yet supported.", cloudProvider)
 		}
@@ -85,4 +128,31 @@ Convenience wrapper that calls Delete() and then Create().
 //nolint:gochecknoinits // Cobra boilerplate
 func init() {
 	nodeCmd.AddCommand(nodeglassCmd)
+
+	nodeglassCmd.Flags().BoolVar(&resetNode, "reset", false, "Gracefully reset the old node through the Talos API before terminating it")
+	nodeglassCmd.Flags().DurationVar(&resetTimeout, "reset-timeout", 5*time.Minute, "How long to wait for a reset before terminating the old node anyway")
+	nodeglassCmd.Flags().DurationVar(&etcdJoinTimeout, "etcd-join-timeout", 15*time.Minute, "How long to wait for a new control plane node to join etcd")
+}
+
+// glassNodeRole returns the role of a node about to be glassed, judged just as DeleteNode judges whether to take it out of etcd.  A role given with -r has to agree.
+func glassNodeRole(cmd *cobra.Command, cm *aws.AWSClusterManager, name string) (role string, err error) {
+	err = cm.VerifyClusterIdentity()
+	if err != nil {
+		return role, err
+	}
+
+	isCP, cpErr := cm.IsControlPlane(name)
+	if cpErr != nil {
+		err = errors.Wrapf(cpErr, "failed checking whether %s is a control plane node", name)
+		return role, err
+	}
+
+	role = manager.NodeRoleWorker
+	if isCP {
+		role = manager.NodeRoleCp
+	}
+
+	err = checkRoleFlag(cmd, name, role)
+
+	return role, err
 }
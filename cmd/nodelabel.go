@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/kubernetes"
+	"github.com/spf13/cobra"
+	"log"
+)
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var labelTaints []string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var labelAnnotations []string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var labelFromConfig bool
+
+// nodeLabelCmd represents the node label command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var nodeLabelCmd = &cobra.Command{
+	Use:   "label <node name> [KEY=VALUE | KEY-]...",
+	Short: "Change a node's labels, annotations and taints",
+	Long: `
+Change a node's labels, annotations and taints in Kubernetes.
+
+Labels are given like kubectl takes them: KEY=VALUE sets a label, and KEY- removes it.
+
+  --annotation KEY=VALUE | KEY-               Set or remove an annotation.  Repeatable.
+  --taint KEY[=VALUE]:EFFECT | KEY[:EFFECT]-   Set or remove a taint.  EFFECT is NoSchedule (the default), PreferNoSchedule or NoExecute.  Removing a taint without an effect removes it with any effect.  Repeatable.
+  --from-config                               Also apply the labels, annotations and taints the node config gives nodes of the node's role and purpose, as 'node create' does.  The role and purpose are the node's in Kubernetes.  -p overrides the purpose, and -r has to agree with the role.
+
+Labels and annotations are patched, so nothing else on the node is touched.  Running the same command twice changes nothing the second time.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		labelArgs := args
+		if nodeName == "" && len(args) > 0 {
+			nodeName = args[0]
+			labelArgs = args[1:]
+		}
+
+		if nodeName == "" {
+			log.Fatalf("Cannot label without a node name")
+		}
+
+		if clusterName == "" {
+			log.Fatalf("Cannot label without a cluster name")
+		}
+
+		change := kubernetes.NodeMetadataChange{}
+
+		labels, removeLabels, labelErr := kubernetes.ParseKeyValueArgs(labelArgs)
+		if labelErr != nil {
+			log.Fatalf("Bad label: %s", labelErr)
+		}
+
+		annotations, removeAnnotations, annotationErr := kubernetes.ParseKeyValueArgs(labelAnnotations)
+		if annotationErr != nil {
+			log.Fatalf("Bad annotation: %s", annotationErr)
+		}
+
+		taints, removeTaints, taintErr := kubernetes.ParseTaintArgs(labelTaints)
+		if taintErr != nil {
+			log.Fatalf("Bad taint: %s", taintErr)
+		}
+
+		// What's given on the command line goes on top of the config.
+		cliSet := kubernetes.NodeMetadata{Labels: labels, Annotations: annotations, Taints: taints}
+		change.RemoveLabels = removeLabels
+		change.RemoveAnnotations = removeAnnotations
+		change.RemoveTaints = removeTaints
+
+		if !labelFromConfig && cliSet.Empty() && change.Empty() {
+			log.Fatalf("Nothing to change.  Give labels, --annotation, --taint, or --from-config.")
+		}
+
+		cfZoneID, cfToken, dnsErr := DNSCredentialsFromEnvOrVault()
+		if dnsErr != nil {
+			log.Fatalf("Failed getting DNS credentials: %s", dnsErr)
+		}
+
+		switch cloudProvider {
+		case cloudProviderAWS:
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
+			if cmErr != nil {
+				log.Fatalf("Failed creating cluster manager: %s", cmErr)
+			}
+
+			kubeErr := setKubeClients(cm, true)
+			if kubeErr != nil {
+				log.Fatalf("Failed getting Kubernetes clients: %s", kubeErr)
+			}
+
+			if labelFromConfig {
+				// The node config comes from the secret for the node's role, so the role has to be known before it's loaded.
+				role, roleErr := existingNodeRole(cmd, cm, nodeName)
+				if roleErr != nil {
+					log.Fatalf("Failed getting role of node %s: %s", nodeName, roleErr)
+				}
+
+				namePurpose, purposeErr := existingNodePurpose(cmd, cm, nodeName)
+				if purposeErr != nil {
+					log.Fatalf("Failed getting purpose of node %s: %s", nodeName, purposeErr)
+				}
+
+				_, _, nodeBytes, err := configsForRole(role)
+				if err != nil {
+					log.Fatalf("Failed getting required node data: %s", err)
+				}
+
+				nodeConfig, ncErr := aws.LoadAWSNodeConfig(nodeBytes)
+				if ncErr != nil {
+					log.Fatalf("Failed loading node config %s: %s", nodeConfigFile, ncErr)
+				}
+
+				change.Set = nodeConfig.NodeMetadataFor(namePurpose)
+			}
+
+			change.Set = change.Set.Merge(kubernetes.NodeMetadata{Labels: cliSet.Labels, Annotations: cliSet.Annotations})
+			change.Set.Taints = append(change.Set.Taints, cliSet.Taints...)
+
+			if change.Empty() {
+				log.Fatalf("Nothing to change.  The node config has nothing for node %s.", nodeName)
+			}
+
+			applyErr := cm.LabelNode(nodeName, change)
+			if applyErr != nil {
+				log.Fatalf("Failed labelling node %s: %s", nodeName, applyErr)
+			}
+
+			fmt.Printf("Updated labels, annotations and taints of node %s\n", nodeName)
+
+		default:
+			log.Fatalf("Cloud provider %q is not yet supported.", cloudProvider)
+		}
+	},
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	nodeCmd.AddCommand(nodeLabelCmd)
+
+	nodeLabelCmd.Flags().StringArrayVar(&labelTaints, "taint", nil, "Taint to set (KEY[=VALUE]:EFFECT), or remove (KEY[:EFFECT]-).  Repeatable.")
+	nodeLabelCmd.Flags().StringArrayVar(&labelAnnotations, "annotation", nil, "Annotation to set (KEY=VALUE), or remove (KEY-).  Repeatable.")
+	nodeLabelCmd.Flags().BoolVar(&labelFromConfig, "from-config", false, "Also apply the labels, annotations and taints from the node config for the node's role and purpose")
+}
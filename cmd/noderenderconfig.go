@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/talos"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+)
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var renderOutput string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var renderMode string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var renderShowSecrets bool
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var renderFromCluster bool
+
+// nodeRenderConfigCmd represents the node render-config command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var nodeRenderConfigCmd = &cobra.Command{
+	Use:   "render-config <node name>",
+	Short: "Render a node's final machine config without applying it",
+	Long: `
+Render the final machine config for a node, without contacting any node.
+
+The machine config and patch for the node role (-r) are patched with the hostname patch and the patches for the purpose given with -p, exactly as 'node create' and 'node apply-config' do.  Only the configs are read.  Nothing in AWS or Kubernetes is looked at.
+
+With --from-cluster, the node has to be in the cluster already.  It's rendered with the configs for its role in Kubernetes, which -r has to agree with, gets the patches for the purpose on its purpose label, unless -p is given, and the instance patch with its provider ID and topology labels.  A warning is printed if it has no running instance to make the instance patch from.
+
+The result is validated for the runtime mode given with --mode (cloud or metal), and written to stdout, or to the file given with -o.
+
+Secrets are masked unless --show-secrets is given.  Exits non-zero if the config isn't valid, after writing it out so it can be looked at.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		if len(args) > 0 {
+			if nodeName == "" {
+				nodeName = args[0]
+			}
+		}
+
+		if nodeName == "" {
+			log.Fatalf("Cannot render a config without a node name")
+		}
+
+		mode, modeErr := talos.ParseValidationMode(renderMode)
+		if modeErr != nil {
+			log.Fatalf("Invalid mode: %s", modeErr)
+		}
+
+		switch cloudProvider {
+		case cloudProviderAWS:
+			renderRole := nodeRole
+			renderPurpose := purpose
+			var instancePatch string
+
+			// Rendering works from the configs alone.  Only --from-cluster looks up what AWS and Kubernetes know about an existing node.
+			if renderFromCluster {
+				cm, cmErr := renderClusterManager(ctx)
+				if cmErr != nil {
+					log.Fatalf("Failed reaching cluster %s: %s", clusterName, cmErr)
+				}
+
+				// An existing node is rendered with the configs for the role it has, as 'node apply-config' would.
+				role, roleErr := existingNodeRole(cmd, cm, nodeName)
+				if roleErr != nil {
+					log.Fatalf("Failed getting role of node %s: %s", nodeName, roleErr)
+				}
+
+				renderRole = role
+
+				namePurpose, purposeErr := existingNodePurpose(cmd, cm, nodeName)
+				if purposeErr != nil {
+					log.Fatalf("Failed getting purpose of node %s: %s", nodeName, purposeErr)
+				}
+
+				renderPurpose = namePurpose
+
+				patch, found, patchErr := cm.NodeInstancePatch(nodeName)
+				switch {
+				case patchErr != nil:
+					log.Fatalf("Failed making the instance patch for node %s: %s", nodeName, patchErr)
+				case !found:
+					fmt.Fprintf(os.Stderr, "Warning: node %s has no running instance.  Rendering without the instance patch, which 'node create' adds once it has one.\n", nodeName)
+				default:
+					instancePatch = patch
+				}
+			}
+
+			configBytes, patches, nodeBytes, configsErr := configsForRole(renderRole)
+			if configsErr != nil {
+				log.Fatalf("Failed getting required node data: %s", configsErr)
+			}
+
+			nodeConfig, ncErr := aws.LoadAWSNodeConfig(nodeBytes)
+			if ncErr != nil {
+				log.Fatalf("Failed loading node config %s: %s", nodeConfigFile, ncErr)
+			}
+
+			node := aws.AWSNode{
+				NodeName:   nodeName,
+				NodeRole:   renderRole,
+				Config:     &nodeConfig,
+				NodeDomain: nodeConfig.Domain,
+			}
+
+			renderPatches := nodePatches(patches, nodeName, renderPurpose)
+
+			// The instance patch goes last, as 'node apply-config' puts it.
+			if instancePatch != "" {
+				renderPatches = append(renderPatches, instancePatch)
+			}
+
+			rendered, warnings, renderErr := talos.RenderConfig(node, configBytes, renderPatches, mode, renderShowSecrets)
+			if rendered == nil && renderErr != nil {
+				log.Fatalf("Failed rendering config for %s: %s", nodeName, renderErr)
+			}
+
+			if renderOutput == "" {
+				fmt.Print(string(rendered))
+			} else {
+				writeErr := os.WriteFile(renderOutput, rendered, 0600)
+				if writeErr != nil {
+					log.Fatalf("Failed writing %s: %s", renderOutput, writeErr)
+				}
+			}
+
+			for _, warning := range warnings {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+			}
+
+			if renderErr != nil {
+				log.Fatalf("Invalid config: %s", renderErr)
+			}
+
+		default:
+			log.Fatalf("Cloud provider %q is not yet supported.", cloudProvider)
+		}
+	},
+}
+
+// renderClusterManager connects to the cluster, for looking up what's known about an existing node.
+func renderClusterManager(ctx context.Context) (cm *aws.AWSClusterManager, err error) {
+	if clusterName == "" {
+		err = errors.New("no cluster name")
+		return cm, err
+	}
+
+	cfZoneID, cfToken, dnsErr := DNSCredentialsFromEnvOrVault()
+	if dnsErr != nil {
+		err = errors.Wrapf(dnsErr, "failed getting DNS credentials")
+		return cm, err
+	}
+
+	awsCreds, awsCredsErr := awsCredentialsConfig()
+	if awsCredsErr != nil {
+		err = errors.Wrapf(awsCredsErr, "failed getting AWS credentials")
+		return cm, err
+	}
+
+	dnsManager := newDNSManager(cfZoneID, cfToken)
+
+	cm, err = aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating cluster manager")
+		return cm, err
+	}
+
+	err = setKubeClients(cm, true)
+	if err != nil {
+		err = errors.Wrapf(err, "failed getting Kubernetes clients")
+		return cm, err
+	}
+
+	return cm, err
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	nodeCmd.AddCommand(nodeRenderConfigCmd)
+
+	nodeRenderConfigCmd.Flags().StringVarP(&renderOutput, "output", "o", "", "File to write the config to.  Defaults to stdout.")
+	nodeRenderConfigCmd.Flags().StringVar(&renderMode, "mode", string(talos.ValidationModeCloud), "Runtime mode to validate the config for: cloud or metal")
+	nodeRenderConfigCmd.Flags().BoolVar(&renderShowSecrets, "show-secrets", false, "Show secrets instead of masking them")
+	nodeRenderConfigCmd.Flags().BoolVar(&renderFromCluster, "from-cluster", false, "Look up an existing node's role, purpose and instance patch in AWS and Kubernetes")
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/aws"
+	"github.com/spf13/cobra"
+	"log"
+	"time"
+)
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var upgradeImage string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var upgradeTimeout time.Duration
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var upgradeForce bool
+
+// nodeUpgradeCmd represents the node upgrade command.
+//
+//nolint:gochecknoglobals // Cobra boilerplate
+var nodeUpgradeCmd = &cobra.Command{
+	Use:   "upgrade <node name> [node name...]",
+	Short: "Upgrade Talos on existing nodes",
+	Long: `
+Upgrade Talos on existing nodes to the installer image given with --image, e.g. ghcr.io/siderolabs/installer:v1.9.5.
+
+Nodes are upgraded one at a time.  Each node has to come back running the new Talos version, and be Ready in Kubernetes, before the next one is started.  Nodes already running the version are skipped unless --force is given.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+
+		nodeNames := args
+		if nodeName != "" {
+			nodeNames = append([]string{nodeName}, nodeNames...)
+		}
+
+		if len(nodeNames) == 0 {
+			log.Fatalf("Cannot upgrade without a node name")
+		}
+
+		if clusterName == "" {
+			log.Fatalf("Cannot upgrade without a cluster name")
+		}
+
+		if upgradeImage == "" {
+			log.Fatalf("Cannot upgrade without an installer image")
+		}
+
+		cfZoneID, cfToken, err := DNSCredentialsFromEnvOrVault()
+		if err != nil {
+			log.Fatalf("Failed getting DNS credentials: %s", err)
+		}
+
+		talosconfig, tcErr := TalosconfigFromVaultOrFile()
+		if tcErr != nil {
+			log.Fatalf("Failed getting talosconfig: %s", tcErr)
+		}
+
+		switch cloudProvider {
+		case cloudProviderAWS:
+			awsCreds, awsCredsErr := awsCredentialsConfig()
+			if awsCredsErr != nil {
+				log.Fatalf("Failed getting AWS credentials: %s", awsCredsErr)
+			}
+
+			dnsManager := newDNSManager(cfZoneID, cfToken)
+			cm, cmErr := aws.NewAWSClusterManager(ctx, clusterName, awsCreds, dnsManager, verbose)
+			if cmErr != nil {
+				log.Fatalf("Failed creating cluster manager: %s", cmErr)
+			}
+
+			kubeErr := setKubeClients(cm, true)
+			if kubeErr != nil {
+				log.Fatalf("Failed getting Kubernetes clients: %s", kubeErr)
+			}
+
+			cm.Talosconfig = talosconfig
+
+			for _, name := range nodeNames {
+				upgradeErr := cm.UpgradeNode(name, upgradeImage, upgradeTimeout, upgradeForce)
+				if upgradeErr != nil {
+					log.Fatalf("error upgrading node %s: %s", name, upgradeErr)
+				}
+			}
+
+		default:
+			log.Fatalf("Cloud provider %q is not yet supported.", cloudProvider)
+		}
+	},
+}
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	nodeCmd.AddCommand(nodeUpgradeCmd)
+
+	nodeUpgradeCmd.Flags().StringVar(&upgradeImage, "image", "", "Talos installer image to upgrade to, e.g. ghcr.io/siderolabs/installer:v1.9.5")
+	nodeUpgradeCmd.Flags().DurationVar(&upgradeTimeout, "timeout", 15*time.Minute, "How long to wait for each node to come back from its upgrade")
+	nodeUpgradeCmd.Flags().BoolVar(&upgradeForce, "force", false, "Upgrade nodes even if they already run the image's Talos version")
+}
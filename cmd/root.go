@@ -24,14 +24,50 @@ var machineConfigFile string
 //nolint:gochecknoglobals // Cobra boilerplate
 var machineConfigPatch string
 
+//nolint:gochecknoglobals // Cobra boilerplate
+var patchesDir string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var clusterConfigFile string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var talosconfigFile string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var kubeconfigFile string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var kubeContextName string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var skipIdentityCheck bool
+
 //nolint:gochecknoglobals // Cobra boilerplate
 var verbose bool
 
 //nolint:gochecknoglobals // Cobra boilerplate
 var secretPath string
 
+//nolint:gochecknoglobals // Cobra boilerplate
+var sopsDir string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var sopsAgeRecipients string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var dnsOwnerID string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var dnsTTL int
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var dnsProxied bool
+
 const cloudProviderAWS = "aws"
 
+// clusterFilesDirName is the directory in the home dir holding a directory of files, such as a kubeconfig and talosconfig, per cluster.
+const clusterFilesDirName = ".k8s-cluster-manager"
+
 // rootCmd represents the base command when called without any subcommands.
 //
 //nolint:gochecknoglobals // Cobra boilerplate
@@ -61,6 +97,17 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&nodeConfigFile, "nodeconfig", "", "", "Path to node config file")
 	rootCmd.PersistentFlags().StringVarP(&machineConfigFile, "machineconfig", "", "", "Path to talos machine config file")
 	rootCmd.PersistentFlags().StringVarP(&machineConfigPatch, "machineconfigpatch", "", "", "Path to talos machine config patch file")
+	rootCmd.PersistentFlags().StringVarP(&patchesDir, "patches-dir", "", os.Getenv("PATCHES_DIR"), "Directory of layered machine config patches: cluster/, roles/<role>/, purposes/<purpose>/, nodes/<node>/.  Applied after the patches in the secret.  (env PATCHES_DIR)")
+	rootCmd.PersistentFlags().StringVarP(&clusterConfigFile, "clusterconfig", "", "", "Path to cluster config file")
+	rootCmd.PersistentFlags().StringVarP(&talosconfigFile, "talosconfig", "", "", "Path to the cluster's talosconfig.  Defaults to the talosconfig in the secret, then ~/.k8s-cluster-manager/<cluster>/talosconfig, then the context named for the cluster in $TALOSCONFIG or ~/.talos/config.")
+	rootCmd.PersistentFlags().StringVarP(&kubeconfigFile, "kubeconfig", "", "", "Path to the cluster's kubeconfig.  Defaults to the kubeconfig in the secret, then ~/.k8s-cluster-manager/<cluster>/kubeconfig, then the context named for the cluster in $KUBECONFIG or ~/.kube/config.")
+	rootCmd.PersistentFlags().StringVarP(&kubeContextName, "kube-context", "", "", "Kubeconfig context to use.  Defaults to the kubeconfig's current context if the kubeconfig is the cluster's own, or the context named for the cluster otherwise.")
+	rootCmd.PersistentFlags().BoolVarP(&skipIdentityCheck, "skip-identity-check", "", false, "Don't check that the kubeconfig points at the named cluster before deleting, upgrading, or labelling nodes.")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().StringVarP(&secretPath, "secretmount", "m", "", "Vault path for secrets.")
+	rootCmd.PersistentFlags().StringVarP(&sopsDir, "sops-dir", "", os.Getenv("SOPS_DIR"), "Directory of SOPS encrypted secret files.  Used instead of Vault.  (env SOPS_DIR)")
+	rootCmd.PersistentFlags().StringVarP(&sopsAgeRecipients, "sops-age-recipients", "", os.Getenv("SOPS_AGE_RECIPIENTS"), "Comma separated age recipients to encrypt new SOPS files for.  Defaults to the creation rules in .sops.yaml.  (env SOPS_AGE_RECIPIENTS)")
+	rootCmd.PersistentFlags().StringVarP(&dnsOwnerID, "dns-owner-id", "", "", "Owner ID for DNS ownership TXT records.  Records not owned by this ID will not be deleted.")
+	rootCmd.PersistentFlags().IntVarP(&dnsTTL, "dns-ttl", "", 0, "TTL in seconds for DNS records.  0 means automatic.")
+	rootCmd.PersistentFlags().BoolVarP(&dnsProxied, "dns-proxied", "", false, "Proxy DNS records through Cloudflare.")
 }
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/go-homedir"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	"os"
+	"strings"
+)
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var vaultAuthMethod string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var vaultAuthMount string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var vaultRole string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var vaultRoleID string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var vaultSecretID string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var vaultJWTFile string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var vaultCACert string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var vaultNamespace string
+
+//nolint:gochecknoglobals // Cobra boilerplate
+var vaultSecretVersion int
+
+// sharedVaultClient is created once per run, so long running commands keep renewing a single token.
+//
+//nolint:gochecknoglobals // One vault login per process
+var sharedVaultClient *api.Client
+
+//nolint:gochecknoinits // Cobra boilerplate
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&vaultAuthMethod, "vault-auth", "", envOrDefault("VAULT_AUTH_METHOD", manager.VaultAuthToken), "Vault auth method: token, approle, kubernetes, or jwt.  (env VAULT_AUTH_METHOD)")
+	rootCmd.PersistentFlags().StringVarP(&vaultAuthMount, "vault-auth-mount", "", os.Getenv("VAULT_AUTH_MOUNT"), "Mount path of the vault auth method.  Defaults to the method name.  (env VAULT_AUTH_MOUNT)")
+	rootCmd.PersistentFlags().StringVarP(&vaultRole, "vault-role", "", os.Getenv("VAULT_ROLE"), "Vault role for kubernetes and jwt auth.  (env VAULT_ROLE)")
+	rootCmd.PersistentFlags().StringVarP(&vaultRoleID, "vault-role-id", "", os.Getenv("VAULT_ROLE_ID"), "Role ID for approle auth.  (env VAULT_ROLE_ID)")
+	rootCmd.PersistentFlags().StringVarP(&vaultSecretID, "vault-secret-id", "", os.Getenv("VAULT_SECRET_ID"), "Secret ID for approle auth.  (env VAULT_SECRET_ID)")
+	rootCmd.PersistentFlags().StringVarP(&vaultCACert, "vault-cacert", "", os.Getenv("VAULT_CACERT"), "PEM file with private CA certificates for verifying Vault.  (env VAULT_CACERT)")
+	rootCmd.PersistentFlags().StringVarP(&vaultNamespace, "vault-namespace", "", os.Getenv("VAULT_NAMESPACE"), "Vault Enterprise namespace.  (env VAULT_NAMESPACE)")
+	rootCmd.PersistentFlags().IntVarP(&vaultSecretVersion, "vault-version", "", 0, "Version of the KV v2 secret to read.  0 means the latest.")
+	rootCmd.PersistentFlags().StringVarP(&vaultJWTFile, "vault-jwt-file", "", os.Getenv("VAULT_JWT_FILE"), "File containing the JWT for jwt or kubernetes auth.  The JWT can also be given in env VAULT_JWT.  (env VAULT_JWT_FILE)")
+}
+
+// envOrDefault returns the value of the environment variable, or the default if it's not set.
+func envOrDefault(envVar string, defaultValue string) (value string) {
+	value = os.Getenv(envVar)
+	if value == "" {
+		value = defaultValue
+	}
+
+	return value
+}
+
+// vaultAuthConfig assembles the vault auth config from flags and environment.
+func vaultAuthConfig() (auth manager.VaultAuthConfig, err error) {
+	auth = manager.VaultAuthConfig{
+		Method:    vaultAuthMethod,
+		MountPath: vaultAuthMount,
+		Role:      vaultRole,
+		RoleID:    vaultRoleID,
+		SecretID:  vaultSecretID,
+		JWT:       os.Getenv("VAULT_JWT"),
+	}
+
+	switch vaultAuthMethod {
+	case manager.VaultAuthToken, "":
+		auth.Token = os.Getenv("VAULT_TOKEN")
+		if auth.Token != "" {
+			return auth, err
+		}
+
+		hd, hdErr := homedir.Dir()
+		if hdErr != nil {
+			err = errors.Wrapf(hdErr, "unable to look up homedir")
+			return auth, err
+		}
+
+		tokenFile := fmt.Sprintf("%s/.vault-token", hd)
+
+		tokBytes, tokErr := os.ReadFile(tokenFile)
+		if tokErr != nil {
+			err = errors.Wrapf(tokErr, "No vault token found at %s", tokenFile)
+			return auth, err
+		}
+
+		auth.Token = strings.TrimRight(string(tokBytes), "\n")
+
+	case manager.VaultAuthAppRole:
+		if auth.RoleID == "" || auth.SecretID == "" {
+			err = errors.New("approle auth requires --vault-role-id and --vault-secret-id")
+			return auth, err
+		}
+
+	case manager.VaultAuthKubernetes, manager.VaultAuthJWT:
+		if auth.Role == "" {
+			err = errors.Errorf("%s auth requires --vault-role", vaultAuthMethod)
+			return auth, err
+		}
+
+		if vaultJWTFile != "" {
+			jwtBytes, jwtErr := os.ReadFile(vaultJWTFile)
+			if jwtErr != nil {
+				err = errors.Wrapf(jwtErr, "failed reading JWT from %s", vaultJWTFile)
+				return auth, err
+			}
+
+			auth.JWT = strings.TrimSpace(string(jwtBytes))
+		}
+
+		if vaultAuthMethod == manager.VaultAuthJWT && auth.JWT == "" {
+			err = errors.New("jwt auth requires --vault-jwt-file or VAULT_JWT")
+			return auth, err
+		}
+
+	default:
+		err = errors.Errorf("unsupported vault auth method %q", vaultAuthMethod)
+		return auth, err
+	}
+
+	return auth, err
+}
+
+// vaultClient returns the logged in vault client, creating it on first use.  The token is renewed in the background for as long as the process runs.
+func vaultClient() (client *api.Client, err error) {
+	if sharedVaultClient != nil {
+		client = sharedVaultClient
+		return client, err
+	}
+
+	auth, authErr := vaultAuthConfig()
+	if authErr != nil {
+		err = authErr
+		return client, err
+	}
+
+	clientConfig := manager.VaultClientConfig{
+		CACert:    vaultCACert,
+		Namespace: vaultNamespace,
+	}
+
+	client, err = manager.NewVaultClient(clientConfig, auth, verbose)
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating vault client")
+		return client, err
+	}
+
+	go manager.KeepVaultTokenAlive(context.Background(), client, auth, verbose)
+
+	sharedVaultClient = client
+
+	return client, err
+}
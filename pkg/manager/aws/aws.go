@@ -5,20 +5,17 @@ import (
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/elasticloadbalancingv2"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	k8s_utility_client "github.com/nikogura/k8s-utility-client/pkg/k8s-utility-client"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"math/rand"
 	"os"
 	"regexp"
-	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
-	"strconv"
+	"time"
 )
 
 //nolint:gochecknoinits // Package-level initialization required
@@ -66,68 +63,33 @@ type AWSClusterManager struct {
 	ELBClient          ELBClient
 	Context            context.Context
 	Profile            string
-	KubeClient         client.Client
-	FetchedNodesById   map[string]manager.NodeInfo //nolint:staticcheck // Changing to FetchedNodesByID would break API
+	KubeClient         client.Client                  // Set with SetKubeClients.
+	K8sClients         *k8s_utility_client.K8sClients // Set with SetKubeClients.  Nil if there's no kubeconfig for the cluster.
+	FetchedNodesById   map[string]manager.NodeInfo    //nolint:staticcheck // Changing to FetchedNodesByID would break API
 	FetchedNodesByName map[string]manager.NodeInfo
 	ClusterNameRegex   *regexp.Regexp
 	CostEstimator      manager.CostEstimator // Optional: if provided, enables cost estimation
+	ClusterConfig      manager.ClusterConfig // Optional: cluster wide settings such as DNS names for the load balancers
+	Talosconfig        []byte                // Optional: talosconfig for the cluster.  Needed to talk to nodes once they've joined.
+	GracefulReset      bool                  // Optional: reset nodes through the Talos API before terminating them.
+	ResetTimeout       time.Duration         // How long to wait for a reset before terminating anyway.
+	SkipIdentityCheck  bool                  // Optional: don't check the kubeconfig points at this cluster before destructive steps.
+	identityVerified   bool
 }
 
-func NewAWSClusterManager(ctx context.Context, clusterName string, profile string, role string, dnsManager manager.DNSManager, verbose bool) (am *AWSClusterManager, err error) {
+func NewAWSClusterManager(ctx context.Context, clusterName string, creds AWSCredentialsConfig, dnsManager manager.DNSManager, verbose bool) (am *AWSClusterManager, err error) {
 	_ = log.FromContext(ctx)
-	var cfg aws.Config
 
-	// if we are supplied a profile, use it to set up the aws config
-	if profile != "" {
-		cfg, err = config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile(profile))
-		if err != nil {
-			err = errors.Wrapf(err, "failed creating aws config with shared profile")
-			return am, err
-		}
-	} else { // if not, use the defaults
-		cfg, err = config.LoadDefaultConfig(ctx)
-		if err != nil {
-			err = errors.Wrapf(err, "failed creating aws config")
-			return am, err
-		}
-	}
-
-	// If we have a role to assume, assume it
-	if role != "" {
-		sourceAccount := sts.NewFromConfig(cfg)
-
-		assumeRoleInput := &sts.AssumeRoleInput{
-			RoleArn:         aws.String(role),
-			RoleSessionName: aws.String("k8s-cluster-manager-" + strconv.Itoa(10000+rand.Intn(25000))),
-		}
-
-		// Assume the role
-		stsResp, stsErr := sourceAccount.AssumeRole(ctx, assumeRoleInput)
-		if stsErr != nil {
-			err = errors.Wrapf(stsErr, "failed assuming role %s", role)
-			return am, err
-		}
-
-		// pull the creds out of the role assumption response, and use that to make a new config
-		cfgTemp, cfgErr := config.LoadDefaultConfig(ctx, config.WithRegion(os.Getenv("AWS_REGION")), config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(*stsResp.Credentials.AccessKeyId, *stsResp.Credentials.SecretAccessKey, *stsResp.Credentials.SessionToken)))
-		if cfgErr != nil {
-			err = errors.Wrapf(cfgErr, "failed assuming role %s", role)
-			return am, err
-		}
-		cfg = cfgTemp
+	cfg, cfgErr := NewAWSConfig(ctx, creds)
+	if cfgErr != nil {
+		err = cfgErr
+		return am, err
 	}
 
 	// Create AWS clients
 	ec2Client := ec2.NewFromConfig(cfg)
 	elbClient := elasticloadbalancingv2.NewFromConfig(cfg)
 
-	// Create k8s clients
-	kubeClient, kubeErr := client.New(ctrl.GetConfigOrDie(), client.Options{})
-	if kubeErr != nil {
-		err = errors.Wrapf(kubeErr, "failed creating k8s clients")
-		return am, err
-	}
-
 	re, reErr := regexp.Compile(fmt.Sprintf(".*%s.*", clusterName))
 	if reErr != nil {
 		err = errors.Wrapf(reErr, "cluster name %s doesn't compile into a regex", clusterName)
@@ -144,8 +106,7 @@ func NewAWSClusterManager(ctx context.Context, clusterName string, profile strin
 		Ec2Client:          ec2Client,
 		ELBClient:          elbClient,
 		Context:            ctx,
-		Profile:            profile,
-		KubeClient:         kubeClient,
+		Profile:            creds.Profile,
 		FetchedNodesById:   make(map[string]manager.NodeInfo, 0),
 		FetchedNodesByName: make(map[string]manager.NodeInfo, 0),
 		ClusterNameRegex:   re,
@@ -154,6 +115,98 @@ func NewAWSClusterManager(ctx context.Context, clusterName string, profile strin
 	return am, err
 }
 
+// SetKubeClients points the cluster manager at the cluster's Kubernetes apiserver.  The clients come from the cluster's own kubeconfig, never from whatever the current kube context happens to be.
+func (am *AWSClusterManager) SetKubeClients(clients *k8s_utility_client.K8sClients) (err error) {
+	am.K8sClients = clients
+
+	if clients == nil {
+		am.KubeClient = nil
+		return err
+	}
+
+	am.KubeClient, err = client.New(clients.K8SConfig, client.Options{})
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating k8s client")
+		return err
+	}
+
+	return err
+}
+
+// NewAWSConfig creates the AWS config for the given credentials.
+func NewAWSConfig(ctx context.Context, creds AWSCredentialsConfig) (cfg aws.Config, err error) {
+	profile := creds.Profile
+	role := creds.Role
+
+	var loadOptions []func(*config.LoadOptions) error
+
+	// if we are supplied a profile, use it to set up the aws config
+	if profile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(profile))
+	}
+
+	// Credentials from a provider, such as Vault, take the place of whatever the profile or the defaults would supply.
+	if creds.Provider != nil {
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(NewCredentialsCache(creds.Provider)))
+	}
+
+	cfg, err = config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating aws config")
+		return cfg, err
+	}
+
+	// If we have roles to assume, assume them.  The assumed credentials are cached, and refreshed before they expire.
+	roles := RoleChain(role)
+	if len(roles) > 0 {
+		cfg.Credentials = AssumeRoleProvider(cfg, creds, roles)
+
+		// Fail now rather than on the first API call.
+		_, assumeErr := cfg.Credentials.Retrieve(ctx)
+		if assumeErr != nil {
+			err = errors.Wrapf(assumeErr, "failed assuming role %s", role)
+			return cfg, err
+		}
+	}
+
+	return cfg, err
+}
+
+// APIServerHost looks up the DNS name of the cluster's apiserver load balancer.  It needs no kubeconfig, so it works before the cluster is up.
+func APIServerHost(ctx context.Context, clusterName string, creds AWSCredentialsConfig) (host string, err error) {
+	cfg, cfgErr := NewAWSConfig(ctx, creds)
+	if cfgErr != nil {
+		err = cfgErr
+		return host, err
+	}
+
+	lbName, lbNameErr := LoadBalancerName(clusterName, manager.LBTypeAPIServer)
+	if lbNameErr != nil {
+		err = lbNameErr
+		return host, err
+	}
+
+	am := &AWSClusterManager{
+		Context:   ctx,
+		ELBClient: elasticloadbalancingv2.NewFromConfig(cfg),
+	}
+
+	lbOutput, lbErr := am.GetLB(lbName)
+	if lbErr != nil {
+		err = lbErr
+		return host, err
+	}
+
+	if len(lbOutput.LoadBalancers) == 0 {
+		err = errors.Errorf("load balancer %s not found", lbName)
+		return host, err
+	}
+
+	host = aws.ToString(lbOutput.LoadBalancers[0].DNSName)
+
+	return host, err
+}
+
 func (am *AWSClusterManager) ClusterName() (name string) {
 	name = am.Name
 	return name
@@ -235,6 +288,17 @@ func (am *AWSClusterManager) DescribeCluster(clusterName string) (info manager.C
 
 	info.LoadBalancers = lbs
 
+	// Get the cluster level DNS records if any are configured
+	if !am.ClusterConfig.DNS.Empty() {
+		records, recordsErr := am.ClusterRecords(lbs)
+		if recordsErr != nil {
+			// Log warning but don't fail the entire describe operation
+			manager.VerboseOutput(am.Verbose, "Warning: failed to look up cluster dns records: %v", recordsErr)
+		} else {
+			info.DNSRecords = records
+		}
+	}
+
 	// Calculate total cluster cost if estimator is available
 	if am.CostEstimator != nil {
 		totalCost, costErr := CalculateClusterDailyCost(info.Nodes, am.CostEstimator)
@@ -55,7 +55,7 @@ func setUp() {
 
 	dnsManager := manager.DNSManagerStruct{}
 
-	cm, err := NewAWSClusterManager(ctx, clusterName, awsProfile, dnsManager, true)
+	cm, err := NewAWSClusterManager(ctx, clusterName, AWSCredentialsConfig{Profile: awsProfile}, dnsManager, true)
 	if err != nil {
 		log.Fatalf("couldn't create aws cluster manager: %s", err)
 	}
@@ -0,0 +1,192 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/kubernetes"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/talos"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// CheckBootstrapNodes makes sure a cluster is new enough to bootstrap with the named node: it may have no running instances but that node.  resume is set if the node already exists, from an earlier bootstrap that didn't finish.  Instances without an IP have been terminated, and don't count.
+func CheckBootstrapNodes(nodes []manager.NodeInfo, nodeName string) (resume bool, err error) {
+	others := make([]string, 0)
+
+	for _, node := range nodes {
+		if node.IP == "" {
+			continue
+		}
+
+		if node.Name == nodeName {
+			resume = true
+			continue
+		}
+
+		others = append(others, node.Name)
+	}
+
+	if len(others) > 0 {
+		err = errors.Errorf("cluster already has nodes: %s.  Bootstrap is only for new clusters", strings.Join(others, ", "))
+		return resume, err
+	}
+
+	return resume, err
+}
+
+// BootstrapCluster brings up a new cluster: it creates the first control plane node, bootstraps etcd on it, waits for etcd and for the apiserver behind the apiserver load balancer, records the cluster's name in it, and returns an admin kubeconfig.  timeout applies to each wait.
+//
+// If the node already exists from an earlier attempt it isn't created again, but it gets its config if it's still in maintenance mode, and is registered with the load balancers and DNS again.  If etcd is already bootstrapped on it that's not done again either, so an interrupted bootstrap can be run again.
+func (am *AWSClusterManager) BootstrapCluster(nodeName string, config AWSNodeConfig, machineConfigBytes []byte, machineConfigPatches []string, timeout time.Duration) (kubeconfig []byte, err error) {
+	if len(am.Talosconfig) == 0 {
+		err = errors.New("bootstrapping a cluster needs a talosconfig")
+		return kubeconfig, err
+	}
+
+	nodes, nodesErr := am.GetNodes(am.Name)
+	if nodesErr != nil {
+		err = errors.Wrapf(nodesErr, "failed getting nodes for cluster %s", am.Name)
+		return kubeconfig, err
+	}
+
+	resume, checkErr := CheckBootstrapNodes(nodes, nodeName)
+	if checkErr != nil {
+		err = checkErr
+		return kubeconfig, err
+	}
+
+	if resume {
+		fmt.Printf("Node %s already exists.  Resuming bootstrap.\n", nodeName)
+	} else {
+		createErr := am.CreateNode(nodeName, manager.NodeRoleCp, config, machineConfigBytes, machineConfigPatches, "")
+		if createErr != nil {
+			err = errors.Wrapf(createErr, "failed creating first control plane node %s", nodeName)
+			return kubeconfig, err
+		}
+	}
+
+	nodeInfo, getErr := am.GetNode(nodeName)
+	if getErr != nil {
+		err = errors.Wrapf(getErr, "failed getting node %s", nodeName)
+		return kubeconfig, err
+	}
+
+	if nodeInfo.IP == "" {
+		err = errors.Errorf("no running instance found for node %s", nodeName)
+		return kubeconfig, err
+	}
+
+	if resume {
+		err = am.resumeBootstrapNode(nodeInfo, config, machineConfigBytes, machineConfigPatches, timeout)
+		if err != nil {
+			return kubeconfig, err
+		}
+	}
+
+	// The node installs Talos and reboots with its config before it will answer with the talosconfig.
+	err = talos.WaitForAPI(am.Context, am.Talosconfig, nodeInfo.IP, timeout, am.Verbose)
+	if err != nil {
+		return kubeconfig, err
+	}
+
+	already, bootstrapErr := talos.Bootstrap(am.Context, am.Talosconfig, nodeInfo.IP, am.Verbose)
+	if bootstrapErr != nil {
+		err = bootstrapErr
+		return kubeconfig, err
+	}
+
+	if already {
+		fmt.Printf("etcd was already bootstrapped on node %s\n", nodeName)
+	} else {
+		fmt.Printf("Bootstrapped etcd on node %s\n", nodeName)
+	}
+
+	err = talos.WaitForEtcdMember(am.Context, am.Talosconfig, []string{nodeInfo.IP}, nodeName, timeout, am.Verbose)
+	if err != nil {
+		return kubeconfig, err
+	}
+
+	fmt.Printf("etcd is up on node %s\n", nodeName)
+
+	kubeconfig, err = talos.WaitForKubeconfig(am.Context, am.Talosconfig, nodeInfo.IP, timeout, am.Verbose)
+	if err != nil {
+		return kubeconfig, err
+	}
+
+	// The kubeconfig points at the cluster endpoint the configs were generated with, which is the apiserver load balancer.
+	server, serverErr := kubernetes.KubeconfigServer(kubeconfig)
+	if serverErr != nil {
+		err = serverErr
+		return kubeconfig, err
+	}
+
+	err = kubernetes.WaitForAPIServer(am.Context, kubeconfig, timeout, am.Verbose)
+	if err != nil {
+		return kubeconfig, err
+	}
+
+	fmt.Printf("Apiserver is up at %s\n", server)
+
+	// Stamp the cluster with its name, so later commands can tell its kubeconfig from another cluster's.
+	clients, clientsErr := kubernetes.NewClients(kubeconfig, "")
+	if clientsErr != nil {
+		err = clientsErr
+		return kubeconfig, err
+	}
+
+	err = kubernetes.WriteClusterIdentity(am.Context, clients, am.Name, am.Verbose)
+	if err != nil {
+		return kubeconfig, err
+	}
+
+	return kubeconfig, err
+}
+
+// resumeBootstrapNode finishes what CreateNode may not have, for a first control plane node left by an interrupted bootstrap.  A node still in maintenance mode never got its config, so it's applied again.  Load balancer and DNS registration are repeatable, so they're always done.
+func (am *AWSClusterManager) resumeBootstrapNode(nodeInfo manager.NodeInfo, config AWSNodeConfig, machineConfigBytes []byte, machineConfigPatches []string, timeout time.Duration) (err error) {
+	node := AWSNode{
+		NodeName:   nodeInfo.Name,
+		IPAddress:  nodeInfo.IP,
+		NodeRole:   manager.NodeRoleCp,
+		NodeID:     nodeInfo.ID,
+		Config:     &config,
+		NodeDomain: config.Domain,
+	}
+
+	maintenance, bootErr := talos.WaitForBoot(am.Context, am.Talosconfig, nodeInfo.IP, timeout, am.Verbose)
+	if bootErr != nil {
+		err = bootErr
+		return err
+	}
+
+	if maintenance {
+		fmt.Printf("Node %s is in maintenance mode.  Applying its config.\n", nodeInfo.Name)
+
+		patches, patchErr := am.withInstancePatch(nodeInfo, machineConfigPatches)
+		if patchErr != nil {
+			err = patchErr
+			return err
+		}
+
+		_, applyErr := talos.ApplyConfig(am.Context, &node, machineConfigBytes, patches, nil, true, talos.ApplyModeAuto, 0, am.GetVerbose())
+		if applyErr != nil {
+			err = errors.Wrapf(applyErr, "failed applying machine config to %s", nodeInfo.Name)
+			return err
+		}
+	}
+
+	err = am.RegisterNode(node)
+	if err != nil {
+		err = errors.Wrapf(err, "failed registering %s", nodeInfo.Name)
+		return err
+	}
+
+	err = am.DnsManager.RegisterNode(am.Context, node, am.GetVerbose())
+	if err != nil {
+		err = errors.Wrapf(err, "failed registering dns for %s", nodeInfo.Name)
+		return err
+	}
+
+	return err
+}
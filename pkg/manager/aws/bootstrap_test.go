@@ -0,0 +1,57 @@
+package aws
+
+import (
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheckBootstrapNodes(t *testing.T) {
+	cases := []struct {
+		name    string
+		nodes   []manager.NodeInfo
+		resume  bool
+		errored bool
+	}{
+		{
+			name:  "new cluster",
+			nodes: []manager.NodeInfo{},
+		},
+		{
+			name: "first node already created",
+			nodes: []manager.NodeInfo{
+				{Name: "prod-cp-1", ID: "i-1", IP: "10.0.1.10"},
+			},
+			resume: true,
+		},
+		{
+			name: "terminated instances ignored",
+			nodes: []manager.NodeInfo{
+				{Name: "prod-cp-2", ID: "i-2"},
+				{Name: "prod-worker-1", ID: "i-3"},
+			},
+		},
+		{
+			name: "existing cluster",
+			nodes: []manager.NodeInfo{
+				{Name: "prod-cp-1", ID: "i-1", IP: "10.0.1.10"},
+				{Name: "prod-worker-1", ID: "i-3", IP: "10.0.1.20"},
+			},
+			resume:  true,
+			errored: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resume, err := CheckBootstrapNodes(tc.nodes, "prod-cp-1")
+			if tc.errored {
+				assert.Error(t, err, "expected an error")
+			} else {
+				assert.NoError(t, err, "unexpected error")
+			}
+
+			assert.Equal(t, tc.resume, resume, "resume does not meet expectations")
+		})
+	}
+}
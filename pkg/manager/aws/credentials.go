@@ -0,0 +1,249 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/hashicorp/vault/api"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultVaultAWSMount is where Vault's AWS secrets engine is usually mounted.
+const DefaultVaultAWSMount = "aws"
+
+// CredentialsExpiryWindow is how long before they expire cached credentials are refreshed, so a request signed just before the expiry doesn't reach AWS just after it.
+const CredentialsExpiryWindow = 2 * time.Minute
+
+// MFASessionDuration is the session length used with MFA when none is given, so the code is asked for again as seldom as AWS allows by default.
+const MFASessionDuration = time.Hour
+
+// AWSCredentialsConfig says where the cluster manager gets its AWS credentials.
+type AWSCredentialsConfig struct {
+	Profile  string                  // Shared config profile.  Empty uses the default credential chain.
+	Role     string                  // Role ARN to assume.  A comma separated list of ARNs is assumed in order, each with the credentials of the one before.
+	Provider aws.CredentialsProvider // Optional: source credentials used instead of the profile or default chain, e.g. a VaultCredentialsProvider.
+
+	ExternalID      string        // Optional: external ID passed when assuming roles.
+	MFASerial       string        // Optional: MFA device serial or ARN.  The code is read from stdin, which must be a terminal, whenever the first role is assumed.
+	SessionDuration time.Duration // Optional: duration of assumed role sessions.  0 uses the STS default of 15 minutes, or MFASessionDuration with MFA.
+}
+
+// RoleChain splits a comma separated list of role ARNs.
+func RoleChain(role string) (roles []string) {
+	roles = make([]string, 0)
+
+	for _, r := range strings.Split(role, ",") {
+		r = strings.TrimSpace(r)
+		if r != "" {
+			roles = append(roles, r)
+		}
+	}
+
+	return roles
+}
+
+// AssumeRoleProvider returns a provider that assumes each of roles in turn, starting from the credentials in cfg.  Each step is cached and refreshed before it expires, so long running commands keep working.
+func AssumeRoleProvider(cfg aws.Config, creds AWSCredentialsConfig, roles []string) (provider aws.CredentialsProvider) {
+	provider = cfg.Credentials
+
+	for i, role := range roles {
+		hopConfig := cfg.Copy()
+		hopConfig.Credentials = provider
+
+		stsClient := sts.NewFromConfig(hopConfig)
+
+		// MFA codes can only be used once, so MFA applies to the first role only.
+		first := i == 0
+
+		assumeProvider := stscreds.NewAssumeRoleProvider(stsClient, role, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "k8s-cluster-manager-" + strconv.Itoa(10000+rand.Intn(25000))
+
+			if creds.ExternalID != "" {
+				o.ExternalID = aws.String(creds.ExternalID)
+			}
+
+			if creds.SessionDuration > 0 {
+				o.Duration = creds.SessionDuration
+			}
+
+			if first && creds.MFASerial != "" {
+				o.SerialNumber = aws.String(creds.MFASerial)
+				o.TokenProvider = MFATokenProvider
+
+				// Every refresh asks for a new code, so make them few.
+				if creds.SessionDuration <= 0 {
+					o.Duration = MFASessionDuration
+				}
+			}
+		})
+
+		provider = NewCredentialsCache(assumeProvider)
+	}
+
+	return provider
+}
+
+// MFATokenProvider reads an MFA code from stdin.  It fails at once if stdin isn't a terminal, rather than waiting for a code nobody will type, e.g. when credentials are refreshed in a command run by a scheduler.
+func MFATokenProvider() (code string, err error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		err = errors.New("an MFA code is needed to assume the role, but stdin is not a terminal to ask for it on.  Use credentials that don't need MFA")
+		return code, err
+	}
+
+	code, err = stscreds.StdinTokenProvider()
+
+	return code, err
+}
+
+// NewCredentialsCache caches the provider's credentials, refreshing them CredentialsExpiryWindow before they expire.
+func NewCredentialsCache(provider aws.CredentialsProvider) (cache *aws.CredentialsCache) {
+	cache = aws.NewCredentialsCache(provider, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = CredentialsExpiryWindow
+	})
+
+	return cache
+}
+
+// VaultCredentialsProvider gets AWS credentials from Vault's AWS secrets engine.  Wrap it in an aws.CredentialsCache, which calls Retrieve again shortly before the credentials expire.
+type VaultCredentialsProvider struct {
+	Client  *api.Client
+	Mount   string // Mount of the AWS secrets engine.  Defaults to "aws".
+	Role    string // Vault role to get credentials for.
+	STS     bool   // Read aws/sts/<role> rather than aws/creds/<role>.
+	TTL     string // Optional: requested TTL, e.g. "1h".
+	Verbose bool
+
+	mu    *sync.Mutex
+	lease *api.Secret
+}
+
+// NewVaultCredentialsProvider creates a provider for the given Vault role.
+func NewVaultCredentialsProvider(client *api.Client, mount string, role string, sts bool, ttl string, verbose bool) (provider *VaultCredentialsProvider) {
+	if mount == "" {
+		mount = DefaultVaultAWSMount
+	}
+
+	provider = &VaultCredentialsProvider{
+		Client:  client,
+		Mount:   strings.Trim(mount, "/"),
+		Role:    role,
+		STS:     sts,
+		TTL:     ttl,
+		Verbose: verbose,
+		mu:      &sync.Mutex{},
+	}
+
+	return provider
+}
+
+// Retrieve returns AWS credentials from Vault.  A renewable lease from an earlier call is renewed, which extends the same credentials.  Otherwise new credentials are issued.
+func (p *VaultCredentialsProvider) Retrieve(ctx context.Context) (creds aws.Credentials, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.lease != nil && p.lease.Renewable && p.lease.LeaseID != "" {
+		renewed, renewErr := p.Client.Sys().RenewWithContext(ctx, p.lease.LeaseID, p.lease.LeaseDuration)
+		if renewErr == nil && renewed != nil && renewed.LeaseDuration > 0 {
+			manager.VerboseOutput(p.Verbose, "Renewed vault lease %s for %ds", p.lease.LeaseID, renewed.LeaseDuration)
+
+			// Renewal responses carry no data, so keep the credentials from the original secret.
+			p.lease.LeaseDuration = renewed.LeaseDuration
+			creds, err = VaultSecretCredentials(p.lease, time.Now())
+			return creds, err
+		}
+
+		manager.VerboseOutput(p.Verbose, "Failed renewing vault lease %s.  Requesting new credentials.  (%v)", p.lease.LeaseID, renewErr)
+	}
+
+	path := p.Path()
+
+	manager.VerboseOutput(p.Verbose, "Requesting AWS credentials from vault at %s", path)
+
+	var secret *api.Secret
+	var readErr error
+
+	if p.STS {
+		data := map[string]interface{}{}
+		if p.TTL != "" {
+			data["ttl"] = p.TTL
+		}
+
+		// aws/sts accepts both, but a write lets us pass a ttl.
+		secret, readErr = p.Client.Logical().WriteWithContext(ctx, path, data)
+	} else {
+		var query map[string][]string
+		if p.TTL != "" {
+			query = map[string][]string{"ttl": {p.TTL}}
+		}
+
+		secret, readErr = p.Client.Logical().ReadWithDataWithContext(ctx, path, query)
+	}
+
+	if readErr != nil {
+		err = errors.Wrapf(readErr, "failed reading AWS credentials from vault at %s", path)
+		return creds, err
+	}
+
+	creds, err = VaultSecretCredentials(secret, time.Now())
+	if err != nil {
+		err = errors.Wrapf(err, "bad AWS credentials from vault at %s", path)
+		return creds, err
+	}
+
+	p.lease = secret
+
+	return creds, err
+}
+
+// Path is the vault path credentials are read from.
+func (p *VaultCredentialsProvider) Path() (path string) {
+	kind := "creds"
+	if p.STS {
+		kind = "sts"
+	}
+
+	path = fmt.Sprintf("%s/%s/%s", p.Mount, kind, p.Role)
+
+	return path
+}
+
+// VaultSecretCredentials converts a secret from Vault's AWS secrets engine into AWS credentials that expire with the secret's lease.
+func VaultSecretCredentials(secret *api.Secret, now time.Time) (creds aws.Credentials, err error) {
+	if secret == nil || secret.Data == nil {
+		err = errors.New("no secret returned")
+		return creds, err
+	}
+
+	accessKey, _ := secret.Data["access_key"].(string)
+	secretKey, _ := secret.Data["secret_key"].(string)
+	sessionToken, _ := secret.Data["security_token"].(string)
+
+	if accessKey == "" || secretKey == "" {
+		err = errors.New("secret has no access_key or secret_key")
+		return creds, err
+	}
+
+	creds = aws.Credentials{
+		AccessKeyID:     accessKey,
+		SecretAccessKey: secretKey,
+		SessionToken:    sessionToken,
+		Source:          "VaultCredentialsProvider",
+	}
+
+	if secret.LeaseDuration > 0 {
+		creds.CanExpire = true
+		creds.Expires = now.Add(time.Duration(secret.LeaseDuration) * time.Second)
+	}
+
+	return creds, err
+}
@@ -0,0 +1,122 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestVaultSecretCredentials(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		secret   *api.Secret
+		expected aws.Credentials
+		errs     bool
+	}{
+		{
+			"iam user",
+			&api.Secret{
+				LeaseID:       "aws/creds/deploy/abc",
+				LeaseDuration: 3600,
+				Renewable:     true,
+				Data: map[string]interface{}{
+					"access_key":     "AKIAEXAMPLE",
+					"secret_key":     "secret",
+					"security_token": nil,
+				},
+			},
+			aws.Credentials{
+				AccessKeyID:     "AKIAEXAMPLE",
+				SecretAccessKey: "secret",
+				Source:          "VaultCredentialsProvider",
+				CanExpire:       true,
+				Expires:         now.Add(time.Hour),
+			},
+			false,
+		},
+		{
+			"sts",
+			&api.Secret{
+				LeaseDuration: 900,
+				Data: map[string]interface{}{
+					"access_key":     "ASIAEXAMPLE",
+					"secret_key":     "secret",
+					"security_token": "token",
+				},
+			},
+			aws.Credentials{
+				AccessKeyID:     "ASIAEXAMPLE",
+				SecretAccessKey: "secret",
+				SessionToken:    "token",
+				Source:          "VaultCredentialsProvider",
+				CanExpire:       true,
+				Expires:         now.Add(15 * time.Minute),
+			},
+			false,
+		},
+		{
+			"missing keys",
+			&api.Secret{Data: map[string]interface{}{"access_key": "AKIAEXAMPLE"}},
+			aws.Credentials{},
+			true,
+		},
+		{
+			"nil",
+			nil,
+			aws.Credentials{},
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := VaultSecretCredentials(tc.secret, now)
+			if tc.errs {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual, "credentials do not meet expectations")
+		})
+	}
+}
+
+func TestVaultCredentialsProviderPath(t *testing.T) {
+	assert.Equal(t, "aws/creds/deploy", NewVaultCredentialsProvider(nil, "", "deploy", false, "", false).Path())
+	assert.Equal(t, "aws-prod/sts/deploy", NewVaultCredentialsProvider(nil, "/aws-prod/", "deploy", true, "", false).Path())
+}
+
+func TestRoleChain(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			"none",
+			"",
+			[]string{},
+		},
+		{
+			"single",
+			"arn:aws:iam::111111111111:role/admin",
+			[]string{"arn:aws:iam::111111111111:role/admin"},
+		},
+		{
+			"chain",
+			"arn:aws:iam::111111111111:role/hop, arn:aws:iam::222222222222:role/admin,",
+			[]string{"arn:aws:iam::111111111111:role/hop", "arn:aws:iam::222222222222:role/admin"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, RoleChain(tc.input), "role chain does not meet expectations")
+		})
+	}
+}
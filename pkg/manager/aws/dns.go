@@ -0,0 +1,87 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+)
+
+// LBType returns the kind of cluster load balancer (apiserver, int, or ext) based on its name, or an empty string if it's not one of ours.
+func LBType(clusterName string, lbName string) (lbType string) {
+	for _, t := range []string{manager.LBTypeAPIServer, manager.LBTypeIngressInt, manager.LBTypeIngressExt} {
+		name, nameErr := LoadBalancerName(clusterName, t)
+		if nameErr != nil {
+			continue
+		}
+
+		if name == lbName {
+			lbType = t
+			return lbType
+		}
+	}
+
+	return lbType
+}
+
+// ClusterRecords returns the configured cluster level DNS records for the given load balancers, along with what they currently point at.
+func (am *AWSClusterManager) ClusterRecords(lbs []manager.LBInfo) (records []manager.ClusterRecord, err error) {
+	records = make([]manager.ClusterRecord, 0)
+
+	for _, lb := range lbs {
+		lbType := LBType(am.ClusterName(), lb.Name)
+		if lbType == "" {
+			continue
+		}
+
+		name := am.ClusterConfig.DNS.NameFor(lbType)
+		if name == "" || lb.DNSName == "" {
+			continue
+		}
+
+		current, lookupErr := am.DnsManager.LookupAlias(am.Context, name, am.GetVerbose())
+		if lookupErr != nil {
+			err = errors.Wrapf(lookupErr, "failed looking up dns record %s", name)
+			return records, err
+		}
+
+		records = append(records, manager.ClusterRecord{
+			Name:    name,
+			LBType:  lbType,
+			LBName:  lb.Name,
+			Target:  lb.DNSName,
+			Current: current,
+		})
+	}
+
+	return records, err
+}
+
+// SyncClusterRecords points any missing or out of date cluster level DNS records at their load balancers.  Returns the records as they were found.
+func (am *AWSClusterManager) SyncClusterRecords() (records []manager.ClusterRecord, err error) {
+	lbs, lbsErr := am.GetClusterLBs()
+	if lbsErr != nil {
+		err = errors.Wrapf(lbsErr, "failed getting cluster LB's")
+		return records, err
+	}
+
+	records, err = am.ClusterRecords(lbs)
+	if err != nil {
+		return records, err
+	}
+
+	for _, record := range records {
+		if record.InSync() {
+			continue
+		}
+
+		fmt.Printf("Pointing %s at %s (%s)\n", record.Name, record.Target, record.LBName)
+
+		upsertErr := am.DnsManager.UpsertAlias(am.Context, record.Name, record.Target, am.GetVerbose())
+		if upsertErr != nil {
+			err = errors.Wrapf(upsertErr, "failed setting dns record %s", record.Name)
+			return records, err
+		}
+	}
+
+	return records, err
+}
@@ -0,0 +1,68 @@
+package aws
+
+import (
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLBType(t *testing.T) {
+	cases := []struct {
+		lbName   string
+		expected string
+	}{
+		{"apiserver-foo", manager.LBTypeAPIServer},
+		{"ingress-foo", manager.LBTypeIngressInt},
+		{"ingress-foo-ext", manager.LBTypeIngressExt},
+		{"ingress-foobar", ""},
+		{"something-else", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.lbName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, LBType("foo", tc.lbName), "lb type does not meet expectations")
+		})
+	}
+}
+
+func TestClusterRecords(t *testing.T) {
+	acm := AWSClusterManager{
+		Name:       "foo",
+		DnsManager: manager.DNSManagerStruct{},
+		ClusterConfig: manager.ClusterConfig{
+			DNS: manager.ClusterDNSConfig{
+				APIServer:  "api.foo.example.com",
+				IngressInt: "ingress.foo.example.com",
+			},
+		},
+	}
+
+	lbs := []manager.LBInfo{
+		{Name: "apiserver-foo", DNSName: "apiserver-foo-123.elb.us-east-1.amazonaws.com", IsAPIServer: true},
+		{Name: "ingress-foo", DNSName: "ingress-foo-456.elb.us-east-1.amazonaws.com"},
+		{Name: "ingress-foo-ext", DNSName: "ingress-foo-ext-789.elb.us-east-1.amazonaws.com"}, // no name configured
+	}
+
+	expected := []manager.ClusterRecord{
+		{
+			Name:   "api.foo.example.com",
+			LBType: manager.LBTypeAPIServer,
+			LBName: "apiserver-foo",
+			Target: "apiserver-foo-123.elb.us-east-1.amazonaws.com",
+		},
+		{
+			Name:   "ingress.foo.example.com",
+			LBType: manager.LBTypeIngressInt,
+			LBName: "ingress-foo",
+			Target: "ingress-foo-456.elb.us-east-1.amazonaws.com",
+		},
+	}
+
+	actual, err := acm.ClusterRecords(lbs)
+	if err != nil {
+		t.Fatalf("no error expected, got %v", err)
+	}
+
+	assert.Equal(t, expected, actual, "cluster records do not meet expectations")
+	assert.False(t, actual[0].InSync(), "missing record should not be in sync")
+}
@@ -0,0 +1,120 @@
+package aws
+
+import (
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/kubernetes"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/talos"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// RoleConfig is what nodes of a role are configured from: the machine config, its layered patches, and the node config.
+type RoleConfig struct {
+	MachineConfig []byte
+	Patches       manager.PatchSet
+	NodeConfig    AWSNodeConfig
+}
+
+// NodeDrift is the difference between what a node should be running and what it is.
+type NodeDrift struct {
+	Node  string
+	Role  string
+	Diffs []string
+	Err   error // Set if the node couldn't be checked.
+}
+
+// Drifted is true if the node's config differs from what it should be, or couldn't be checked.
+func (d NodeDrift) Drifted() (drifted bool) {
+	drifted = d.Err != nil || len(d.Diffs) > 0
+	return drifted
+}
+
+// ConfigDrift compares the config each running node should have, rendered the way ApplyNodeConfig renders it, with the config the node is running.  roles maps node roles to their configs.
+func (am *AWSClusterManager) ConfigDrift(roles map[string]RoleConfig) (drift []NodeDrift, err error) {
+	if len(am.Talosconfig) == 0 {
+		err = errors.New("checking config drift needs a talosconfig")
+		return drift, err
+	}
+
+	nodes, nodesErr := am.GetNodes(am.Name)
+	if nodesErr != nil {
+		err = errors.Wrapf(nodesErr, "failed getting nodes for cluster %s", am.Name)
+		return drift, err
+	}
+
+	cpNames, cpErr := kubernetes.ListControlPlaneNodes(am.Context, am.K8sClients, am.Verbose)
+	if cpErr != nil {
+		err = cpErr
+		return drift, err
+	}
+
+	purposes, purposeErr := kubernetes.NodeLabelValues(am.Context, am.K8sClients, kubernetes.PurposeLabel, am.Verbose)
+	if purposeErr != nil {
+		err = purposeErr
+		return drift, err
+	}
+
+	controlPlane, workers := SplitControlPlane(nodes, cpNames)
+
+	drift = make([]NodeDrift, 0, len(controlPlane)+len(workers))
+
+	for _, node := range controlPlane {
+		drift = append(drift, am.nodeDrift(node, manager.NodeRoleCp, purposes[node.Name], roles))
+	}
+
+	for _, node := range workers {
+		drift = append(drift, am.nodeDrift(node, manager.NodeRoleWorker, purposes[node.Name], roles))
+	}
+
+	return drift, err
+}
+
+func (am *AWSClusterManager) nodeDrift(nodeInfo manager.NodeInfo, role string, purpose string, roles map[string]RoleConfig) (drift NodeDrift) {
+	drift = NodeDrift{
+		Node: nodeInfo.Name,
+		Role: role,
+	}
+
+	roleConfig, ok := roles[role]
+	if !ok {
+		drift.Err = errors.Errorf("no configs for role %s", role)
+		return drift
+	}
+
+	node := AWSNode{
+		NodeName:   nodeInfo.Name,
+		IPAddress:  nodeInfo.IP,
+		NodeRole:   role,
+		NodeID:     nodeInfo.ID,
+		Config:     &roleConfig.NodeConfig,
+		NodeDomain: roleConfig.NodeConfig.Domain,
+	}
+
+	patches := roleConfig.Patches.ForNode(nodeInfo.Name, purpose)
+
+	manager.VerboseOutput(am.Verbose, "Patches for %s: %s", nodeInfo.Name, strings.Join(manager.PatchSources(patches), ", "))
+
+	contents, patchErr := am.withInstancePatch(nodeInfo, manager.PatchContents(patches))
+	if patchErr != nil {
+		drift.Err = patchErr
+		return drift
+	}
+
+	expected, renderErr := talos.PatchedConfig(node, roleConfig.MachineConfig, contents)
+	if renderErr != nil {
+		drift.Err = errors.Wrapf(renderErr, "failed rendering expected config")
+		return drift
+	}
+
+	manager.VerboseOutput(am.Verbose, "Fetching live config from %s", nodeInfo.Name)
+
+	live, liveErr := talos.LiveConfig(am.Context, am.Talosconfig, nodeInfo.IP)
+	if liveErr != nil {
+		drift.Err = liveErr
+		return drift
+	}
+
+	drift.Diffs, drift.Err = talos.DiffConfigs(expected, live)
+
+	return drift
+}
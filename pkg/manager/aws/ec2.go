@@ -13,6 +13,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -40,9 +41,30 @@ func (am *AWSClusterManager) CreateNode(nodeName string, nodeRole string, config
 	}
 
 	// Set IP on node struct
-	node.IPAddress = *output.Instances[0].PrivateIpAddress
+	node.IPAddress = instanceIP(output.Instances[0])
 	node.NodeID = *output.Instances[0].InstanceId
 
+	// The kubelet needs the provider ID before it registers the node, so it goes in the machine config.
+	instanceInfo := manager.NodeInfo{
+		Name:         nodeName,
+		ID:           node.NodeID,
+		InstanceType: string(output.Instances[0].InstanceType),
+		IP:           node.IPAddress,
+		Zone:         instanceZone(output.Instances[0]),
+		CapacityType: instanceCapacityType(output.Instances[0]),
+	}
+
+	machineConfigPatches, err = am.withInstancePatch(instanceInfo, machineConfigPatches)
+	if err != nil {
+		// The instance can't be given a config, so don't leave it running without one.
+		termErr := am.terminateInstance(node.NodeID)
+		if termErr != nil {
+			fmt.Printf("Warning: %s.  Terminate it by hand.\n", termErr)
+		}
+
+		return err
+	}
+
 	// Wait for node to be ready
 	waitErr := am.waitForNodeReady(&node)
 	if waitErr != nil {
@@ -50,24 +72,30 @@ func (am *AWSClusterManager) CreateNode(nodeName string, nodeRole string, config
 		return err
 	}
 
-	// Apply Talos machine config
-	applyErr := talos.ApplyConfig(am.Context, &node, machineConfigBytes, machineConfigPatches, true, am.GetVerbose())
+	// Apply Talos machine config.  The instance is fresh and in maintenance mode, so there is nothing to verify yet.
+	_, applyErr := talos.ApplyConfig(am.Context, &node, machineConfigBytes, machineConfigPatches, nil, true, talos.ApplyModeAuto, 0, am.GetVerbose())
 	if applyErr != nil {
 		err = errors.Wrapf(applyErr, "failed applying machine config to %s", nodeName)
 		return err
 	}
 
-	// If purpose provided, wait for node registration and apply labels/taints
-	if purpose != "" {
-		k8sWaitErr := kubernetes.WaitForNodeReady(am.Context, nodeName, 10*time.Minute, am.GetVerbose())
+	// If there are labels, annotations or taints for the node, wait for node registration and apply them
+	metadata := config.NodeMetadataFor(purpose)
+	if !metadata.Empty() {
+		// Don't label a node in some other cluster that happens to have one of the same name.
+		k8sWaitErr := am.VerifyClusterIdentity()
+		if k8sWaitErr == nil {
+			k8sWaitErr = kubernetes.WaitForNodeReady(am.Context, am.K8sClients, nodeName, 10*time.Minute, am.GetVerbose())
+		}
+
 		if k8sWaitErr != nil {
 			// Log but don't fail - node is created, can be labeled manually
 			fmt.Printf("Warning: %s\n", k8sWaitErr)
 		} else {
-			purposeErr := kubernetes.ApplyPurposeLabelsAndTaints(am.Context, nodeName, purpose, am.GetVerbose())
-			if purposeErr != nil {
+			labelErr := am.LabelNode(nodeName, kubernetes.NodeMetadataChange{Set: metadata})
+			if labelErr != nil {
 				// Log but don't fail
-				fmt.Printf("Warning: failed to apply purpose label/taint: %s\n", purposeErr)
+				fmt.Printf("Warning: failed to apply labels, annotations and taints: %s.  Use 'node label --from-config' to retry.\n", labelErr)
 			}
 		}
 	}
@@ -91,6 +119,189 @@ func (am *AWSClusterManager) CreateNode(nodeName string, nodeRole string, config
 	return err
 }
 
+// ApplyNodeConfig pushes an updated machine config to a node that's already in the cluster.  The node is verified with the cluster's talosconfig.
+//
+// In try mode the node's current config is kept, and the new one is only confirmed if, after the settle time, the node's Talos services are healthy and it's Ready in Kubernetes.  Otherwise the old config is put back.  If even that fails, Talos rolls back by itself when the try times out.
+func (am *AWSClusterManager) ApplyNodeConfig(nodeName string, nodeRole string, config AWSNodeConfig, machineConfigBytes []byte, machineConfigPatches []string, mode talos.ApplyMode, tryTimeout time.Duration) (err error) {
+	nodeInfo, getErr := am.GetNode(nodeName)
+	if getErr != nil {
+		err = errors.Wrapf(getErr, "failed getting node %s", nodeName)
+		return err
+	}
+
+	if nodeInfo.ID == "" {
+		err = errors.Errorf("no running instance found for node %s", nodeName)
+		return err
+	}
+
+	node := AWSNode{
+		NodeName:   nodeName,
+		IPAddress:  nodeInfo.IP,
+		NodeRole:   nodeRole,
+		NodeID:     nodeInfo.ID,
+		Config:     &config,
+		NodeDomain: config.Domain,
+	}
+
+	// Keep the provider ID and topology labels the node was created with.
+	machineConfigPatches, err = am.withInstancePatch(nodeInfo, machineConfigPatches)
+	if err != nil {
+		return err
+	}
+
+	if tryTimeout <= 0 {
+		tryTimeout = talos.DefaultTryTimeout
+	}
+
+	var previous []byte
+
+	if mode == talos.ApplyModeTry {
+		err = talos.CheckTryTimeout(tryTimeout)
+		if err != nil {
+			return err
+		}
+
+		// Whether the new config is kept depends on the node being Ready in Kubernetes, which had better be this cluster's.
+		err = am.VerifyClusterIdentity()
+		if err != nil {
+			return err
+		}
+
+		var liveErr error
+
+		previous, liveErr = talos.LiveConfig(am.Context, am.Talosconfig, node.IP())
+		if liveErr != nil {
+			err = errors.Wrapf(liveErr, "failed getting current config of %s to roll back to", nodeName)
+			return err
+		}
+	}
+
+	result, applyErr := talos.ApplyConfig(am.Context, &node, machineConfigBytes, machineConfigPatches, am.Talosconfig, false, mode, tryTimeout, am.GetVerbose())
+	if applyErr != nil {
+		err = errors.Wrapf(applyErr, "failed applying machine config to %s", nodeName)
+		return err
+	}
+
+	fmt.Printf("Applied machine config to node %s (%s): %s\n", nodeName, node.NodeID, result.Summary())
+
+	if mode != talos.ApplyModeTry {
+		return err
+	}
+
+	checkErr := am.checkTriedConfig(nodeName, node.IP())
+	if checkErr != nil {
+		rollbackErr := talos.RollbackConfig(am.Context, am.Talosconfig, nodeName, node.IP(), previous, am.GetVerbose())
+		if rollbackErr != nil {
+			fmt.Printf("Warning: %s.  Talos will roll back %s by itself after %v\n", rollbackErr, nodeName, tryTimeout)
+		}
+
+		err = errors.Wrapf(checkErr, "node %s not healthy with the new config, so it was rolled back", nodeName)
+		return err
+	}
+
+	err = talos.ConfirmConfig(am.Context, am.Talosconfig, nodeName, node.IP(), result.Config, am.GetVerbose())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Confirmed machine config on node %s (%s)\n", nodeName, node.NodeID)
+
+	return err
+}
+
+// checkTriedConfig decides whether a config applied in try mode is kept.  The node is left alone for the settle time, so it can't pass only because its kubelet hasn't been missed yet.  Then its Talos services, including etcd on control plane nodes, have to be healthy, and it has to be Ready in Kubernetes.
+func (am *AWSClusterManager) checkTriedConfig(nodeName string, nodeIP string) (err error) {
+	fmt.Printf("Watching node %s for %v before confirming its config\n", nodeName, talos.TrySettleTime)
+
+	select {
+	case <-am.Context.Done():
+		err = errors.Wrapf(am.Context.Err(), "interrupted watching node %s", nodeName)
+		return err
+	case <-time.After(talos.TrySettleTime):
+	}
+
+	health := talos.CheckNodeHealth(am.Context, am.Talosconfig, nodeName, nodeIP, talos.TryHealthTimeout, 0)
+
+	problems := health.ServiceProblems()
+	if len(problems) > 0 {
+		err = errors.Errorf("node %s is unhealthy: %s", nodeName, strings.Join(problems, ", "))
+		return err
+	}
+
+	ready, readyErr := kubernetes.NodeReady(am.Context, am.K8sClients, nodeName, am.GetVerbose())
+	if readyErr != nil {
+		err = readyErr
+		return err
+	}
+
+	if !ready {
+		err = errors.Errorf("node %s is not Ready", nodeName)
+		return err
+	}
+
+	return err
+}
+
+// LabelNode changes a node's labels, annotations and taints in Kubernetes, once it's sure the kubeconfig points at this cluster.
+func (am *AWSClusterManager) LabelNode(nodeName string, change kubernetes.NodeMetadataChange) (err error) {
+	err = am.VerifyClusterIdentity()
+	if err != nil {
+		return err
+	}
+
+	err = kubernetes.ApplyNodeMetadata(am.Context, am.K8sClients, nodeName, change, am.GetVerbose())
+
+	return err
+}
+
+// NodePurpose returns a node's purpose, from its purpose label in Kubernetes, once it's sure the kubeconfig points at this cluster.  Nodes without a purpose return an empty one.
+func (am *AWSClusterManager) NodePurpose(nodeName string) (purpose string, err error) {
+	err = am.VerifyClusterIdentity()
+	if err != nil {
+		return purpose, err
+	}
+
+	purpose, err = kubernetes.NodeLabel(am.Context, am.K8sClients, nodeName, kubernetes.PurposeLabel, am.GetVerbose())
+
+	return purpose, err
+}
+
+// NodeRole returns a node's role: control plane if Kubernetes labels it as one, and worker if not.  The node has to be in Kubernetes, and the kubeconfig has to point at this cluster.
+func (am *AWSClusterManager) NodeRole(nodeName string) (role string, err error) {
+	err = am.VerifyClusterIdentity()
+	if err != nil {
+		return role, err
+	}
+
+	labels, labelsErr := kubernetes.NodeLabels(am.Context, am.K8sClients, nodeName, am.GetVerbose())
+	if labelsErr != nil {
+		err = labelsErr
+		return role, err
+	}
+
+	role = manager.NodeRoleWorker
+	if _, isCP := labels[kubernetes.ControlPlaneLabel]; isCP {
+		role = manager.NodeRoleCp
+	}
+
+	return role, err
+}
+
+// terminateInstance terminates the instance with the given ID.
+func (am *AWSClusterManager) terminateInstance(instanceID string) (err error) {
+	input := &ec2.TerminateInstancesInput{
+		InstanceIds: []string{instanceID},
+	}
+
+	_, err = am.Ec2Client.TerminateInstances(am.Context, input)
+	if err != nil {
+		err = errors.Wrapf(err, "failed terminating instance %s", instanceID)
+		return err
+	}
+
+	return err
+}
+
 func (am *AWSClusterManager) launchEC2Instance(nodeName string, config AWSNodeConfig) (output *ec2.RunInstancesOutput, err error) {
 	tags := []types.TagSpecification{
 		{
@@ -180,6 +391,18 @@ func (am *AWSClusterManager) waitForNodeReady(node *AWSNode) (err error) {
 }
 
 func (am *AWSClusterManager) DeleteNode(nodeName string) (err error) {
+	// Without a domain the node's DNS records can't be found, and would be left behind once the instance is gone.
+	if am.Domain == "" {
+		err = errors.Errorf("no domain to find the DNS records of node %s in.  Set domain in the node config", nodeName)
+		return err
+	}
+
+	// Make sure we'd delete the node from this cluster's Kubernetes, and not another's.
+	err = am.VerifyClusterIdentity()
+	if err != nil {
+		return err
+	}
+
 	// Get Node info
 	manager.VerboseOutput(am.GetVerbose(), "Getting node info\n")
 	nodeInfo, getErr := am.GetNode(nodeName)
@@ -188,7 +411,27 @@ func (am *AWSClusterManager) DeleteNode(nodeName string) (err error) {
 		return err
 	}
 
-	dnsDeregErr := am.DnsManager.DeregisterNode(am.Context, nodeName, am.GetVerbose())
+	// Control plane nodes have to leave etcd before they go, or the cluster is left with a dead member.
+	isCP, cpErr := am.IsControlPlane(nodeName)
+	if cpErr != nil {
+		err = errors.Wrapf(cpErr, "failed checking whether %s is a control plane node", nodeName)
+		return err
+	}
+
+	if am.GracefulReset {
+		err = am.resetNode(nodeName, nodeInfo.IP, isCP)
+		if err != nil {
+			return err
+		}
+	} else if isCP {
+		etcdErr := am.RemoveFromEtcd(nodeName, nodeInfo.IP)
+		if etcdErr != nil {
+			err = etcdErr
+			return err
+		}
+	}
+
+	dnsDeregErr := am.DnsManager.DeregisterNode(am.Context, nodeName, am.Domain, am.GetVerbose())
 	if dnsDeregErr != nil {
 		err = errors.Wrapf(dnsDeregErr, "failed deregistering dns for %s", nodeName)
 		return err
@@ -201,19 +444,14 @@ func (am *AWSClusterManager) DeleteNode(nodeName string) (err error) {
 	}
 
 	manager.VerboseOutput(am.GetVerbose(), "Removing node %s from EC2\n", nodeName)
-	// Remove Instance
-	input := &ec2.TerminateInstancesInput{
-		InstanceIds: []string{nodeInfo.ID},
-	}
 
-	// Terminate Instances
-	_, termErr := am.Ec2Client.TerminateInstances(am.Context, input)
+	termErr := am.terminateInstance(nodeInfo.ID)
 	if termErr != nil {
-		err = errors.Wrapf(termErr, "failed removing node %s (%s) from aws", nodeName, nodeInfo.ID)
+		err = errors.Wrapf(termErr, "failed removing node %s from aws", nodeName)
 		return err
 	}
 
-	k8sDelErr := kubernetes.DeleteNode(am.Context, nodeName, am.GetVerbose())
+	k8sDelErr := kubernetes.DeleteNode(am.Context, am.K8sClients, nodeName, am.GetVerbose())
 	if k8sDelErr != nil {
 		err = errors.Wrapf(k8sDelErr, "failed deleting node %s from k8s", nodeName)
 	}
@@ -223,6 +461,41 @@ func (am *AWSClusterManager) DeleteNode(nodeName string) (err error) {
 	return err
 }
 
+// resetNode resets the node through the Talos API, so it leaves etcd and Kubernetes cleanly before it's terminated.  If the node doesn't answer in time, we carry on with a warning, and control plane nodes are taken out of etcd the hard way.
+func (am *AWSClusterManager) resetNode(nodeName string, nodeIP string, isCP bool) (err error) {
+	if len(am.Talosconfig) == 0 {
+		fmt.Printf("Warning: no talosconfig, so node %s can't be reset.  Terminating it without a reset.\n", nodeName)
+	} else {
+		// The node leaves etcd itself as part of a graceful reset, but we still won't let it go if that would break quorum.
+		if isCP {
+			_, _, _, checkErr := am.CheckEtcdRemoval(nodeName)
+			if checkErr != nil {
+				err = checkErr
+				return err
+			}
+		}
+
+		fmt.Printf("Resetting node %s\n", nodeName)
+
+		resetErr := talos.ResetNode(am.Context, am.Talosconfig, nodeIP, am.ResetTimeout, am.GetVerbose())
+		if resetErr == nil {
+			fmt.Printf("Node %s reset\n", nodeName)
+			return err
+		}
+
+		fmt.Printf("Warning: failed resetting node %s: %s.  Terminating it without a reset.\n", nodeName, resetErr)
+	}
+
+	if isCP {
+		err = am.RemoveFromEtcd(nodeName, nodeIP)
+		if err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
 // GetNode gets the Id (instance Id) of the node specified by the Name tag.
 func (am *AWSClusterManager) GetNode(nodeName string) (nodeInfo manager.NodeInfo, err error) {
 	filter := types.Filter{
@@ -252,6 +525,9 @@ func (am *AWSClusterManager) GetNode(nodeName string) (nodeInfo manager.NodeInfo
 				nodeInfo.Name = nodeName
 				nodeInfo.ID = *inst.InstanceId
 				nodeInfo.InstanceType = string(inst.InstanceType)
+				nodeInfo.IP = instanceIP(inst)
+				nodeInfo.Zone = instanceZone(inst)
+				nodeInfo.CapacityType = instanceCapacityType(inst)
 
 				am.FetchedNodesByName[nodeName] = nodeInfo
 				am.FetchedNodesById[*inst.InstanceId] = nodeInfo
@@ -312,6 +588,7 @@ func (am *AWSClusterManager) GetNodeById(id string) (nodeInfo manager.NodeInfo,
 
 		nodeInfo.ID = *output.Reservations[0].Instances[0].InstanceId
 		nodeInfo.InstanceType = string(output.Reservations[0].Instances[0].InstanceType)
+		nodeInfo.IP = instanceIP(output.Reservations[0].Instances[0])
 
 		am.FetchedNodesByName[nodeInfo.Name] = nodeInfo
 		am.FetchedNodesById[*output.Reservations[0].Instances[0].InstanceId] = nodeInfo
@@ -361,6 +638,9 @@ func (am *AWSClusterManager) GetNodes(clusterName string) (nodeInfo []manager.No
 			Name:         name,
 			ID:           *instance.InstanceId,
 			InstanceType: string(instance.InstanceType),
+			IP:           instanceIP(instance),
+			Zone:         instanceZone(instance),
+			CapacityType: instanceCapacityType(instance),
 		}
 
 		nodeInfo = append(nodeInfo, info)
@@ -375,6 +655,20 @@ func (am *AWSClusterManager) GetNodes(clusterName string) (nodeInfo []manager.No
 	return nodeInfo, err
 }
 
+// instanceIP returns the private IP of the instance.  IPv6 only instances have no private IPv4 address, so we fall back to the IPv6 address.
+func instanceIP(instance types.Instance) (ip string) {
+	if instance.PrivateIpAddress != nil {
+		ip = *instance.PrivateIpAddress
+		return ip
+	}
+
+	if instance.Ipv6Address != nil {
+		ip = *instance.Ipv6Address
+	}
+
+	return ip
+}
+
 func sortNodeInfoByName(nodes []manager.NodeInfo) (sorted []manager.NodeInfo) {
 	sorted = make([]manager.NodeInfo, len(nodes))
 	copy(sorted, nodes)
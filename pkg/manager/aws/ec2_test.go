@@ -73,6 +73,8 @@ func TestGetNode(t *testing.T) {
 					Name:         TestNodeName,
 					ID:           TestInstanceID,
 					InstanceType: "t3.medium",
+					Zone:         "us-east-1a",
+					CapacityType: CapacityTypeOnDemand,
 				},
 				AWSClusterManager{
 					Ec2Client: MockEc2ClientGetNodeOneRunningInst{},
@@ -81,6 +83,8 @@ func TestGetNode(t *testing.T) {
 							Name:         TestNodeName,
 							ID:           TestInstanceID,
 							InstanceType: "t3.medium",
+							Zone:         "us-east-1a",
+							CapacityType: CapacityTypeOnDemand,
 						},
 					},
 					FetchedNodesById: map[string]manager.NodeInfo{
@@ -88,6 +92,8 @@ func TestGetNode(t *testing.T) {
 							Name:         TestNodeName,
 							ID:           TestInstanceID,
 							InstanceType: "t3.medium",
+							Zone:         "us-east-1a",
+							CapacityType: CapacityTypeOnDemand,
 						},
 					},
 				},
@@ -267,16 +273,19 @@ func TestGetNodes(t *testing.T) {
 						Name:         fmt.Sprintf("%s-a-node-name", TestClusterTagValue),
 						ID:           fmt.Sprintf("i-%s-a-node-name", TestClusterTagValue),
 						InstanceType: "t3.medium",
+						CapacityType: CapacityTypeOnDemand,
 					},
 					{
 						Name:         fmt.Sprintf("%s-b-node-name", TestClusterTagValue),
 						ID:           fmt.Sprintf("i-%s-b-node-name", TestClusterTagValue),
 						InstanceType: "t3.medium",
+						CapacityType: CapacityTypeOnDemand,
 					},
 					{
 						Name:         fmt.Sprintf("%s-z-node-name", TestClusterTagValue),
 						ID:           fmt.Sprintf("i-%s-z-node-name", TestClusterTagValue),
 						InstanceType: "t3.medium",
+						CapacityType: CapacityTypeOnDemand,
 					},
 				},
 				AWSClusterManager{
@@ -426,3 +435,28 @@ func TestGetNodeSecurityGroupsForCluster(t *testing.T) {
 	}
 
 }
+
+func TestSplitControlPlane(t *testing.T) {
+	nodes := []manager.NodeInfo{
+		{Name: "test-worker-1", IP: "10.0.1.4"},
+		{Name: "test-cp-2", IP: "10.0.1.2"},
+		{Name: "test-cp-1", IP: "10.0.1.1"},
+		{Name: "test-cp-3"},
+		{Name: "test-worker-2", IP: "10.0.1.5"},
+	}
+
+	controlPlane, workers := SplitControlPlane(nodes, []string{"test-cp-1", "test-cp-2", "test-cp-3"})
+
+	cpNames := make([]string, 0)
+	for _, n := range controlPlane {
+		cpNames = append(cpNames, n.Name)
+	}
+
+	workerNames := make([]string, 0)
+	for _, n := range workers {
+		workerNames = append(workerNames, n.Name)
+	}
+
+	assert.Equal(t, []string{"test-cp-1", "test-cp-2"}, cpNames, "control plane nodes do not meet expectations")
+	assert.Equal(t, []string{"test-worker-1", "test-worker-2"}, workerNames, "workers do not meet expectations")
+}
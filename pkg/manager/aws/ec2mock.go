@@ -39,6 +39,7 @@ func (MockEc2ClientGetNodeOneRunningInst) DescribeInstances(ctx context.Context,
 						State:        &types.InstanceState{Name: types.InstanceStateNameRunning},
 						InstanceId:   aws.String(TestInstanceID),
 						InstanceType: types.InstanceTypeT3Medium,
+						Placement:    &types.Placement{AvailabilityZone: aws.String("us-east-1a")},
 						Tags: []types.Tag{
 							{
 								Key:   aws.String("Name"),
@@ -108,6 +108,7 @@ func (am *AWSClusterManager) checkAndBuildLBInfo(lb types.LoadBalancer) (lbInfo
 	apiserverRegex := regexp.MustCompile(`.*apiserver.*`)
 	lbInfo = manager.LBInfo{
 		Name:         *lb.LoadBalancerName,
+		DNSName:      aws.ToString(lb.DNSName),
 		Targets:      make([]manager.LBTargetInfo, 0),
 		TargetGroups: make([]manager.LBTargetGroupInfo, 0),
 		IsAPIServer:  apiserverRegex.MatchString(*lb.LoadBalancerName),
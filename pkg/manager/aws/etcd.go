@@ -0,0 +1,325 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/backup"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/kubernetes"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/talos"
+	"github.com/pkg/errors"
+	"os"
+	"slices"
+	"time"
+)
+
+// ControlPlaneNodes returns the cluster's running control plane nodes, as labelled in Kubernetes.
+func (am *AWSClusterManager) ControlPlaneNodes() (controlPlane []manager.NodeInfo, err error) {
+	nodes, nodesErr := am.GetNodes(am.Name)
+	if nodesErr != nil {
+		err = errors.Wrapf(nodesErr, "failed getting nodes for cluster %s", am.Name)
+		return controlPlane, err
+	}
+
+	cpNames, cpErr := kubernetes.ListControlPlaneNodes(am.Context, am.K8sClients, am.Verbose)
+	if cpErr != nil {
+		err = cpErr
+		return controlPlane, err
+	}
+
+	controlPlane, _ = SplitControlPlane(nodes, cpNames)
+
+	return controlPlane, err
+}
+
+// IsControlPlane is true if Kubernetes has the named node labelled as a control plane node.
+func (am *AWSClusterManager) IsControlPlane(nodeName string) (isCP bool, err error) {
+	cpNames, cpErr := kubernetes.ListControlPlaneNodes(am.Context, am.K8sClients, am.Verbose)
+	if cpErr != nil {
+		err = cpErr
+		return isCP, err
+	}
+
+	isCP = slices.Contains(cpNames, nodeName)
+
+	return isCP, err
+}
+
+// CheckEtcdRemoval checks that the named control plane node can be taken out of etcd without losing quorum.  It returns the node's member, if it has one, and the IPs of the other control plane nodes.
+func (am *AWSClusterManager) CheckEtcdRemoval(nodeName string) (member talos.EtcdMember, found bool, otherIPs []string, err error) {
+	if len(am.Talosconfig) == 0 {
+		err = errors.Errorf("%s is a control plane node, and removing it from etcd needs a talosconfig", nodeName)
+		return member, found, otherIPs, err
+	}
+
+	controlPlane, cpErr := am.ControlPlaneNodes()
+	if cpErr != nil {
+		err = cpErr
+		return member, found, otherIPs, err
+	}
+
+	cpIPs := make([]string, 0, len(controlPlane))
+	otherIPs = make([]string, 0, len(controlPlane))
+	for _, node := range controlPlane {
+		cpIPs = append(cpIPs, node.IP)
+		if node.Name != nodeName {
+			otherIPs = append(otherIPs, node.IP)
+		}
+	}
+
+	health, healthErr := talos.CheckEtcdHealth(am.Context, am.Talosconfig, cpIPs, am.Verbose)
+	if healthErr != nil {
+		err = errors.Wrapf(healthErr, "failed checking etcd before removing %s", nodeName)
+		return member, found, otherIPs, err
+	}
+
+	member, found = talos.MemberForNode(health.Members, nodeName)
+	if !found {
+		return member, found, otherIPs, err
+	}
+
+	err = talos.CheckMemberRemoval(health, member.ID)
+	if err != nil {
+		err = errors.Wrapf(err, "not removing control plane node %s", nodeName)
+		return member, found, otherIPs, err
+	}
+
+	return member, found, otherIPs, err
+}
+
+// RemoveFromEtcd takes a control plane node out of etcd ahead of its deletion.  It refuses if the remaining members couldn't keep quorum.  The node leaves on its own if it can, otherwise its member is removed by one of the others.
+func (am *AWSClusterManager) RemoveFromEtcd(nodeName string, nodeIP string) (err error) {
+	member, found, otherIPs, checkErr := am.CheckEtcdRemoval(nodeName)
+	if checkErr != nil {
+		err = checkErr
+		return err
+	}
+
+	if !found {
+		fmt.Printf("Node %s has no etcd member.  Nothing to remove.\n", nodeName)
+		return err
+	}
+
+	leaveErr := talos.LeaveEtcd(am.Context, am.Talosconfig, nodeIP, am.Verbose)
+	if leaveErr == nil {
+		fmt.Printf("Node %s left etcd\n", nodeName)
+		return err
+	}
+
+	manager.VerboseOutput(am.Verbose, "%s could not leave etcd on its own: %s", nodeName, leaveErr)
+
+	if len(otherIPs) == 0 {
+		err = errors.Wrapf(leaveErr, "no other control plane node to remove %s's etcd member", nodeName)
+		return err
+	}
+
+	for _, ip := range otherIPs {
+		removeErr := talos.RemoveEtcdMember(am.Context, am.Talosconfig, ip, member.ID, am.Verbose)
+		if removeErr == nil {
+			fmt.Printf("Removed etcd member %x for node %s\n", member.ID, nodeName)
+			return err
+		}
+
+		err = removeErr
+	}
+
+	err = errors.Wrapf(err, "failed removing %s from etcd", nodeName)
+
+	return err
+}
+
+// WaitForEtcdJoin waits for a new control plane node to become a voting member of a healthy etcd.
+func (am *AWSClusterManager) WaitForEtcdJoin(nodeName string, timeout time.Duration) (err error) {
+	if len(am.Talosconfig) == 0 {
+		err = errors.Errorf("waiting for %s to join etcd needs a talosconfig", nodeName)
+		return err
+	}
+
+	controlPlane, cpErr := am.ControlPlaneNodes()
+	if cpErr != nil {
+		err = cpErr
+		return err
+	}
+
+	cpIPs := make([]string, 0, len(controlPlane)+1)
+	newNodeListed := false
+	for _, node := range controlPlane {
+		cpIPs = append(cpIPs, node.IP)
+		if node.Name == nodeName {
+			newNodeListed = true
+		}
+	}
+
+	// The new node may not be labelled in Kubernetes yet.
+	if !newNodeListed {
+		nodeInfo, getErr := am.GetNode(nodeName)
+		if getErr != nil {
+			err = errors.Wrapf(getErr, "failed getting node %s", nodeName)
+			return err
+		}
+
+		if nodeInfo.IP != "" {
+			cpIPs = append(cpIPs, nodeInfo.IP)
+		}
+	}
+
+	err = talos.WaitForEtcdMember(am.Context, am.Talosconfig, cpIPs, nodeName, timeout, am.Verbose)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Node %s has joined etcd\n", nodeName)
+
+	return err
+}
+
+// HealthyControlPlaneNode picks a control plane node whose etcd member is healthy.
+func (am *AWSClusterManager) HealthyControlPlaneNode() (node manager.NodeInfo, err error) {
+	if len(am.Talosconfig) == 0 {
+		err = errors.New("finding a healthy control plane node needs a talosconfig")
+		return node, err
+	}
+
+	controlPlane, cpErr := am.ControlPlaneNodes()
+	if cpErr != nil {
+		err = cpErr
+		return node, err
+	}
+
+	byIP := make(map[string]manager.NodeInfo)
+	cpIPs := make([]string, 0, len(controlPlane))
+	for _, n := range controlPlane {
+		byIP[n.IP] = n
+		cpIPs = append(cpIPs, n.IP)
+	}
+
+	for _, status := range talos.EtcdNodeStatuses(am.Context, am.Talosconfig, cpIPs) {
+		if status.Err == nil && len(status.Errors) == 0 && status.Leader != 0 {
+			node = byIP[status.Node]
+			return node, err
+		}
+
+		manager.VerboseOutput(am.Verbose, "Skipping %s: etcd not healthy", byIP[status.Node].Name)
+	}
+
+	err = errors.Errorf("no control plane node in cluster %s has a healthy etcd member", am.Name)
+
+	return node, err
+}
+
+// BackupEtcd takes an etcd snapshot from a healthy control plane node, and stores it in the target along with its checksum and metadata.
+func (am *AWSClusterManager) BackupEtcd(target backup.Target) (name string, err error) {
+	node, nodeErr := am.HealthyControlPlaneNode()
+	if nodeErr != nil {
+		err = nodeErr
+		return name, err
+	}
+
+	tmp, tmpErr := os.CreateTemp("", "etcd-snapshot-*.db")
+	if tmpErr != nil {
+		err = errors.Wrapf(tmpErr, "failed creating temp file for the snapshot")
+		return name, err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	created := time.Now().UTC()
+	name = backup.SnapshotName(am.Name, created)
+
+	_, err = talos.EtcdSnapshot(am.Context, am.Talosconfig, node.IP, tmp, am.Verbose)
+	closeErr := tmp.Close()
+
+	if err != nil {
+		return name, err
+	}
+
+	if closeErr != nil {
+		err = errors.Wrapf(closeErr, "failed writing snapshot to %s", tmp.Name())
+		return name, err
+	}
+
+	sum, size, sumErr := backup.FileChecksum(tmp.Name())
+	if sumErr != nil {
+		err = sumErr
+		return name, err
+	}
+
+	revision, revErr := talos.SnapshotRevision(tmp.Name())
+	if revErr != nil {
+		err = revErr
+		return name, err
+	}
+
+	metadata := backup.SnapshotMetadata{
+		Cluster:  am.Name,
+		Created:  created,
+		Revision: revision,
+		Node:     node.Name,
+		Size:     size,
+		SHA256:   sum,
+	}
+
+	err = backup.PutSnapshot(am.Context, target, name, tmp.Name(), metadata, am.Verbose)
+	if err != nil {
+		return name, err
+	}
+
+	fmt.Printf("Stored etcd snapshot %s from node %s in %s (revision %d, %d bytes, sha256 %s)\n", name, node.Name, target, revision, size, sum)
+
+	return name, err
+}
+
+// RestoreEtcd fetches the named snapshot from the target, checks it, and bootstraps etcd from it on the named control plane node.  The node has to be freshly configured, and not yet bootstrapped.  The other control plane nodes join it once it's up.
+//
+// A snapshot taken from another cluster is refused unless force is set, e.g. to clone a cluster.
+func (am *AWSClusterManager) RestoreEtcd(nodeName string, target backup.Target, name string, force bool) (err error) {
+	if len(am.Talosconfig) == 0 {
+		err = errors.New("restoring etcd needs a talosconfig")
+		return err
+	}
+
+	nodeInfo, getErr := am.GetNode(nodeName)
+	if getErr != nil {
+		err = errors.Wrapf(getErr, "failed getting node %s", nodeName)
+		return err
+	}
+
+	if nodeInfo.IP == "" {
+		err = errors.Errorf("no running instance found for node %s", nodeName)
+		return err
+	}
+
+	tmp, tmpErr := os.CreateTemp("", "etcd-snapshot-*.db")
+	if tmpErr != nil {
+		err = errors.Wrapf(tmpErr, "failed creating temp file for the snapshot")
+		return err
+	}
+
+	_ = tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	metadata, snapErr := backup.GetSnapshot(am.Context, target, name, tmp.Name(), am.Verbose)
+	if snapErr != nil {
+		err = snapErr
+		return err
+	}
+
+	if metadata.Cluster != am.Name {
+		if !force {
+			err = errors.Errorf("snapshot %s was taken from cluster %s, not %s.  Force it to restore it anyway", name, metadata.Cluster, am.Name)
+			return err
+		}
+
+		fmt.Printf("Warning: snapshot %s was taken from cluster %s, not %s.  Restoring it anyway.\n", name, metadata.Cluster, am.Name)
+	}
+
+	fmt.Printf("Restoring etcd snapshot %s (revision %d, taken %s) on node %s\n", name, metadata.Revision, metadata.Created.Format(time.RFC3339), nodeName)
+
+	err = talos.RecoverEtcd(am.Context, am.Talosconfig, nodeInfo.IP, tmp.Name(), am.Verbose)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Node %s is bootstrapping etcd from snapshot %s\n", nodeName, name)
+
+	return err
+}
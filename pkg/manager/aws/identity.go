@@ -0,0 +1,167 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/kubernetes"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+// ProviderIDPrefix starts the provider IDs of AWS nodes, e.g. aws:///us-east-1a/i-0af01c0123456789a.
+const ProviderIDPrefix = "aws://"
+
+// InstanceIDFromProviderID returns the instance ID at the end of an AWS provider ID, or nothing if it's not an AWS provider ID.
+func InstanceIDFromProviderID(providerID string) (instanceID string) {
+	if !strings.HasPrefix(providerID, ProviderIDPrefix) {
+		return instanceID
+	}
+
+	instanceID = providerID[strings.LastIndex(providerID, "/")+1:]
+
+	return instanceID
+}
+
+// CheckClusterIdentity decides whether the Kubernetes cluster a kubeconfig points at is the named cluster.
+//
+// If the cluster has an identity ConfigMap, it settles the matter.  Otherwise most of the Kubernetes nodes have to be instances of the cluster: matched by the instance ID in their provider ID, or by name if they have none.
+func CheckClusterIdentity(clusterName string, identity string, identityFound bool, providerIDs map[string]string, instances []manager.NodeInfo) (err error) {
+	if identityFound {
+		if identity != clusterName {
+			err = errors.Errorf("the kubeconfig points at cluster %s, not %s", identity, clusterName)
+			return err
+		}
+
+		return err
+	}
+
+	if len(providerIDs) == 0 {
+		err = errors.Errorf("the kubeconfig points at a cluster with no nodes, so it can't be told apart from any other, and it has no %s ConfigMap", kubernetes.IdentityConfigMapName)
+		return err
+	}
+
+	instanceIDs := make(map[string]bool, len(instances))
+	instanceNames := make(map[string]bool, len(instances))
+
+	for _, instance := range instances {
+		instanceIDs[instance.ID] = true
+		instanceNames[shortNodeName(instance.Name)] = true
+	}
+
+	strangers := make([]string, 0)
+
+	for nodeName, providerID := range providerIDs {
+		instanceID := InstanceIDFromProviderID(providerID)
+
+		if instanceID != "" && instanceIDs[instanceID] {
+			continue
+		}
+
+		if instanceID == "" && instanceNames[shortNodeName(nodeName)] {
+			continue
+		}
+
+		strangers = append(strangers, nodeName)
+	}
+
+	if len(strangers)*2 >= len(providerIDs) {
+		sort.Strings(strangers)
+		err = errors.Errorf("the kubeconfig doesn't point at cluster %s: %d of its %d nodes aren't instances of the cluster (%s)", clusterName, len(strangers), len(providerIDs), strings.Join(strangers, ", "))
+		return err
+	}
+
+	return err
+}
+
+// shortNodeName drops any domain from a node name.
+func shortNodeName(name string) (short string) {
+	short, _, _ = strings.Cut(name, ".")
+	return short
+}
+
+// VerifyClusterIdentity makes sure the Kubernetes clients point at this cluster, before anything is done that can't be undone.  It's checked once per cluster manager, and not at all if SkipIdentityCheck is set.
+func (am *AWSClusterManager) VerifyClusterIdentity() (err error) {
+	if am.SkipIdentityCheck || am.identityVerified {
+		return err
+	}
+
+	identity, found, idErr := kubernetes.ClusterIdentity(am.Context, am.K8sClients, am.Verbose)
+	if idErr != nil {
+		err = errors.Wrapf(idErr, "failed checking which cluster the kubeconfig points at")
+		return err
+	}
+
+	var providerIDs map[string]string
+	var instances []manager.NodeInfo
+
+	if !found {
+		var listErr error
+
+		providerIDs, listErr = kubernetes.NodeProviderIDs(am.Context, am.K8sClients, am.Verbose)
+		if listErr != nil {
+			err = errors.Wrapf(listErr, "failed checking which cluster the kubeconfig points at")
+			return err
+		}
+
+		instances, listErr = am.GetNodes(am.Name)
+		if listErr != nil {
+			err = errors.Wrapf(listErr, "failed getting nodes for cluster %s", am.Name)
+			return err
+		}
+	}
+
+	err = CheckClusterIdentity(am.Name, identity, found, providerIDs, instances)
+	if err != nil {
+		err = errors.Wrapf(err, "refusing to go on.  Use --skip-identity-check if you're sure")
+		return err
+	}
+
+	manager.VerboseOutput(am.Verbose, "Kubeconfig points at cluster %s", am.Name)
+
+	am.identityVerified = true
+
+	return err
+}
+
+// WriteClusterIdentity checks that the kubeconfig points at this cluster by its nodes, and writes the identity ConfigMap, so later checks don't depend on the nodes.
+func (am *AWSClusterManager) WriteClusterIdentity() (err error) {
+	identity, found, idErr := kubernetes.ClusterIdentity(am.Context, am.K8sClients, am.Verbose)
+	if idErr != nil {
+		err = idErr
+		return err
+	}
+
+	if found && identity != am.Name {
+		err = errors.Errorf("the kubeconfig points at cluster %s, not %s", identity, am.Name)
+		return err
+	}
+
+	if !am.SkipIdentityCheck {
+		providerIDs, listErr := kubernetes.NodeProviderIDs(am.Context, am.K8sClients, am.Verbose)
+		if listErr != nil {
+			err = listErr
+			return err
+		}
+
+		instances, nodesErr := am.GetNodes(am.Name)
+		if nodesErr != nil {
+			err = errors.Wrapf(nodesErr, "failed getting nodes for cluster %s", am.Name)
+			return err
+		}
+
+		err = CheckClusterIdentity(am.Name, "", false, providerIDs, instances)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = kubernetes.WriteClusterIdentity(am.Context, am.K8sClients, am.Name, am.Verbose)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote identity for cluster %s to %s/%s\n", am.Name, kubernetes.IdentityNamespace, kubernetes.IdentityConfigMapName)
+
+	return err
+}
@@ -0,0 +1,126 @@
+package aws
+
+import (
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInstanceIDFromProviderID(t *testing.T) {
+	cases := []struct {
+		name       string
+		providerID string
+		instanceID string
+	}{
+		{
+			name:       "aws",
+			providerID: "aws:///us-east-1a/i-0af01c0123456789a",
+			instanceID: "i-0af01c0123456789a",
+		},
+		{
+			name:       "no zone",
+			providerID: "aws:///i-0af01c0123456789a",
+			instanceID: "i-0af01c0123456789a",
+		},
+		{
+			name:       "other provider",
+			providerID: "gce://project/us-central1-a/node-1",
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.instanceID, InstanceIDFromProviderID(tc.providerID), "instance ID does not meet expectations")
+		})
+	}
+}
+
+func TestCheckClusterIdentity(t *testing.T) {
+	instances := []manager.NodeInfo{
+		{Name: "prod-cp-1.example.com", ID: "i-1", IP: "10.0.1.10"},
+		{Name: "prod-cp-2.example.com", ID: "i-2", IP: "10.0.1.11"},
+		{Name: "prod-worker-1.example.com", ID: "i-3", IP: "10.0.1.20"},
+	}
+
+	cases := []struct {
+		name          string
+		identity      string
+		identityFound bool
+		providerIDs   map[string]string
+		errored       bool
+	}{
+		{
+			name:          "identity matches",
+			identity:      "prod",
+			identityFound: true,
+		},
+		{
+			name:          "identity of another cluster",
+			identity:      "staging",
+			identityFound: true,
+			providerIDs: map[string]string{
+				"prod-cp-1": "aws:///us-east-1a/i-1",
+			},
+			errored: true,
+		},
+		{
+			name: "nodes match by provider ID",
+			providerIDs: map[string]string{
+				"prod-cp-1":     "aws:///us-east-1a/i-1",
+				"prod-cp-2":     "aws:///us-east-1b/i-2",
+				"prod-worker-1": "aws:///us-east-1a/i-3",
+			},
+		},
+		{
+			name: "nodes match by name",
+			providerIDs: map[string]string{
+				"prod-cp-1":     "",
+				"prod-worker-1": "",
+			},
+		},
+		{
+			name: "same names, other instances",
+			providerIDs: map[string]string{
+				"prod-cp-1":     "aws:///us-east-1a/i-7",
+				"prod-cp-2":     "aws:///us-east-1b/i-8",
+				"prod-worker-1": "aws:///us-east-1a/i-9",
+			},
+			errored: true,
+		},
+		{
+			name: "minority of strangers",
+			providerIDs: map[string]string{
+				"prod-cp-1":     "aws:///us-east-1a/i-1",
+				"prod-cp-2":     "aws:///us-east-1b/i-2",
+				"prod-worker-9": "aws:///us-east-1a/i-9",
+			},
+		},
+		{
+			name: "half strangers",
+			providerIDs: map[string]string{
+				"prod-cp-1":     "aws:///us-east-1a/i-1",
+				"prod-worker-9": "aws:///us-east-1a/i-9",
+			},
+			errored: true,
+		},
+		{
+			name:        "no nodes",
+			providerIDs: map[string]string{},
+			errored:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckClusterIdentity("prod", tc.identity, tc.identityFound, tc.providerIDs, instances)
+			if tc.errored {
+				assert.Error(t, err, "expected an error")
+			} else {
+				assert.NoError(t, err, "unexpected error")
+			}
+		})
+	}
+}
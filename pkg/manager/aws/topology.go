@@ -0,0 +1,133 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Labels nodes get from their instance, as a cloud controller would set them.  Kubelets may only set labels under kubernetes.io if they're well known, or under node.kubernetes.io, so the capacity type and instance ID labels live there.
+const (
+	LabelZone         = "topology.kubernetes.io/zone"
+	LabelRegion       = "topology.kubernetes.io/region"
+	LabelInstanceType = "node.kubernetes.io/instance-type"
+	LabelCapacityType = "node.kubernetes.io/capacity-type"
+	LabelInstanceID   = "node.kubernetes.io/instance-id"
+)
+
+// Capacity types of instances.
+const (
+	CapacityTypeOnDemand = "on-demand"
+	CapacityTypeSpot     = "spot"
+)
+
+// ProviderID is the Kubernetes provider ID of an instance: aws:///<zone>/<instance id>, as the AWS cloud provider writes it.
+func ProviderID(zone string, instanceID string) (providerID string) {
+	providerID = fmt.Sprintf("%s/%s/%s", ProviderIDPrefix, zone, instanceID)
+	return providerID
+}
+
+// instanceZone returns the availability zone an instance runs in.
+func instanceZone(instance types.Instance) (zone string) {
+	if instance.Placement != nil && instance.Placement.AvailabilityZone != nil {
+		zone = *instance.Placement.AvailabilityZone
+	}
+
+	return zone
+}
+
+// instanceCapacityType says whether an instance is a spot or on-demand instance.
+func instanceCapacityType(instance types.Instance) (capacityType string) {
+	capacityType = CapacityTypeOnDemand
+	if instance.InstanceLifecycle == types.InstanceLifecycleTypeSpot {
+		capacityType = CapacityTypeSpot
+	}
+
+	return capacityType
+}
+
+// TopologyLabels returns the labels a node gets from its instance.  Labels for anything unknown, such as the region, are left out.
+func TopologyLabels(nodeInfo manager.NodeInfo, region string) (labels map[string]string) {
+	labels = make(map[string]string)
+
+	values := map[string]string{
+		LabelZone:         nodeInfo.Zone,
+		LabelRegion:       region,
+		LabelInstanceType: nodeInfo.InstanceType,
+		LabelCapacityType: nodeInfo.CapacityType,
+		LabelInstanceID:   nodeInfo.ID,
+	}
+
+	for label, value := range values {
+		if value != "" {
+			labels[label] = value
+		}
+	}
+
+	return labels
+}
+
+// InstancePatch renders a machine config patch that tells the kubelet its provider ID, so spec.providerID is set when the node registers, and has Talos label the node with its topology.  There's no cloud controller in these clusters to do either.
+func InstancePatch(nodeInfo manager.NodeInfo, region string) (patch string, err error) {
+	if nodeInfo.ID == "" || nodeInfo.Zone == "" {
+		err = errors.Errorf("need the instance ID and availability zone of node %s to set its provider ID", nodeInfo.Name)
+		return patch, err
+	}
+
+	content := map[string]interface{}{
+		"machine": map[string]interface{}{
+			"kubelet": map[string]interface{}{
+				"extraArgs": map[string]string{
+					"provider-id": ProviderID(nodeInfo.Zone, nodeInfo.ID),
+				},
+			},
+			"nodeLabels": TopologyLabels(nodeInfo, region),
+		},
+	}
+
+	patchBytes, marshalErr := yaml.Marshal(content)
+	if marshalErr != nil {
+		err = errors.Wrapf(marshalErr, "failed rendering instance patch for node %s", nodeInfo.Name)
+		return patch, err
+	}
+
+	patch = string(patchBytes)
+
+	return patch, err
+}
+
+// withInstancePatch adds the instance patch for a node to its machine config patches.  It goes last, so nothing else can change the provider ID.
+func (am *AWSClusterManager) withInstancePatch(nodeInfo manager.NodeInfo, machineConfigPatches []string) (patches []string, err error) {
+	instancePatch, patchErr := InstancePatch(nodeInfo, am.Config.Region)
+	if patchErr != nil {
+		err = patchErr
+		return patches, err
+	}
+
+	patches = make([]string, 0, len(machineConfigPatches)+1)
+	patches = append(patches, machineConfigPatches...)
+	patches = append(patches, instancePatch)
+
+	return patches, err
+}
+
+// NodeInstancePatch returns the instance patch for a running node, as ApplyNodeConfig adds it.  found is false if the node has no running instance.
+func (am *AWSClusterManager) NodeInstancePatch(nodeName string) (patch string, found bool, err error) {
+	nodeInfo, getErr := am.GetNode(nodeName)
+	if getErr != nil {
+		err = errors.Wrapf(getErr, "failed getting node %s", nodeName)
+		return patch, found, err
+	}
+
+	if nodeInfo.ID == "" {
+		return patch, found, err
+	}
+
+	found = true
+
+	patch, err = InstancePatch(nodeInfo, am.Config.Region)
+
+	return patch, found, err
+}
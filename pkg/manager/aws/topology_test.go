@@ -0,0 +1,132 @@
+package aws
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+func TestProviderID(t *testing.T) {
+	providerID := ProviderID("us-east-1a", "i-0af01c0123456789a")
+	assert.Equal(t, "aws:///us-east-1a/i-0af01c0123456789a", providerID, "provider ID does not meet expectations")
+	assert.Equal(t, "i-0af01c0123456789a", InstanceIDFromProviderID(providerID), "instance ID does not meet expectations")
+}
+
+func TestInstanceCapacityType(t *testing.T) {
+	assert.Equal(t, CapacityTypeOnDemand, instanceCapacityType(types.Instance{}), "capacity type does not meet expectations")
+	assert.Equal(t, CapacityTypeSpot, instanceCapacityType(types.Instance{InstanceLifecycle: types.InstanceLifecycleTypeSpot}), "capacity type does not meet expectations")
+	assert.Equal(t, "us-east-1b", instanceZone(types.Instance{Placement: &types.Placement{AvailabilityZone: aws.String("us-east-1b")}}), "zone does not meet expectations")
+	assert.Equal(t, "", instanceZone(types.Instance{}), "zone does not meet expectations")
+}
+
+func TestInstancePatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		nodeInfo manager.NodeInfo
+		region   string
+		expected map[string]interface{}
+		errored  bool
+	}{
+		{
+			name: "full",
+			nodeInfo: manager.NodeInfo{
+				Name:         "prod-worker-1",
+				ID:           "i-0af01c0123456789a",
+				InstanceType: "m6i.large",
+				Zone:         "us-east-1a",
+				CapacityType: CapacityTypeOnDemand,
+			},
+			region: "us-east-1",
+			expected: map[string]interface{}{
+				"machine": map[string]interface{}{
+					"kubelet": map[string]interface{}{
+						"extraArgs": map[string]interface{}{
+							"provider-id": "aws:///us-east-1a/i-0af01c0123456789a",
+						},
+					},
+					"nodeLabels": map[string]interface{}{
+						LabelZone:         "us-east-1a",
+						LabelRegion:       "us-east-1",
+						LabelInstanceType: "m6i.large",
+						LabelCapacityType: CapacityTypeOnDemand,
+						LabelInstanceID:   "i-0af01c0123456789a",
+					},
+				},
+			},
+		},
+		{
+			name: "no region",
+			nodeInfo: manager.NodeInfo{
+				Name:         "prod-worker-1",
+				ID:           "i-0af01c0123456789a",
+				InstanceType: "m6i.large",
+				Zone:         "us-east-1a",
+				CapacityType: CapacityTypeSpot,
+			},
+			expected: map[string]interface{}{
+				"machine": map[string]interface{}{
+					"kubelet": map[string]interface{}{
+						"extraArgs": map[string]interface{}{
+							"provider-id": "aws:///us-east-1a/i-0af01c0123456789a",
+						},
+					},
+					"nodeLabels": map[string]interface{}{
+						LabelZone:         "us-east-1a",
+						LabelInstanceType: "m6i.large",
+						LabelCapacityType: CapacityTypeSpot,
+						LabelInstanceID:   "i-0af01c0123456789a",
+					},
+				},
+			},
+		},
+		{
+			name:     "no zone",
+			nodeInfo: manager.NodeInfo{Name: "prod-worker-1", ID: "i-0af01c0123456789a"},
+			errored:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			patch, err := InstancePatch(tc.nodeInfo, tc.region)
+			if tc.errored {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err, "unexpected error")
+
+			var actual map[string]interface{}
+			unmarshalErr := yaml.Unmarshal([]byte(patch), &actual)
+			assert.NoError(t, unmarshalErr, "patch is not valid YAML")
+			assert.Equal(t, tc.expected, actual, "patch does not meet expectations")
+		})
+	}
+}
+
+func TestNodeInstancePatch(t *testing.T) {
+	running := AWSClusterManager{
+		Ec2Client:          MockEc2ClientGetNodeOneRunningInst{},
+		FetchedNodesByName: make(map[string]manager.NodeInfo),
+		FetchedNodesById:   make(map[string]manager.NodeInfo),
+	}
+
+	patch, found, err := running.NodeInstancePatch(TestNodeName)
+	assert.NoError(t, err, "error does not meet expectations")
+	assert.True(t, found, "running node should be found")
+	assert.Contains(t, patch, ProviderID("us-east-1a", TestInstanceID), "patch does not meet expectations")
+
+	stopped := AWSClusterManager{
+		Ec2Client:          MockEc2ClientGetNodeStoppedInst{},
+		FetchedNodesByName: make(map[string]manager.NodeInfo),
+		FetchedNodesById:   make(map[string]manager.NodeInfo),
+	}
+
+	patch, found, err = stopped.NodeInstancePatch(TestNodeName)
+	assert.NoError(t, err, "error does not meet expectations")
+	assert.False(t, found, "stopped node should not be found")
+	assert.Empty(t, patch, "patch does not meet expectations")
+}
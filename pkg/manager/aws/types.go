@@ -1,6 +1,7 @@
 package aws
 
 import (
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/kubernetes"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 	"os"
@@ -15,6 +16,26 @@ type AWSNodeConfig struct {
 	BlockDeviceType    string `yaml:"block_device_type"`
 	PlacementGroupName string `yaml:"placement_group_name"`
 	Domain             string `yaml:"domain"`
+
+	// Metadata is the labels, annotations and taints every node of the role gets once it registers.
+	Metadata kubernetes.NodeMetadata `yaml:",inline"`
+
+	// Pools has more labels, annotations and taints for the nodes of each purpose, keyed by purpose.
+	Pools map[string]kubernetes.NodeMetadata `yaml:"pools"`
+}
+
+// NodeMetadataFor returns the labels, annotations and taints for a node of the given purpose: the role's, then the purpose label and taint, then the purpose's pool.
+func (c AWSNodeConfig) NodeMetadataFor(purpose string) (metadata kubernetes.NodeMetadata) {
+	metadata = c.Metadata
+
+	if purpose == "" {
+		return metadata
+	}
+
+	metadata = metadata.Merge(kubernetes.PurposeMetadata(purpose))
+	metadata = metadata.Merge(c.Pools[purpose])
+
+	return metadata
 }
 
 type AWSNode struct {
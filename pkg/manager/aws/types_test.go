@@ -2,6 +2,7 @@ package aws
 
 import (
 	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/kubernetes"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"reflect"
@@ -35,6 +36,43 @@ placement_group_name: blah
 				Domain:             "",
 			},
 		},
+		{
+			"metadata",
+			`image_id: ami-00000000000001111111
+instance_type: blarg
+labels:
+  tier: backend
+annotations:
+  example.com/owner: team-a
+taints:
+  - key: dedicated
+    value: backend
+    effect: NoExecute
+pools:
+  gpu:
+    labels:
+      accelerator: nvidia
+    taints:
+      - key: purpose
+        value: gpu
+        effect: PreferNoSchedule
+`,
+			AWSNodeConfig{
+				ImageID:      "ami-00000000000001111111",
+				InstanceType: "blarg",
+				Metadata: kubernetes.NodeMetadata{
+					Labels:      map[string]string{"tier": "backend"},
+					Annotations: map[string]string{"example.com/owner": "team-a"},
+					Taints:      []kubernetes.Taint{{Key: "dedicated", Value: "backend", Effect: "NoExecute"}},
+				},
+				Pools: map[string]kubernetes.NodeMetadata{
+					"gpu": {
+						Labels: map[string]string{"accelerator": "nvidia"},
+						Taints: []kubernetes.Taint{{Key: "purpose", Value: "gpu", Effect: "PreferNoSchedule"}},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -56,3 +94,57 @@ placement_group_name: blah
 	}
 
 }
+
+func TestNodeMetadataFor(t *testing.T) {
+	config := AWSNodeConfig{
+		Metadata: kubernetes.NodeMetadata{
+			Labels: map[string]string{"tier": "backend"},
+			Taints: []kubernetes.Taint{{Key: "dedicated", Value: "backend", Effect: "NoExecute"}},
+		},
+		Pools: map[string]kubernetes.NodeMetadata{
+			"gpu": {
+				Labels: map[string]string{"accelerator": "nvidia"},
+				Taints: []kubernetes.Taint{{Key: "purpose", Value: "gpu", Effect: "PreferNoSchedule"}},
+			},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		purpose  string
+		expected kubernetes.NodeMetadata
+	}{
+		{
+			name:     "no purpose",
+			expected: config.Metadata,
+		},
+		{
+			name:    "purpose without pool",
+			purpose: "ingress",
+			expected: kubernetes.NodeMetadata{
+				Labels: map[string]string{"tier": "backend", "purpose": "ingress"},
+				Taints: []kubernetes.Taint{
+					{Key: "dedicated", Value: "backend", Effect: "NoExecute"},
+					{Key: "purpose", Value: "ingress", Effect: "NoSchedule"},
+				},
+			},
+		},
+		{
+			name:    "pool overrides purpose taint",
+			purpose: "gpu",
+			expected: kubernetes.NodeMetadata{
+				Labels: map[string]string{"tier": "backend", "purpose": "gpu", "accelerator": "nvidia"},
+				Taints: []kubernetes.Taint{
+					{Key: "dedicated", Value: "backend", Effect: "NoExecute"},
+					{Key: "purpose", Value: "gpu", Effect: "PreferNoSchedule"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, config.NodeMetadataFor(tc.purpose), "node metadata does not meet expectations")
+		})
+	}
+}
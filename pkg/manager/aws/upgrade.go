@@ -0,0 +1,189 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/kubernetes"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager/talos"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// UpgradeNode upgrades Talos on a node to the given installer image, and waits for the node to reboot, and come back running the new version and Ready in Kubernetes.  Nodes already running the version are skipped unless force is set.
+func (am *AWSClusterManager) UpgradeNode(nodeName string, image string, timeout time.Duration, force bool) (err error) {
+	// Make sure the Kubernetes we wait on is this cluster's.
+	err = am.VerifyClusterIdentity()
+	if err != nil {
+		return err
+	}
+
+	version := talos.ImageVersion(image)
+	if version == "" {
+		err = errors.Errorf("cannot tell the Talos version of image %s.  Images need a tag, e.g. ghcr.io/siderolabs/installer:v1.9.5", image)
+		return err
+	}
+
+	nodeInfo, getErr := am.GetNode(nodeName)
+	if getErr != nil {
+		err = errors.Wrapf(getErr, "failed getting node %s", nodeName)
+		return err
+	}
+
+	if nodeInfo.IP == "" {
+		err = errors.Errorf("no running instance found for node %s", nodeName)
+		return err
+	}
+
+	current, versionErr := talos.NodeVersion(am.Context, am.Talosconfig, nodeInfo.IP)
+	if versionErr != nil {
+		err = errors.Wrapf(versionErr, "failed getting Talos version of node %s", nodeName)
+		return err
+	}
+
+	if current == version && !force {
+		fmt.Printf("Node %s is already running Talos %s.  Skipping.\n", nodeName, version)
+		return err
+	}
+
+	// The node may well answer with the same version, and still be Ready in Kubernetes, before it goes down.  It's only back once it's booted again.
+	bootTime, bootErr := talos.NodeBootTime(am.Context, am.Talosconfig, nodeInfo.IP)
+	if bootErr != nil {
+		err = errors.Wrapf(bootErr, "failed getting boot time of node %s", nodeName)
+		return err
+	}
+
+	fmt.Printf("Upgrading node %s from Talos %s to %s\n", nodeName, current, version)
+
+	err = talos.UpgradeNode(am.Context, am.Talosconfig, nodeInfo.IP, image, am.Verbose)
+	if err != nil {
+		return err
+	}
+
+	err = talos.WaitForReboot(am.Context, am.Talosconfig, nodeInfo.IP, bootTime, timeout, am.Verbose)
+	if err != nil {
+		err = errors.Wrapf(err, "node %s did not reboot for its upgrade", nodeName)
+		return err
+	}
+
+	err = talos.WaitForVersion(am.Context, am.Talosconfig, nodeInfo.IP, version, timeout, am.Verbose)
+	if err != nil {
+		err = errors.Wrapf(err, "node %s did not come back from its upgrade", nodeName)
+		return err
+	}
+
+	err = kubernetes.WaitForNodeReady(am.Context, am.K8sClients, nodeName, timeout, am.Verbose)
+	if err != nil {
+		err = errors.Wrapf(err, "node %s did not become Ready after its upgrade", nodeName)
+		return err
+	}
+
+	fmt.Printf("Node %s is running Talos %s and Ready\n", nodeName, version)
+
+	return err
+}
+
+// UpgradeCluster upgrades every node in the cluster to the given installer image, one node at a time.  Control plane nodes go first, and etcd has to be healthy before each of them is taken down.
+func (am *AWSClusterManager) UpgradeCluster(image string, timeout time.Duration, force bool) (err error) {
+	// Make sure the control plane nodes come from this cluster's Kubernetes.
+	err = am.VerifyClusterIdentity()
+	if err != nil {
+		return err
+	}
+
+	nodes, nodesErr := am.GetNodes(am.Name)
+	if nodesErr != nil {
+		err = errors.Wrapf(nodesErr, "failed getting nodes for cluster %s", am.Name)
+		return err
+	}
+
+	cpNames, cpErr := kubernetes.ListControlPlaneNodes(am.Context, am.K8sClients, am.Verbose)
+	if cpErr != nil {
+		err = cpErr
+		return err
+	}
+
+	controlPlane, workers := SplitControlPlane(nodes, cpNames)
+
+	if len(controlPlane) == 0 {
+		err = errors.Errorf("found no control plane nodes in cluster %s", am.Name)
+		return err
+	}
+
+	cpIPs := make([]string, 0, len(controlPlane))
+	for _, node := range controlPlane {
+		cpIPs = append(cpIPs, node.IP)
+	}
+
+	for _, node := range controlPlane {
+		err = am.checkEtcd(cpIPs)
+		if err != nil {
+			err = errors.Wrapf(err, "not upgrading control plane node %s", node.Name)
+			return err
+		}
+
+		err = am.UpgradeNode(node.Name, image, timeout, force)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = am.checkEtcd(cpIPs)
+	if err != nil {
+		err = errors.Wrapf(err, "control plane upgraded, but not upgrading workers")
+		return err
+	}
+
+	for _, node := range workers {
+		err = am.UpgradeNode(node.Name, image, timeout, force)
+		if err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// checkEtcd returns an error if etcd on the given control plane nodes isn't healthy.
+func (am *AWSClusterManager) checkEtcd(cpIPs []string) (err error) {
+	health, healthErr := talos.CheckEtcdHealth(am.Context, am.Talosconfig, cpIPs, am.Verbose)
+	if healthErr != nil {
+		err = healthErr
+		return err
+	}
+
+	if !health.Healthy() {
+		err = errors.Errorf("etcd is not healthy: %s", strings.Join(health.Problems, "; "))
+		return err
+	}
+
+	manager.VerboseOutput(am.Verbose, "etcd is healthy with %d members", len(health.Members))
+
+	return err
+}
+
+// SplitControlPlane splits the running nodes into control plane nodes, named in cpNames, and workers.  Nodes without an IP, i.e. not running, are left out.
+func SplitControlPlane(nodes []manager.NodeInfo, cpNames []string) (controlPlane []manager.NodeInfo, workers []manager.NodeInfo) {
+	isCP := make(map[string]bool)
+	for _, name := range cpNames {
+		isCP[name] = true
+	}
+
+	controlPlane = make([]manager.NodeInfo, 0)
+	workers = make([]manager.NodeInfo, 0)
+
+	for _, node := range sortNodeInfoByName(nodes) {
+		if node.IP == "" {
+			continue
+		}
+
+		if isCP[node.Name] {
+			controlPlane = append(controlPlane, node)
+			continue
+		}
+
+		workers = append(workers, node)
+	}
+
+	return controlPlane, workers
+}
@@ -13,6 +13,11 @@ func prettyPrint[T any](str T) (pretty string) {
 	pretty = ""
 	//nolint:intrange // Go 1.22+ feature, maintaining compatibility with earlier versions
 	for i := 0; i < s.NumField(); i++ {
+		// Unexported fields can't be printed through reflection.
+		if !typeOf.Field(i).IsExported() {
+			continue
+		}
+
 		f := s.Field(i)
 		pretty = strings.Join([]string{pretty, fmt.Sprintf("%d: %s %s = %v\n", i,
 			typeOf.Field(i).Name, f.Type(), f.Interface())}, "")
@@ -0,0 +1,214 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// SnapshotTimeFormat is the timestamp format used in snapshot names.
+const SnapshotTimeFormat = "20060102T150405Z"
+
+// Target is somewhere backups are kept, such as a local directory or an S3 compatible bucket.
+type Target interface {
+	Put(ctx context.Context, name string, r io.Reader) (err error)
+	Get(ctx context.Context, name string) (r io.ReadCloser, err error)
+	String() (s string)
+}
+
+// SnapshotMetadata describes an etcd snapshot.  It's stored next to the snapshot as <name>.json.
+type SnapshotMetadata struct {
+	Cluster  string    `json:"cluster"`
+	Created  time.Time `json:"created"`
+	Revision int64     `json:"revision"`
+	Node     string    `json:"node"`
+	Size     int64     `json:"size"`
+	SHA256   string    `json:"sha256"`
+}
+
+// NewTarget returns the backup target for dest, which is either a local directory or an s3://bucket/prefix URL.  The S3 client is only created for s3 URLs.
+func NewTarget(dest string, s3Client func() (client S3API, err error)) (target Target, err error) {
+	if dest == "" {
+		err = errors.New("no backup destination given")
+		return target, err
+	}
+
+	if !strings.HasPrefix(dest, "s3://") {
+		target = FileTarget{Dir: dest}
+		return target, err
+	}
+
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(dest, "s3://"), "/")
+	if bucket == "" {
+		err = errors.Errorf("no bucket in backup destination %s", dest)
+		return target, err
+	}
+
+	client, clientErr := s3Client()
+	if clientErr != nil {
+		err = clientErr
+		return target, err
+	}
+
+	target = S3Target{
+		Client: client,
+		Bucket: bucket,
+		Prefix: strings.Trim(prefix, "/"),
+	}
+
+	return target, err
+}
+
+// SnapshotName is the name for a snapshot of the cluster taken at the given time, e.g. etcd-prod-20261019T120000Z.
+func SnapshotName(cluster string, t time.Time) (name string) {
+	name = fmt.Sprintf("etcd-%s-%s", cluster, t.UTC().Format(SnapshotTimeFormat))
+	return name
+}
+
+// SnapshotFile is the name the snapshot itself is stored under.
+func SnapshotFile(name string) (file string) {
+	file = fmt.Sprintf("%s.db", name)
+	return file
+}
+
+// ChecksumFile is the name the snapshot's checksum is stored under, in sha256sum format.
+func ChecksumFile(name string) (file string) {
+	file = fmt.Sprintf("%s.db.sha256", name)
+	return file
+}
+
+// MetadataFile is the name the snapshot's metadata is stored under.
+func MetadataFile(name string) (file string) {
+	file = fmt.Sprintf("%s.json", name)
+	return file
+}
+
+// FileChecksum returns the hex encoded SHA256 of the file at path, and its size.
+func FileChecksum(path string) (sum string, size int64, err error) {
+	f, openErr := os.Open(path)
+	if openErr != nil {
+		err = errors.Wrapf(openErr, "failed opening %s", path)
+		return sum, size, err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+
+	size, err = io.Copy(h, f)
+	if err != nil {
+		err = errors.Wrapf(err, "failed reading %s", path)
+		return sum, size, err
+	}
+
+	sum = hex.EncodeToString(h.Sum(nil))
+
+	return sum, size, err
+}
+
+// PutSnapshot stores the snapshot file at path in the target, along with its checksum and metadata.  The metadata goes last, so a snapshot with metadata is complete.
+func PutSnapshot(ctx context.Context, target Target, name string, path string, metadata SnapshotMetadata, verbose bool) (err error) {
+	f, openErr := os.Open(path)
+	if openErr != nil {
+		err = errors.Wrapf(openErr, "failed opening %s", path)
+		return err
+	}
+
+	defer f.Close()
+
+	manager.VerboseOutput(verbose, "Storing %s in %s", SnapshotFile(name), target)
+
+	err = target.Put(ctx, SnapshotFile(name), f)
+	if err != nil {
+		return err
+	}
+
+	checksum := fmt.Sprintf("%s  %s\n", metadata.SHA256, SnapshotFile(name))
+
+	err = target.Put(ctx, ChecksumFile(name), strings.NewReader(checksum))
+	if err != nil {
+		return err
+	}
+
+	metadataBytes, jsonErr := json.MarshalIndent(metadata, "", "  ")
+	if jsonErr != nil {
+		err = errors.Wrapf(jsonErr, "failed marshalling metadata for %s", name)
+		return err
+	}
+
+	err = target.Put(ctx, MetadataFile(name), strings.NewReader(string(metadataBytes)+"\n"))
+	if err != nil {
+		return err
+	}
+
+	return err
+}
+
+// GetSnapshot fetches the named snapshot from the target into the file at path, and checks it against the checksum in its metadata.
+func GetSnapshot(ctx context.Context, target Target, name string, path string, verbose bool) (metadata SnapshotMetadata, err error) {
+	manager.VerboseOutput(verbose, "Fetching %s from %s", MetadataFile(name), target)
+
+	mr, getErr := target.Get(ctx, MetadataFile(name))
+	if getErr != nil {
+		err = getErr
+		return metadata, err
+	}
+
+	err = json.NewDecoder(mr).Decode(&metadata)
+	_ = mr.Close()
+
+	if err != nil {
+		err = errors.Wrapf(err, "failed parsing metadata for %s", name)
+		return metadata, err
+	}
+
+	manager.VerboseOutput(verbose, "Fetching %s from %s", SnapshotFile(name), target)
+
+	sr, snapErr := target.Get(ctx, SnapshotFile(name))
+	if snapErr != nil {
+		err = snapErr
+		return metadata, err
+	}
+
+	defer sr.Close()
+
+	f, createErr := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if createErr != nil {
+		err = errors.Wrapf(createErr, "failed creating %s", path)
+		return metadata, err
+	}
+
+	_, err = io.Copy(f, sr)
+	closeErr := f.Close()
+
+	if err != nil {
+		err = errors.Wrapf(err, "failed fetching %s", SnapshotFile(name))
+		return metadata, err
+	}
+
+	if closeErr != nil {
+		err = errors.Wrapf(closeErr, "failed writing %s", path)
+		return metadata, err
+	}
+
+	sum, _, sumErr := FileChecksum(path)
+	if sumErr != nil {
+		err = sumErr
+		return metadata, err
+	}
+
+	if sum != metadata.SHA256 {
+		err = errors.Errorf("checksum mismatch for %s: expected %s, got %s", name, metadata.SHA256, sum)
+		return metadata, err
+	}
+
+	return metadata, err
+}
@@ -0,0 +1,181 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testS3 struct {
+	objects map[string][]byte
+}
+
+func (c *testS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (output *s3.PutObjectOutput, err error) {
+	body, readErr := io.ReadAll(params.Body)
+	if readErr != nil {
+		err = readErr
+		return output, err
+	}
+
+	c.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)] = body
+	output = &s3.PutObjectOutput{}
+
+	return output, err
+}
+
+func (c *testS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (output *s3.GetObjectOutput, err error) {
+	body, ok := c.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)]
+	if !ok {
+		err = errors.New("NoSuchKey")
+		return output, err
+	}
+
+	output = &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}
+
+	return output, err
+}
+
+func TestSnapshotName(t *testing.T) {
+	created := time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC)
+	assert.Equal(t, "etcd-prod-20261019T123000Z", SnapshotName("prod", created), "snapshot name does not meet expectations")
+}
+
+func TestNewTarget(t *testing.T) {
+	client := &testS3{}
+	s3Client := func() (c S3API, err error) {
+		c = client
+		return c, err
+	}
+
+	cases := []struct {
+		name   string
+		dest   string
+		target Target
+		errors bool
+	}{
+		{
+			name:   "directory",
+			dest:   "/var/backups/etcd",
+			target: FileTarget{Dir: "/var/backups/etcd"},
+		},
+		{
+			name:   "bucket",
+			dest:   "s3://backups",
+			target: S3Target{Client: client, Bucket: "backups"},
+		},
+		{
+			name:   "bucket and prefix",
+			dest:   "s3://backups/clusters/prod/",
+			target: S3Target{Client: client, Bucket: "backups", Prefix: "clusters/prod"},
+		},
+		{
+			name:   "no bucket",
+			dest:   "s3://",
+			errors: true,
+		},
+		{
+			name:   "nothing",
+			dest:   "",
+			errors: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			target, err := NewTarget(tc.dest, s3Client)
+			if tc.errors {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, tc.target, target, "target does not meet expectations")
+		})
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	snapshot := filepath.Join(dir, "snapshot.db")
+	err := os.WriteFile(snapshot, []byte("not really an etcd snapshot"), 0600)
+	if err != nil {
+		t.Fatalf("failed writing snapshot: %s", err)
+	}
+
+	sum, size, err := FileChecksum(snapshot)
+	if err != nil {
+		t.Fatalf("failed checksumming snapshot: %s", err)
+	}
+
+	metadata := SnapshotMetadata{
+		Cluster:  "prod",
+		Created:  time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC),
+		Revision: 1234,
+		Node:     "prod-cp-1",
+		Size:     size,
+		SHA256:   sum,
+	}
+
+	name := SnapshotName(metadata.Cluster, metadata.Created)
+
+	targets := []struct {
+		name   string
+		target Target
+	}{
+		{
+			name:   "file",
+			target: FileTarget{Dir: filepath.Join(dir, "backups")},
+		},
+		{
+			name:   "s3",
+			target: S3Target{Client: &testS3{objects: make(map[string][]byte)}, Bucket: "backups", Prefix: "prod"},
+		},
+	}
+
+	for _, tc := range targets {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			putErr := PutSnapshot(ctx, tc.target, name, snapshot, metadata, false)
+			if putErr != nil {
+				t.Fatalf("failed storing snapshot: %s", putErr)
+			}
+
+			checksum, getErr := tc.target.Get(ctx, ChecksumFile(name))
+			if getErr != nil {
+				t.Fatalf("failed getting checksum: %s", getErr)
+			}
+
+			checksumBytes, _ := io.ReadAll(checksum)
+			_ = checksum.Close()
+			assert.Equal(t, sum+"  "+name+".db\n", string(checksumBytes), "checksum file does not meet expectations")
+
+			restored := filepath.Join(t.TempDir(), "restored.db")
+
+			got, getErr := GetSnapshot(ctx, tc.target, name, restored, false)
+			if getErr != nil {
+				t.Fatalf("failed fetching snapshot: %s", getErr)
+			}
+
+			assert.Equal(t, metadata, got, "metadata does not meet expectations")
+
+			// A snapshot that doesn't match its checksum is refused.
+			putErr = tc.target.Put(ctx, SnapshotFile(name), bytes.NewReader([]byte("corrupted")))
+			if putErr != nil {
+				t.Fatalf("failed corrupting snapshot: %s", putErr)
+			}
+
+			_, getErr = GetSnapshot(ctx, tc.target, name, restored, false)
+			assert.Error(t, getErr, "corrupted snapshot should have been refused")
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package backup
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FileTarget keeps backups in a local directory.
+type FileTarget struct {
+	Dir string
+}
+
+// Put writes r to the file called name in the directory.  The file is written under a temporary name and renamed, so it's never seen half written.
+func (t FileTarget) Put(ctx context.Context, name string, r io.Reader) (err error) {
+	err = os.MkdirAll(t.Dir, 0700)
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating %s", t.Dir)
+		return err
+	}
+
+	path := filepath.Join(t.Dir, name)
+
+	tmp, createErr := os.CreateTemp(t.Dir, "."+name+".*")
+	if createErr != nil {
+		err = errors.Wrapf(createErr, "failed creating temp file for %s", path)
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	closeErr := tmp.Close()
+
+	if err != nil {
+		err = errors.Wrapf(err, "failed writing %s", path)
+		return err
+	}
+
+	if closeErr != nil {
+		err = errors.Wrapf(closeErr, "failed writing %s", path)
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed renaming %s to %s", tmp.Name(), path)
+		return err
+	}
+
+	return err
+}
+
+// Get opens the file called name in the directory.
+func (t FileTarget) Get(ctx context.Context, name string) (r io.ReadCloser, err error) {
+	path := filepath.Join(t.Dir, name)
+
+	r, err = os.Open(path)
+	if err != nil {
+		err = errors.Wrapf(err, "failed opening %s", path)
+		return r, err
+	}
+
+	return r, err
+}
+
+func (t FileTarget) String() (s string) {
+	s = t.Dir
+	return s
+}
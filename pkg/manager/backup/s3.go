@@ -0,0 +1,83 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/pkg/errors"
+	"io"
+	"path"
+)
+
+// S3API is the part of the S3 client used by S3Target.
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// S3Target keeps backups in an S3 compatible bucket, under an optional prefix.
+type S3Target struct {
+	Client S3API
+	Bucket string
+	Prefix string
+}
+
+// NewS3Client creates an S3 client from the AWS config.  If endpoint is given, it's used instead of AWS, with path style addressing, as most S3 compatible stores such as MinIO expect.
+func NewS3Client(cfg aws.Config, endpoint string) (client *s3.Client) {
+	client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	return client
+}
+
+// Key is the object key for the file called name.
+func (t S3Target) Key(name string) (key string) {
+	key = path.Join(t.Prefix, name)
+	return key
+}
+
+// Put uploads r as the object for name.  r should be seekable, e.g. a file, as the SDK reads it to sign the request.
+func (t S3Target) Put(ctx context.Context, name string, r io.Reader) (err error) {
+	_, err = t.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(t.Bucket),
+		Key:    aws.String(t.Key(name)),
+		Body:   r,
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed uploading %s", t.url(name))
+		return err
+	}
+
+	return err
+}
+
+// Get downloads the object for name.
+func (t S3Target) Get(ctx context.Context, name string) (r io.ReadCloser, err error) {
+	output, getErr := t.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(t.Bucket),
+		Key:    aws.String(t.Key(name)),
+	})
+	if getErr != nil {
+		err = errors.Wrapf(getErr, "failed downloading %s", t.url(name))
+		return r, err
+	}
+
+	r = output.Body
+
+	return r, err
+}
+
+func (t S3Target) String() (s string) {
+	s = fmt.Sprintf("s3://%s", path.Join(t.Bucket, t.Prefix))
+	return s
+}
+
+func (t S3Target) url(name string) (u string) {
+	u = fmt.Sprintf("s3://%s/%s", t.Bucket, t.Key(name))
+	return u
+}
@@ -8,80 +8,614 @@ import (
 	"github.com/cloudflare/cloudflare-go/v4/option"
 	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
 	"github.com/pkg/errors"
+	"net"
+	"strings"
 )
 
+// OwnershipRecordPrefix is prepended to a node's FQDN to form the name of the TXT record that marks the node's records as ours.
+const OwnershipRecordPrefix = "_k8s-cluster-manager."
+
+// OwnershipHeritage identifies records created by this tool, in the same fashion as external-dns.
+const OwnershipHeritage = "heritage=k8s-cluster-manager"
+
+// TTLAutomatic is Cloudflare's 'automatic' TTL, and the only TTL allowed on proxied records.
+const TTLAutomatic = 1
+
 type CloudFlareManager struct {
-	apiToken string
-	zoneID   string
+	apiToken    string
+	zoneID      string
+	ownerID     string
+	clusterName string
+	ttl         int
+	proxied     bool
 }
 
 func NewCloudFlareManager(zoneID, apiToken string) (manager CloudFlareManager) {
 	manager = CloudFlareManager{
 		apiToken: apiToken,
 		zoneID:   zoneID,
+		ttl:      TTLAutomatic,
+	}
+
+	return manager
+}
+
+// WithOwnerID returns a copy of the manager that writes and honors ownership TXT records for the given owner.  An empty owner disables ownership tracking.
+func (c CloudFlareManager) WithOwnerID(ownerID string) (manager CloudFlareManager) {
+	manager = c
+	manager.ownerID = ownerID
+
+	return manager
+}
+
+// WithClusterName returns a copy of the manager that identifies the cluster in the comments of the records it writes.
+func (c CloudFlareManager) WithClusterName(clusterName string) (manager CloudFlareManager) {
+	manager = c
+	manager.clusterName = clusterName
+
+	return manager
+}
+
+// WithTTL returns a copy of the manager that writes records with the given TTL in seconds.  Zero or less means automatic.
+func (c CloudFlareManager) WithTTL(ttl int) (manager CloudFlareManager) {
+	manager = c
+	manager.ttl = ttl
+
+	if manager.ttl <= 0 {
+		manager.ttl = TTLAutomatic
 	}
 
 	return manager
 }
 
+// WithProxied returns a copy of the manager that writes records proxied (or not) through Cloudflare.
+func (c CloudFlareManager) WithProxied(proxied bool) (manager CloudFlareManager) {
+	manager = c
+	manager.proxied = proxied
+
+	return manager
+}
+
+// RegisterNode creates or updates the node's address record.  IPv6 nodes get AAAA records, everything else gets an A record.  A record of the other type, left from before the node's address changed family, is removed.
 func (c CloudFlareManager) RegisterNode(ctx context.Context, node manager.ClusterNode, verbose bool) (err error) {
 	manager.VerboseOutput(verbose, "Registering DNS for node\n")
 
-	client := cloudflare.NewClient(
-		option.WithAPIToken(c.apiToken),
-	)
+	client := c.client()
 
-	aRecord := dns.ARecordParam{
-		Content: cloudflare.F(node.IP()),
-		Name:    cloudflare.F(fmt.Sprintf("%s.%s", node.Name(), node.Domain())),
-		Type:    cloudflare.F(dns.ARecordTypeA),
+	fqdn := FQDN(node.Name(), node.Domain())
+
+	recordType, newBody, updateBody := c.addressRecord(node, fqdn)
+
+	err = c.upsertRecord(ctx, client, fqdn, recordType, newBody, updateBody, verbose)
+	if err != nil {
+		err = errors.Wrapf(err, "failed setting dns record for %s", node.Name())
+		return err
 	}
 
-	params := dns.RecordNewParams{
+	// Ownership is checked before it's claimed, so a record of the other type is only removed if the name was already ours.
+	err = c.removeOtherFamily(ctx, client, fqdn, recordType, verbose)
+	if err != nil {
+		err = errors.Wrapf(err, "failed removing stale dns records for %s", node.Name())
+		return err
+	}
+
+	if c.ownerID != "" {
+		ownErr := c.claimOwnership(ctx, client, fqdn, verbose)
+		if ownErr != nil {
+			err = errors.Wrapf(ownErr, "failed setting ownership record for %s", node.Name())
+			return err
+		}
+	}
+
+	return err
+}
+
+func (c CloudFlareManager) DeregisterNode(ctx context.Context, nodeName string, domain string, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Deregistering DNS for node\n")
+
+	client := c.client()
+
+	fqdn := FQDN(nodeName, domain)
+
+	var ownershipRecords []dns.RecordResponse
+
+	// If we're tracking ownership, refuse to touch anything we can't prove we created.
+	if c.ownerID != "" {
+		var ownErr error
+		ownershipRecords, ownErr = c.listRecords(ctx, client, OwnershipRecordName(fqdn), dns.RecordListParamsTypeTXT)
+		if ownErr != nil {
+			err = errors.Wrapf(ownErr, "failed listing ownership records for %s", fqdn)
+			return err
+		}
+
+		if !OwnedBy(ownershipRecords, c.ownerID) {
+			fmt.Printf("Warning: DNS records for %s are not owned by %s.  Leaving them in place.\n", fqdn, c.ownerID)
+			return err
+		}
+	}
+
+	records := make([]dns.RecordResponse, 0)
+
+	for _, recordType := range []dns.RecordListParamsType{dns.RecordListParamsTypeA, dns.RecordListParamsTypeAAAA} {
+		typeRecords, listErr := c.listRecords(ctx, client, fqdn, recordType)
+		if listErr != nil {
+			err = errors.Wrapf(listErr, "failed listing DNS records in zone.")
+			return err
+		}
+
+		records = append(records, typeRecords...)
+	}
+
+	records = append(records, ownershipRecords...)
+
+	deleteParams := dns.RecordDeleteParams{
 		ZoneID: cloudflare.F(c.zoneID),
-		Body:   aRecord,
 	}
 
-	_, err = client.DNS.Records.New(ctx, params)
+	for _, record := range records {
+		manager.VerboseOutput(verbose, "Deleting %s record %s (%s)\n", record.Type, record.Name, record.Content)
+		_, err = client.DNS.Records.Delete(ctx, record.ID, deleteParams)
+		if err != nil {
+			err = errors.Wrapf(err, "failed deleting DNS record %s for %s", record.ID, record.Name)
+			return err
+		}
+	}
+
+	return err
+}
+
+// UpsertAlias points name at target with a CNAME record, creating or updating it as needed.
+func (c CloudFlareManager) UpsertAlias(ctx context.Context, name string, target string, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Pointing %s at %s\n", name, target)
+
+	client := c.client()
+
+	record := dns.CNAMERecordParam{
+		Content: cloudflare.F(target),
+		Name:    cloudflare.F(name),
+		Type:    cloudflare.F(dns.CNAMERecordTypeCNAME),
+		TTL:     cloudflare.F(dns.TTL(c.ttl)),
+		Proxied: cloudflare.F(c.proxied),
+		Comment: cloudflare.F(RecordComment(c.clusterName, "")),
+	}
+
+	err = c.upsertRecord(ctx, client, name, dns.RecordListParamsTypeCNAME, record, record, verbose)
 	if err != nil {
-		err = errors.Wrapf(err, "failed setting dns record for %s", node.Name())
+		err = errors.Wrapf(err, "failed setting dns record for %s", name)
 		return err
 	}
 
+	if c.ownerID != "" {
+		ownErr := c.claimOwnership(ctx, client, name, verbose)
+		if ownErr != nil {
+			err = errors.Wrapf(ownErr, "failed setting ownership record for %s", name)
+			return err
+		}
+	}
+
 	return err
 }
 
-func (c CloudFlareManager) DeregisterNode(ctx context.Context, nodeName string, verbose bool) (err error) {
-	manager.VerboseOutput(verbose, "Deregistering DNS for node\n")
+// LookupAlias returns the target of the CNAME record at name, or an empty string if there isn't one.
+func (c CloudFlareManager) LookupAlias(ctx context.Context, name string, verbose bool) (target string, err error) {
+	manager.VerboseOutput(verbose, "Looking up %s\n", name)
+
+	records, listErr := c.listRecords(ctx, c.client(), name, dns.RecordListParamsTypeCNAME)
+	if listErr != nil {
+		err = errors.Wrapf(listErr, "failed looking up %s", name)
+		return target, err
+	}
+
+	if len(records) > 0 {
+		target = records[0].Content
+	}
 
-	client := cloudflare.NewClient(
+	return target, err
+}
+
+func (c CloudFlareManager) client() (client *cloudflare.Client) {
+	client = cloudflare.NewClient(
 		option.WithAPIToken(c.apiToken),
 	)
 
-	listParams := dns.RecordListParams{
-		ZoneID: cloudflare.F(c.zoneID),
-		Name: cloudflare.F(dns.RecordListParamsName{
-			Contains: cloudflare.F(nodeName),
-		}),
+	return client
+}
+
+// addressRecord builds the A or AAAA record for the node, depending on the flavor of its IP.
+func (c CloudFlareManager) addressRecord(node manager.ClusterNode, fqdn string) (recordType dns.RecordListParamsType, newBody dns.RecordNewParamsBodyUnion, updateBody dns.RecordUpdateParamsBodyUnion) {
+	comment := RecordComment(c.clusterName, node.ID())
+
+	if IsIPv6(node.IP()) {
+		record := dns.AAAARecordParam{
+			Content: cloudflare.F(node.IP()),
+			Name:    cloudflare.F(fqdn),
+			Type:    cloudflare.F(dns.AAAARecordTypeAAAA),
+			TTL:     cloudflare.F(dns.TTL(c.ttl)),
+			Proxied: cloudflare.F(c.proxied),
+			Comment: cloudflare.F(comment),
+		}
+
+		recordType = dns.RecordListParamsTypeAAAA
+		newBody = record
+		updateBody = record
+
+		return recordType, newBody, updateBody
+	}
+
+	record := dns.ARecordParam{
+		Content: cloudflare.F(node.IP()),
+		Name:    cloudflare.F(fqdn),
+		Type:    cloudflare.F(dns.ARecordTypeA),
+		TTL:     cloudflare.F(dns.TTL(c.ttl)),
+		Proxied: cloudflare.F(c.proxied),
+		Comment: cloudflare.F(comment),
 	}
 
-	resp, listErr := client.DNS.Records.List(ctx, listParams)
+	recordType = dns.RecordListParamsTypeA
+	newBody = record
+	updateBody = record
+
+	return recordType, newBody, updateBody
+}
+
+// upsertRecord updates the existing record of the given type and name if there is one, and creates it otherwise.  Duplicates left behind by earlier runs are removed.
+func (c CloudFlareManager) upsertRecord(ctx context.Context, client *cloudflare.Client, name string, recordType dns.RecordListParamsType, newBody dns.RecordNewParamsBodyUnion, updateBody dns.RecordUpdateParamsBodyUnion, verbose bool) (err error) {
+	existing, listErr := c.listRecords(ctx, client, name, recordType)
 	if listErr != nil {
 		err = errors.Wrapf(listErr, "failed listing DNS records in zone.")
 		return err
 	}
 
+	if len(existing) == 0 {
+		manager.VerboseOutput(verbose, "Creating %s record %s\n", recordType, name)
+
+		newParams := dns.RecordNewParams{
+			ZoneID: cloudflare.F(c.zoneID),
+			Body:   newBody,
+		}
+
+		_, err = client.DNS.Records.New(ctx, newParams)
+		if err != nil {
+			err = errors.Wrapf(err, "failed creating %s record %s", recordType, name)
+			return err
+		}
+
+		return err
+	}
+
+	// Don't overwrite somebody else's record.
+	if c.ownerID != "" {
+		ownershipRecords, ownErr := c.listRecords(ctx, client, OwnershipRecordName(name), dns.RecordListParamsTypeTXT)
+		if ownErr != nil {
+			err = errors.Wrapf(ownErr, "failed listing ownership records for %s", name)
+			return err
+		}
+
+		if !OwnedBy(ownershipRecords, c.ownerID) {
+			err = errors.Errorf("%s record %s exists, but is not owned by %s", recordType, name, c.ownerID)
+			return err
+		}
+	}
+
+	manager.VerboseOutput(verbose, "Updating %s record %s (%s)\n", recordType, name, existing[0].ID)
+
+	updateParams := dns.RecordUpdateParams{
+		ZoneID: cloudflare.F(c.zoneID),
+		Body:   updateBody,
+	}
+
+	_, err = client.DNS.Records.Update(ctx, existing[0].ID, updateParams)
+	if err != nil {
+		err = errors.Wrapf(err, "failed updating %s record %s", recordType, name)
+		return err
+	}
+
 	deleteParams := dns.RecordDeleteParams{
 		ZoneID: cloudflare.F(c.zoneID),
 	}
 
-	for _, record := range resp.Result {
+	for _, record := range existing[1:] {
+		manager.VerboseOutput(verbose, "Deleting duplicate %s record %s (%s)\n", record.Type, record.Name, record.Content)
 		_, err = client.DNS.Records.Delete(ctx, record.ID, deleteParams)
 		if err != nil {
-			err = errors.Wrapf(err, "failed deleting DNS record %s for %s", record.ID, record.Name)
+			err = errors.Wrapf(err, "failed deleting duplicate DNS record %s for %s", record.ID, record.Name)
 			return err
 		}
 	}
 
 	return err
 }
+
+// removeOtherFamily deletes the name's address records of the other IP family than recordType, left behind when a node's address changes from IPv4 to IPv6 or back.  If the manager has an owner, they're only deleted when the name is owned by it.
+func (c CloudFlareManager) removeOtherFamily(ctx context.Context, client *cloudflare.Client, name string, recordType dns.RecordListParamsType, verbose bool) (err error) {
+	otherType := OtherAddressType(recordType)
+
+	stale, listErr := c.listRecords(ctx, client, name, otherType)
+	if listErr != nil {
+		err = errors.Wrapf(listErr, "failed listing %s records for %s", otherType, name)
+		return err
+	}
+
+	if len(stale) == 0 {
+		return err
+	}
+
+	if c.ownerID != "" {
+		ownershipRecords, ownErr := c.listRecords(ctx, client, OwnershipRecordName(name), dns.RecordListParamsTypeTXT)
+		if ownErr != nil {
+			err = errors.Wrapf(ownErr, "failed listing ownership records for %s", name)
+			return err
+		}
+
+		if !OwnedBy(ownershipRecords, c.ownerID) {
+			fmt.Printf("Warning: %s records for %s are not owned by %s.  Leaving them in place.\n", otherType, name, c.ownerID)
+			return err
+		}
+	}
+
+	deleteParams := dns.RecordDeleteParams{
+		ZoneID: cloudflare.F(c.zoneID),
+	}
+
+	for _, record := range stale {
+		manager.VerboseOutput(verbose, "Deleting stale %s record %s (%s)\n", record.Type, record.Name, record.Content)
+		_, err = client.DNS.Records.Delete(ctx, record.ID, deleteParams)
+		if err != nil {
+			err = errors.Wrapf(err, "failed deleting stale DNS record %s for %s", record.ID, record.Name)
+			return err
+		}
+	}
+
+	return err
+}
+
+// OtherAddressType returns the address record type for the other IP family: AAAA for A, and A for AAAA.
+func OtherAddressType(recordType dns.RecordListParamsType) (otherType dns.RecordListParamsType) {
+	otherType = dns.RecordListParamsTypeA
+	if recordType == dns.RecordListParamsTypeA {
+		otherType = dns.RecordListParamsTypeAAAA
+	}
+
+	return otherType
+}
+
+// ListRecords returns every A and AAAA record in the zone under domain.  An empty domain lists the whole zone.  If the manager has an owner, records with an ownership record for it are marked Owned.
+func (c CloudFlareManager) ListRecords(ctx context.Context, domain string, verbose bool) (records []manager.DNSRecord, err error) {
+	manager.VerboseOutput(verbose, "Listing DNS records under %q\n", domain)
+
+	records = make([]manager.DNSRecord, 0)
+
+	client := c.client()
+
+	domain = strings.Trim(domain, ".")
+
+	for _, recordType := range []dns.RecordListParamsType{dns.RecordListParamsTypeA, dns.RecordListParamsTypeAAAA} {
+		listParams := dns.RecordListParams{
+			ZoneID: cloudflare.F(c.zoneID),
+			Type:   cloudflare.F(recordType),
+		}
+
+		if domain != "" {
+			listParams.Name = cloudflare.F(dns.RecordListParamsName{
+				Endswith: cloudflare.F("." + domain),
+			})
+		}
+
+		typeRecords, listErr := pageRecords(ctx, client, listParams)
+		if listErr != nil {
+			err = errors.Wrapf(listErr, "failed listing %s records under %q", recordType, domain)
+			return records, err
+		}
+
+		for _, record := range typeRecords {
+			records = append(records, manager.DNSRecord{
+				ID:      record.ID,
+				Name:    record.Name,
+				Type:    string(record.Type),
+				Content: record.Content,
+				Comment: record.Comment,
+			})
+		}
+	}
+
+	if c.ownerID == "" {
+		return records, err
+	}
+
+	owned, ownedErr := c.ownedNames(ctx, client, domain)
+	if ownedErr != nil {
+		err = ownedErr
+		return records, err
+	}
+
+	for i := range records {
+		records[i].Owned = owned[strings.ToLower(records[i].Name)]
+	}
+
+	return records, err
+}
+
+// ownedNames returns the lower cased names under domain that have an ownership record for this manager's owner.
+func (c CloudFlareManager) ownedNames(ctx context.Context, client *cloudflare.Client, domain string) (owned map[string]bool, err error) {
+	owned = make(map[string]bool)
+
+	name := dns.RecordListParamsName{
+		Startswith: cloudflare.F(OwnershipRecordPrefix),
+	}
+
+	if domain != "" {
+		name.Endswith = cloudflare.F("." + domain)
+	}
+
+	listParams := dns.RecordListParams{
+		ZoneID: cloudflare.F(c.zoneID),
+		Name:   cloudflare.F(name),
+		Type:   cloudflare.F(dns.RecordListParamsTypeTXT),
+	}
+
+	ownershipRecords, listErr := pageRecords(ctx, client, listParams)
+	if listErr != nil {
+		err = errors.Wrapf(listErr, "failed listing ownership records under %q", domain)
+		return owned, err
+	}
+
+	for _, record := range ownershipRecords {
+		recordName := strings.ToLower(record.Name)
+		if !strings.HasPrefix(recordName, OwnershipRecordPrefix) {
+			continue
+		}
+
+		if OwnedBy([]dns.RecordResponse{record}, c.ownerID) {
+			owned[strings.TrimPrefix(recordName, OwnershipRecordPrefix)] = true
+		}
+	}
+
+	return owned, err
+}
+
+// listRecords returns every record of the given type whose name exactly matches name, following pagination.
+func (c CloudFlareManager) listRecords(ctx context.Context, client *cloudflare.Client, name string, recordType dns.RecordListParamsType) (records []dns.RecordResponse, err error) {
+	records = make([]dns.RecordResponse, 0)
+
+	listParams := dns.RecordListParams{
+		ZoneID: cloudflare.F(c.zoneID),
+		Name: cloudflare.F(dns.RecordListParamsName{
+			Exact: cloudflare.F(name),
+		}),
+		Type: cloudflare.F(recordType),
+	}
+
+	found, listErr := pageRecords(ctx, client, listParams)
+	if listErr != nil {
+		err = errors.Wrapf(listErr, "failed listing %s records for %s", recordType, name)
+		return records, err
+	}
+
+	for _, record := range found {
+		// The API filter is case-insensitive, and we want to be very sure before we touch anything.
+		if !strings.EqualFold(record.Name, name) {
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	return records, err
+}
+
+// pageRecords runs the list query, following pagination to the end.
+func pageRecords(ctx context.Context, client *cloudflare.Client, listParams dns.RecordListParams) (records []dns.RecordResponse, err error) {
+	records = make([]dns.RecordResponse, 0)
+
+	iter := client.DNS.Records.ListAutoPaging(ctx, listParams)
+	for iter.Next() {
+		records = append(records, iter.Current())
+	}
+
+	err = iter.Err()
+
+	return records, err
+}
+
+// claimOwnership creates the ownership TXT record for fqdn, unless one already exists for this owner.
+func (c CloudFlareManager) claimOwnership(ctx context.Context, client *cloudflare.Client, fqdn string, verbose bool) (err error) {
+	ownerName := OwnershipRecordName(fqdn)
+
+	existing, listErr := c.listRecords(ctx, client, ownerName, dns.RecordListParamsTypeTXT)
+	if listErr != nil {
+		err = errors.Wrapf(listErr, "failed listing ownership records for %s", fqdn)
+		return err
+	}
+
+	if OwnedBy(existing, c.ownerID) {
+		return err
+	}
+
+	manager.VerboseOutput(verbose, "Creating ownership record %s\n", ownerName)
+
+	txtRecord := dns.TXTRecordParam{
+		Content: cloudflare.F(OwnershipContent(c.ownerID)),
+		Name:    cloudflare.F(ownerName),
+		Type:    cloudflare.F(dns.TXTRecordTypeTXT),
+		TTL:     cloudflare.F(dns.TTL(c.ttl)),
+	}
+
+	params := dns.RecordNewParams{
+		ZoneID: cloudflare.F(c.zoneID),
+		Body:   txtRecord,
+	}
+
+	_, err = client.DNS.Records.New(ctx, params)
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating ownership record %s", ownerName)
+		return err
+	}
+
+	return err
+}
+
+// FQDN builds the fully qualified record name for a node.  Names that already carry the domain are returned unchanged.
+func FQDN(name string, domain string) (fqdn string) {
+	name = strings.TrimSuffix(name, ".")
+	domain = strings.Trim(domain, ".")
+
+	if domain == "" || strings.HasSuffix(name, "."+domain) {
+		fqdn = name
+		return fqdn
+	}
+
+	fqdn = fmt.Sprintf("%s.%s", name, domain)
+
+	return fqdn
+}
+
+// OwnershipRecordName returns the name of the ownership TXT record for fqdn.
+func OwnershipRecordName(fqdn string) (name string) {
+	name = OwnershipRecordPrefix + fqdn
+	return name
+}
+
+// OwnershipContent returns the content of an ownership TXT record for the given owner.
+func OwnershipContent(ownerID string) (content string) {
+	content = fmt.Sprintf("\"%s,k8s-cluster-manager/owner=%s\"", OwnershipHeritage, ownerID)
+	return content
+}
+
+// OwnedBy reports whether any of the TXT records marks the name as belonging to ownerID.
+func OwnedBy(records []dns.RecordResponse, ownerID string) (owned bool) {
+	expected := strings.Trim(OwnershipContent(ownerID), "\"")
+
+	for _, record := range records {
+		if strings.Trim(record.Content, "\"") == expected {
+			owned = true
+			return owned
+		}
+	}
+
+	return owned
+}
+
+// RecordComment returns the comment attached to a node's record, identifying the cluster and instance behind it.
+func RecordComment(clusterName string, instanceID string) (comment string) {
+	parts := []string{"k8s-cluster-manager"}
+
+	if clusterName != "" {
+		parts = append(parts, "cluster="+clusterName)
+	}
+
+	if instanceID != "" {
+		parts = append(parts, "instance="+instanceID)
+	}
+
+	comment = strings.Join(parts, " ")
+
+	return comment
+}
+
+// IsIPv6 reports whether ip is an IPv6 address.
+func IsIPv6(ip string) (isV6 bool) {
+	parsed := net.ParseIP(ip)
+	isV6 = parsed != nil && parsed.To4() == nil
+
+	return isV6
+}
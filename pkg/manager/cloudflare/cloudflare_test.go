@@ -0,0 +1,154 @@
+package cloudflare
+
+import (
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFQDN(t *testing.T) {
+	cases := []struct {
+		name     string
+		node     string
+		domain   string
+		expected string
+	}{
+		{
+			"plain",
+			"prod-worker-1",
+			"example.com",
+			"prod-worker-1.example.com",
+		},
+		{
+			"already qualified",
+			"prod-worker-1.example.com",
+			"example.com",
+			"prod-worker-1.example.com",
+		},
+		{
+			"no domain",
+			"prod-worker-1",
+			"",
+			"prod-worker-1",
+		},
+		{
+			"dotted domain",
+			"prod-worker-1",
+			".example.com.",
+			"prod-worker-1.example.com",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := FQDN(tc.node, tc.domain)
+			assert.Equal(t, tc.expected, actual, "FQDN does not meet expectations")
+		})
+	}
+}
+
+func TestOwnedBy(t *testing.T) {
+	cases := []struct {
+		name     string
+		records  []dns.RecordResponse
+		owner    string
+		expected bool
+	}{
+		{
+			"owned",
+			[]dns.RecordResponse{{Content: OwnershipContent("prod")}},
+			"prod",
+			true,
+		},
+		{
+			"owned unquoted",
+			[]dns.RecordResponse{{Content: "heritage=k8s-cluster-manager,k8s-cluster-manager/owner=prod"}},
+			"prod",
+			true,
+		},
+		{
+			"other owner",
+			[]dns.RecordResponse{{Content: OwnershipContent("staging")}},
+			"prod",
+			false,
+		},
+		{
+			"owner prefix",
+			[]dns.RecordResponse{{Content: OwnershipContent("prod-2")}},
+			"prod",
+			false,
+		},
+		{
+			"no records",
+			[]dns.RecordResponse{},
+			"prod",
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := OwnedBy(tc.records, tc.owner)
+			assert.Equal(t, tc.expected, actual, "ownership does not meet expectations")
+		})
+	}
+}
+
+func TestRecordComment(t *testing.T) {
+	cases := []struct {
+		name       string
+		cluster    string
+		instanceID string
+		expected   string
+	}{
+		{
+			"full",
+			"prod",
+			"i-0af01c0123456789a",
+			"k8s-cluster-manager cluster=prod instance=i-0af01c0123456789a",
+		},
+		{
+			"no instance",
+			"prod",
+			"",
+			"k8s-cluster-manager cluster=prod",
+		},
+		{
+			"nothing",
+			"",
+			"",
+			"k8s-cluster-manager",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := RecordComment(tc.cluster, tc.instanceID)
+			assert.Equal(t, tc.expected, actual, "comment does not meet expectations")
+		})
+	}
+}
+
+func TestIsIPv6(t *testing.T) {
+	cases := []struct {
+		ip       string
+		expected bool
+	}{
+		{"10.0.1.23", false},
+		{"::ffff:10.0.1.23", false},
+		{"2600:1f18:abcd::1", true},
+		{"garbage", false},
+		{"", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.ip, func(t *testing.T) {
+			assert.Equal(t, tc.expected, IsIPv6(tc.ip), "IPv6 detection does not meet expectations")
+		})
+	}
+}
+
+func TestOtherAddressType(t *testing.T) {
+	assert.Equal(t, dns.RecordListParamsTypeAAAA, OtherAddressType(dns.RecordListParamsTypeA), "other type for A does not meet expectations")
+	assert.Equal(t, dns.RecordListParamsTypeA, OtherAddressType(dns.RecordListParamsTypeAAAA), "other type for AAAA does not meet expectations")
+}
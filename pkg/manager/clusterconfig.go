@@ -0,0 +1,79 @@
+package manager
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+const LBTypeAPIServer = "apiserver"
+const LBTypeIngressInt = "int"
+const LBTypeIngressExt = "ext"
+
+// ClusterConfig holds settings that apply to the cluster as a whole, rather than to any one node.
+type ClusterConfig struct {
+	DNS ClusterDNSConfig `yaml:"dns"`
+}
+
+// ClusterDNSConfig names the DNS records pointing at the cluster's load balancers.  Empty names are not managed.
+type ClusterDNSConfig struct {
+	APIServer  string `yaml:"apiserver"`
+	IngressInt string `yaml:"ingress_int"`
+	IngressExt string `yaml:"ingress_ext"`
+}
+
+// ClusterRecord is a cluster level DNS record pointing at a load balancer.
+type ClusterRecord struct {
+	Name    string // FQDN of the record
+	LBType  string // apiserver, int, or ext
+	LBName  string // Name of the load balancer
+	Target  string // DNS name of the load balancer
+	Current string // What the record points to right now.  Empty if it doesn't exist.
+}
+
+// InSync reports whether the record currently points at its load balancer.
+func (r ClusterRecord) InSync() (inSync bool) {
+	inSync = r.Current != "" && r.Current == r.Target
+	return inSync
+}
+
+// NameFor returns the record name configured for the given type of load balancer.
+func (c ClusterDNSConfig) NameFor(lbType string) (name string) {
+	switch lbType {
+	case LBTypeAPIServer:
+		name = c.APIServer
+	case LBTypeIngressInt:
+		name = c.IngressInt
+	case LBTypeIngressExt:
+		name = c.IngressExt
+	}
+
+	return name
+}
+
+// Empty reports whether no cluster records are configured.
+func (c ClusterDNSConfig) Empty() (empty bool) {
+	empty = c.APIServer == "" && c.IngressInt == "" && c.IngressExt == ""
+	return empty
+}
+
+func LoadClusterConfigFromFile(filePath string) (config ClusterConfig, err error) {
+	configBytes, readErr := os.ReadFile(filePath)
+	if readErr != nil {
+		err = errors.Wrapf(readErr, "failed reading file %s", filePath)
+		return config, err
+	}
+
+	config, err = LoadClusterConfig(configBytes)
+	return config, err
+}
+
+func LoadClusterConfig(data []byte) (config ClusterConfig, err error) {
+	unmarshalErr := yaml.Unmarshal(data, &config)
+	if unmarshalErr != nil {
+		err = errors.Wrapf(unmarshalErr, "failed unmarshalling data into struct")
+		return config, err
+	}
+
+	return config, err
+}
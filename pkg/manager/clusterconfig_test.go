@@ -0,0 +1,29 @@
+package manager
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLoadClusterConfig(t *testing.T) {
+	input := `dns:
+  apiserver: api.prod.example.com
+  ingress_int: ingress.prod.example.com
+`
+	expected := ClusterConfig{
+		DNS: ClusterDNSConfig{
+			APIServer:  "api.prod.example.com",
+			IngressInt: "ingress.prod.example.com",
+		},
+	}
+
+	actual, err := LoadClusterConfig([]byte(input))
+	if err != nil {
+		t.Errorf("failed loading cluster config: %s", err)
+	}
+
+	assert.Equal(t, expected, actual, "Loaded config fails to meet expectations.")
+	assert.Equal(t, "api.prod.example.com", actual.DNS.NameFor(LBTypeAPIServer))
+	assert.Empty(t, actual.DNS.NameFor(LBTypeIngressExt))
+	assert.False(t, actual.DNS.Empty())
+}
@@ -0,0 +1,66 @@
+package kubernetes
+
+import (
+	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"time"
+)
+
+// APIServerPollInterval is how often the apiserver is checked while waiting for it.
+const APIServerPollInterval = 10 * time.Second
+
+// KubeconfigServer returns the apiserver URL the kubeconfig's current context points at.
+func KubeconfigServer(kubeconfig []byte) (server string, err error) {
+	restConfig, restErr := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if restErr != nil {
+		err = errors.Wrapf(restErr, "failed parsing kubeconfig")
+		return server, err
+	}
+
+	server = restConfig.Host
+
+	return server, err
+}
+
+// WaitForAPIServer waits for the apiserver in the kubeconfig to report itself ready.  The apiserver's certificate is verified with the CA in the kubeconfig.
+func WaitForAPIServer(ctx context.Context, kubeconfig []byte, timeout time.Duration, verbose bool) (err error) {
+	restConfig, restErr := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if restErr != nil {
+		err = errors.Wrapf(restErr, "failed parsing kubeconfig")
+		return err
+	}
+
+	clientSet, csErr := kubernetes.NewForConfig(restConfig)
+	if csErr != nil {
+		err = errors.Wrapf(csErr, "failed creating k8s client for %s", restConfig.Host)
+		return err
+	}
+
+	manager.VerboseOutput(verbose, "Waiting for the apiserver at %s (timeout: %v)\n", restConfig.Host, timeout)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(APIServerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeoutCtx.Done():
+			err = errors.Errorf("timeout waiting for the apiserver at %s after %v", restConfig.Host, timeout)
+			return err
+		case <-ticker.C:
+			_, readyErr := clientSet.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(timeoutCtx)
+			if readyErr != nil {
+				manager.VerboseOutput(verbose, "Apiserver at %s not ready yet: %s\n", restConfig.Host, readyErr)
+				continue
+			}
+
+			manager.VerboseOutput(verbose, "Apiserver at %s is ready\n", restConfig.Host)
+			return err
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package kubernetes
+
+import (
+	"fmt"
+	k8s_utility_client "github.com/nikogura/k8s-utility-client/pkg/k8s-utility-client"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// NewClients creates the Kubernetes clients for a cluster from its kubeconfig.  kubeContext picks the context to use.  If it's empty, the kubeconfig's current context is used.
+func NewClients(kubeconfig []byte, kubeContext string) (clients *k8s_utility_client.K8sClients, err error) {
+	apiConfig, loadErr := clientcmd.Load(kubeconfig)
+	if loadErr != nil {
+		err = errors.Wrapf(loadErr, "failed parsing kubeconfig")
+		return clients, err
+	}
+
+	if kubeContext == "" {
+		kubeContext = apiConfig.CurrentContext
+	}
+
+	contextConfig, ok := apiConfig.Contexts[kubeContext]
+	if !ok {
+		err = errors.Errorf("kubeconfig has no context %q", kubeContext)
+		return clients, err
+	}
+
+	restConfig, restErr := clientcmd.NewNonInteractiveClientConfig(*apiConfig, kubeContext, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if restErr != nil {
+		err = errors.Wrapf(restErr, "failed creating k8s client config for context %s", kubeContext)
+		return clients, err
+	}
+
+	clientSet, csErr := kubernetes.NewForConfig(restConfig)
+	if csErr != nil {
+		err = errors.Wrapf(csErr, "failed creating k8s clientset")
+		return clients, err
+	}
+
+	dynamicClient, dcErr := dynamic.NewForConfig(restConfig)
+	if dcErr != nil {
+		err = errors.Wrapf(dcErr, "failed creating k8s dynamic client")
+		return clients, err
+	}
+
+	namespace := contextConfig.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	clients = &k8s_utility_client.K8sClients{
+		ClientSet:     clientSet,
+		DynamicClient: dynamicClient,
+		K8SConfig:     restConfig,
+		Namespace:     namespace,
+	}
+
+	return clients, err
+}
+
+// ClusterContextNames are the names a kubeconfig context for the cluster may have: the cluster's name, or admin@<cluster> as Talos names it.
+func ClusterContextNames(clusterName string) (names []string) {
+	names = []string{clusterName, fmt.Sprintf("admin@%s", clusterName)}
+	return names
+}
+
+// ClusterContext finds the context for the cluster in a kubeconfig that may hold many clusters, such as ~/.kube/config.  Only contexts named for the cluster count.  The current context is never assumed to be the right one.
+func ClusterContext(kubeconfig []byte, clusterName string) (kubeContext string, found bool, err error) {
+	apiConfig, loadErr := clientcmd.Load(kubeconfig)
+	if loadErr != nil {
+		err = errors.Wrapf(loadErr, "failed parsing kubeconfig")
+		return kubeContext, found, err
+	}
+
+	for _, name := range ClusterContextNames(clusterName) {
+		_, found = apiConfig.Contexts[name]
+		if found {
+			kubeContext = name
+			return kubeContext, found, err
+		}
+	}
+
+	return kubeContext, found, err
+}
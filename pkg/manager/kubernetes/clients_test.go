@@ -0,0 +1,95 @@
+package kubernetes
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+  - name: prod
+    cluster:
+      server: https://api.prod.some.domain:6443
+  - name: staging
+    cluster:
+      server: https://api.staging.some.domain:6443
+contexts:
+  - name: admin@prod
+    context:
+      cluster: prod
+      user: admin@prod
+      namespace: kube-system
+  - name: staging
+    context:
+      cluster: staging
+      user: admin@staging
+current-context: staging
+users:
+  - name: admin@prod
+    user:
+      token: prod-token
+  - name: admin@staging
+    user:
+      token: staging-token
+`
+
+func TestClusterContext(t *testing.T) {
+	cases := []struct {
+		name    string
+		cluster string
+		context string
+		found   bool
+	}{
+		{
+			name:    "talos style name",
+			cluster: "prod",
+			context: "admin@prod",
+			found:   true,
+		},
+		{
+			name:    "plain name",
+			cluster: "staging",
+			context: "staging",
+			found:   true,
+		},
+		{
+			name:    "not there",
+			cluster: "dev",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			kubeContext, found, err := ClusterContext([]byte(testKubeconfig), tc.cluster)
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, tc.found, found, "found does not meet expectations")
+			assert.Equal(t, tc.context, kubeContext, "context does not meet expectations")
+		})
+	}
+}
+
+func TestNewClients(t *testing.T) {
+	clients, err := NewClients([]byte(testKubeconfig), "admin@prod")
+	if err != nil {
+		t.Fatalf("failed creating clients: %s", err)
+	}
+
+	assert.Equal(t, "https://api.prod.some.domain:6443", clients.K8SConfig.Host, "host does not meet expectations")
+	assert.Equal(t, "kube-system", clients.Namespace, "namespace does not meet expectations")
+
+	// No context given means the kubeconfig's current context.
+	clients, err = NewClients([]byte(testKubeconfig), "")
+	if err != nil {
+		t.Fatalf("failed creating clients: %s", err)
+	}
+
+	assert.Equal(t, "https://api.staging.some.domain:6443", clients.K8SConfig.Host, "host does not meet expectations")
+	assert.Equal(t, "default", clients.Namespace, "namespace does not meet expectations")
+
+	_, err = NewClients([]byte(testKubeconfig), "dev")
+	assert.Error(t, err, "a missing context should be an error")
+
+	err = checkClient(nil)
+	assert.Error(t, err, "no client should be an error")
+}
@@ -0,0 +1,99 @@
+package kubernetes
+
+import (
+	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	k8s_utility_client "github.com/nikogura/k8s-utility-client/pkg/k8s-utility-client"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IdentityNamespace is the namespace of the ConfigMap naming the cluster.
+const IdentityNamespace = "kube-system"
+
+// IdentityConfigMapName is the name of the ConfigMap naming the cluster.  It's written at bootstrap, so commands can tell which cluster a kubeconfig really points at.
+const IdentityConfigMapName = "k8s-cluster-manager-identity"
+
+// IdentityClusterKey is the key in the identity ConfigMap holding the cluster's name.
+const IdentityClusterKey = "cluster"
+
+// ClusterIdentity reads the cluster's name from the identity ConfigMap.  found is false if there is no such ConfigMap.
+func ClusterIdentity(ctx context.Context, client *k8s_utility_client.K8sClients, verbose bool) (clusterName string, found bool, err error) {
+	manager.VerboseOutput(verbose, "Reading cluster identity from %s/%s\n", IdentityNamespace, IdentityConfigMapName)
+
+	err = checkClient(client)
+	if err != nil {
+		return clusterName, found, err
+	}
+
+	cm, getErr := client.ClientSet.CoreV1().ConfigMaps(IdentityNamespace).Get(ctx, IdentityConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(getErr) {
+		return clusterName, found, err
+	}
+
+	if getErr != nil {
+		err = errors.Wrapf(getErr, "failed getting ConfigMap %s/%s", IdentityNamespace, IdentityConfigMapName)
+		return clusterName, found, err
+	}
+
+	clusterName, found = cm.Data[IdentityClusterKey]
+
+	return clusterName, found, err
+}
+
+// WriteClusterIdentity writes the identity ConfigMap naming the cluster, replacing any that's there.
+func WriteClusterIdentity(ctx context.Context, client *k8s_utility_client.K8sClients, clusterName string, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Writing cluster identity %s to %s/%s\n", clusterName, IdentityNamespace, IdentityConfigMapName)
+
+	err = checkClient(client)
+	if err != nil {
+		return err
+	}
+
+	configMaps := client.ClientSet.CoreV1().ConfigMaps(IdentityNamespace)
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      IdentityConfigMapName,
+			Namespace: IdentityNamespace,
+		},
+		Data: map[string]string{IdentityClusterKey: clusterName},
+	}
+
+	_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	}
+
+	if err != nil {
+		err = errors.Wrapf(err, "failed writing ConfigMap %s/%s", IdentityNamespace, IdentityConfigMapName)
+		return err
+	}
+
+	return err
+}
+
+// NodeProviderIDs returns the spec.providerID of every node in Kubernetes, keyed by node name.  Nodes without one have an empty providerID.
+func NodeProviderIDs(ctx context.Context, client *k8s_utility_client.K8sClients, verbose bool) (providerIDs map[string]string, err error) {
+	manager.VerboseOutput(verbose, "Listing node provider IDs from Kubernetes\n")
+
+	err = checkClient(client)
+	if err != nil {
+		return providerIDs, err
+	}
+
+	nodes, listErr := client.ClientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if listErr != nil {
+		err = errors.Wrapf(listErr, "failed listing nodes from kubernetes")
+		return providerIDs, err
+	}
+
+	providerIDs = make(map[string]string, len(nodes.Items))
+	for _, node := range nodes.Items {
+		providerIDs[node.Name] = node.Spec.ProviderID
+	}
+
+	return providerIDs, err
+}
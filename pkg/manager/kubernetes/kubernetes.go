@@ -10,12 +10,11 @@ import (
 	"time"
 )
 
-func DeleteNode(ctx context.Context, nodeName string, verbose bool) (err error) {
+func DeleteNode(ctx context.Context, client *k8s_utility_client.K8sClients, nodeName string, verbose bool) (err error) {
 	manager.VerboseOutput(verbose, "Deleting node %s from k8s\n", nodeName)
 
-	client, clientErr := k8s_utility_client.NewK8sClients()
-	if clientErr != nil {
-		err = errors.Wrapf(clientErr, "failed creating k8s clients")
+	err = checkClient(client)
+	if err != nil {
 		return err
 	}
 
@@ -29,12 +28,11 @@ func DeleteNode(ctx context.Context, nodeName string, verbose bool) (err error)
 }
 
 // WaitForNodeReady waits for a node to register in Kubernetes and become Ready.
-func WaitForNodeReady(ctx context.Context, nodeName string, timeout time.Duration, verbose bool) (err error) {
+func WaitForNodeReady(ctx context.Context, client *k8s_utility_client.K8sClients, nodeName string, timeout time.Duration, verbose bool) (err error) {
 	manager.VerboseOutput(verbose, "Waiting for node %s to register in Kubernetes (timeout: %v)\n", nodeName, timeout)
 
-	client, clientErr := k8s_utility_client.NewK8sClients()
-	if clientErr != nil {
-		err = errors.Wrapf(clientErr, "failed creating k8s clients")
+	err = checkClient(client)
+	if err != nil {
 		return err
 	}
 
@@ -68,6 +66,59 @@ func WaitForNodeReady(ctx context.Context, nodeName string, timeout time.Duratio
 	}
 }
 
+// NodeReady says whether a node is Ready right now.
+func NodeReady(ctx context.Context, client *k8s_utility_client.K8sClients, nodeName string, verbose bool) (ready bool, err error) {
+	manager.VerboseOutput(verbose, "Checking node %s is Ready\n", nodeName)
+
+	err = checkClient(client)
+	if err != nil {
+		return ready, err
+	}
+
+	node, getErr := client.ClientSet.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if getErr != nil {
+		err = errors.Wrapf(getErr, "failed getting node %s", nodeName)
+		return ready, err
+	}
+
+	ready = isNodeReady(node)
+
+	return ready, err
+}
+
+// NodeLabel returns the value of a label on a node.  It's empty if the node doesn't have the label.
+func NodeLabel(ctx context.Context, client *k8s_utility_client.K8sClients, nodeName string, label string, verbose bool) (value string, err error) {
+	labels, labelsErr := NodeLabels(ctx, client, nodeName, verbose)
+	if labelsErr != nil {
+		err = labelsErr
+		return value, err
+	}
+
+	value = labels[label]
+
+	return value, err
+}
+
+// NodeLabels returns a node's labels.
+func NodeLabels(ctx context.Context, client *k8s_utility_client.K8sClients, nodeName string, verbose bool) (labels map[string]string, err error) {
+	manager.VerboseOutput(verbose, "Getting labels of node %s\n", nodeName)
+
+	err = checkClient(client)
+	if err != nil {
+		return labels, err
+	}
+
+	node, getErr := client.ClientSet.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if getErr != nil {
+		err = errors.Wrapf(getErr, "failed getting node %s", nodeName)
+		return labels, err
+	}
+
+	labels = node.Labels
+
+	return labels, err
+}
+
 func isNodeReady(node *corev1.Node) (ready bool) {
 	for _, condition := range node.Status.Conditions {
 		if condition.Type == corev1.NodeReady {
@@ -80,12 +131,11 @@ func isNodeReady(node *corev1.Node) (ready bool) {
 }
 
 // ListNodes returns a list of all node names in Kubernetes.
-func ListNodes(ctx context.Context, verbose bool) (nodeNames []string, err error) {
+func ListNodes(ctx context.Context, client *k8s_utility_client.K8sClients, verbose bool) (nodeNames []string, err error) {
 	manager.VerboseOutput(verbose, "Listing all nodes from Kubernetes\n")
 
-	client, clientErr := k8s_utility_client.NewK8sClients()
-	if clientErr != nil {
-		err = errors.Wrapf(clientErr, "failed creating k8s clients")
+	err = checkClient(client)
+	if err != nil {
 		return nodeNames, err
 	}
 
@@ -103,57 +153,64 @@ func ListNodes(ctx context.Context, verbose bool) (nodeNames []string, err error
 	return nodeNames, err
 }
 
-// ApplyPurposeLabelsAndTaints applies a purpose label and corresponding taint to a node.
-func ApplyPurposeLabelsAndTaints(ctx context.Context, nodeName string, purposeValue string, verbose bool) (err error) {
-	manager.VerboseOutput(verbose, "Applying purpose label and taint to node %s (purpose: %s)\n", nodeName, purposeValue)
+// PurposeLabel is the label, and taint, that says what a node is for.
+const PurposeLabel = "purpose"
 
-	client, clientErr := k8s_utility_client.NewK8sClients()
-	if clientErr != nil {
-		err = errors.Wrapf(clientErr, "failed creating k8s clients")
-		return err
+// ControlPlaneLabel is the label Kubernetes puts on control plane nodes.
+const ControlPlaneLabel = "node-role.kubernetes.io/control-plane"
+
+// ListControlPlaneNodes returns the names of the nodes Kubernetes has labelled as control plane nodes.
+func ListControlPlaneNodes(ctx context.Context, client *k8s_utility_client.K8sClients, verbose bool) (nodeNames []string, err error) {
+	manager.VerboseOutput(verbose, "Listing control plane nodes from Kubernetes\n")
+
+	err = checkClient(client)
+	if err != nil {
+		return nodeNames, err
 	}
 
-	// Get the node
-	node, getErr := client.ClientSet.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
-	if getErr != nil {
-		err = errors.Wrapf(getErr, "failed getting node %s", nodeName)
-		return err
+	nodes, listErr := client.ClientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: ControlPlaneLabel})
+	if listErr != nil {
+		err = errors.Wrapf(listErr, "failed listing control plane nodes from kubernetes")
+		return nodeNames, err
 	}
 
-	// Add label
-	if node.Labels == nil {
-		node.Labels = make(map[string]string)
+	nodeNames = make([]string, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		nodeNames = append(nodeNames, node.Name)
 	}
-	node.Labels["purpose"] = purposeValue
 
-	// Add taint
-	taint := corev1.Taint{
-		Key:    "purpose",
-		Value:  purposeValue,
-		Effect: corev1.TaintEffectNoSchedule,
+	return nodeNames, err
+}
+
+// NodeLabelValues returns the value of a label for each node that has it, keyed by node name.
+func NodeLabelValues(ctx context.Context, client *k8s_utility_client.K8sClients, label string, verbose bool) (values map[string]string, err error) {
+	manager.VerboseOutput(verbose, "Listing %s labels from Kubernetes\n", label)
+
+	err = checkClient(client)
+	if err != nil {
+		return values, err
 	}
 
-	// Check if taint already exists
-	taintExists := false
-	for _, existingTaint := range node.Spec.Taints {
-		if existingTaint.Key == taint.Key && existingTaint.Value == taint.Value && existingTaint.Effect == taint.Effect {
-			taintExists = true
-			break
-		}
+	nodes, listErr := client.ClientSet.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: label})
+	if listErr != nil {
+		err = errors.Wrapf(listErr, "failed listing nodes labelled %s from kubernetes", label)
+		return values, err
 	}
 
-	if !taintExists {
-		node.Spec.Taints = append(node.Spec.Taints, taint)
+	values = make(map[string]string, len(nodes.Items))
+	for _, node := range nodes.Items {
+		values[node.Name] = node.Labels[label]
 	}
 
-	// Update the node
-	_, updateErr := client.ClientSet.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
-	if updateErr != nil {
-		err = errors.Wrapf(updateErr, "failed updating node %s with purpose label and taint", nodeName)
+	return values, err
+}
+
+// checkClient makes sure there is a client to use.  Commands only build one if they find a kubeconfig for the cluster.
+func checkClient(client *k8s_utility_client.K8sClients) (err error) {
+	if client == nil || client.ClientSet == nil {
+		err = errors.New("no kubeconfig for the cluster.  Use --kubeconfig, or put it in the secret.")
 		return err
 	}
 
-	manager.VerboseOutput(verbose, "Successfully applied purpose=%s label and taint to node %s\n", purposeValue, nodeName)
-
 	return err
 }
@@ -0,0 +1,485 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	k8s_utility_client "github.com/nikogura/k8s-utility-client/pkg/k8s-utility-client"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+	"sort"
+	"strings"
+)
+
+// FieldManager is the field manager named in the changes k8s-cluster-manager makes to nodes.
+const FieldManager = "k8s-cluster-manager"
+
+// TaintEffects are the effects a taint can have.
+//
+//nolint:gochecknoglobals // Constant list
+var TaintEffects = []corev1.TaintEffect{
+	corev1.TaintEffectNoSchedule,
+	corev1.TaintEffectPreferNoSchedule,
+	corev1.TaintEffectNoExecute,
+}
+
+// Taint is a taint for a node, as written in node configs.  The effect defaults to NoSchedule.
+type Taint struct {
+	Key    string `yaml:"key"`
+	Value  string `yaml:"value"`
+	Effect string `yaml:"effect"`
+}
+
+// NodeMetadata is the labels, annotations and taints a node should have.
+type NodeMetadata struct {
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+	Taints      []Taint           `yaml:"taints"`
+}
+
+// NodeMetadataChange is a change to a node's labels, annotations and taints.  Set is added to the node, replacing labels and annotations with the same key, and taints with the same key and effect.  The Remove fields are taken off the node.  A removed taint without an effect removes the key with any effect.
+type NodeMetadataChange struct {
+	Set               NodeMetadata
+	RemoveLabels      []string
+	RemoveAnnotations []string
+	RemoveTaints      []Taint
+}
+
+// PurposeMetadata is what a node of a purpose gets: the purpose label, and a NoSchedule taint, so only workloads meant for the purpose land on it.
+func PurposeMetadata(purpose string) (metadata NodeMetadata) {
+	metadata = NodeMetadata{
+		Labels: map[string]string{PurposeLabel: purpose},
+		Taints: []Taint{{Key: PurposeLabel, Value: purpose, Effect: string(corev1.TaintEffectNoSchedule)}},
+	}
+
+	return metadata
+}
+
+// TaintEffect returns the taint's effect, defaulting to NoSchedule.
+func (t Taint) TaintEffect() (effect corev1.TaintEffect) {
+	effect = corev1.TaintEffect(t.Effect)
+	if effect == "" {
+		effect = corev1.TaintEffectNoSchedule
+	}
+
+	return effect
+}
+
+// String renders the taint like kubectl does: key=value:Effect.
+func (t Taint) String() (result string) {
+	result = t.Key
+	if t.Value != "" {
+		result = fmt.Sprintf("%s=%s", result, t.Value)
+	}
+
+	if t.Effect != "" {
+		result = fmt.Sprintf("%s:%s", result, t.Effect)
+	}
+
+	return result
+}
+
+// Validate checks the taint's key and value are valid, and its effect is one of TaintEffects.
+func (t Taint) Validate() (err error) {
+	problems := validation.IsQualifiedName(t.Key)
+	if t.Value != "" {
+		problems = append(problems, validation.IsValidLabelValue(t.Value)...)
+	}
+
+	if len(problems) > 0 {
+		err = errors.Errorf("invalid taint %s: %s", t, strings.Join(problems, ", "))
+		return err
+	}
+
+	effect := t.TaintEffect()
+	for _, valid := range TaintEffects {
+		if effect == valid {
+			return err
+		}
+	}
+
+	err = errors.Errorf("invalid taint %s: effect must be one of %s", t, taintEffectNames())
+
+	return err
+}
+
+// taintEffectNames lists TaintEffects for messages.
+func taintEffectNames() (names string) {
+	list := make([]string, 0, len(TaintEffects))
+	for _, effect := range TaintEffects {
+		list = append(list, string(effect))
+	}
+
+	names = strings.Join(list, ", ")
+
+	return names
+}
+
+// ParseTaint parses a taint written like kubectl writes them: key=value:Effect, key:Effect, key=value, or key.
+func ParseTaint(spec string) (taint Taint, err error) {
+	rest := spec
+
+	colon := strings.LastIndex(rest, ":")
+	if colon >= 0 {
+		taint.Effect = rest[colon+1:]
+		rest = rest[:colon]
+	}
+
+	taint.Key, taint.Value, _ = strings.Cut(rest, "=")
+
+	err = taint.Validate()
+
+	return taint, err
+}
+
+// ParseTaintArgs parses taints given on the command line.  Taints ending in "-" are to be removed, the rest are to be set.
+func ParseTaintArgs(args []string) (set []Taint, remove []Taint, err error) {
+	for _, arg := range args {
+		spec, removing := strings.CutSuffix(arg, "-")
+
+		taint, parseErr := ParseTaint(spec)
+		if parseErr != nil {
+			err = parseErr
+			return set, remove, err
+		}
+
+		if removing {
+			remove = append(remove, taint)
+			continue
+		}
+
+		set = append(set, taint)
+	}
+
+	return set, remove, err
+}
+
+// ParseKeyValueArgs parses labels or annotations given on the command line, like kubectl: key=value sets a key, and key- removes it.
+func ParseKeyValueArgs(args []string) (set map[string]string, remove []string, err error) {
+	set = make(map[string]string)
+
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if found {
+			set[key] = value
+			continue
+		}
+
+		key, removing := strings.CutSuffix(arg, "-")
+		if !removing {
+			err = errors.Errorf("bad argument %q: expected key=value, or key- to remove the key", arg)
+			return set, remove, err
+		}
+
+		remove = append(remove, key)
+	}
+
+	return set, remove, err
+}
+
+// Empty says whether there's no metadata at all.
+func (m NodeMetadata) Empty() (empty bool) {
+	empty = len(m.Labels) == 0 && len(m.Annotations) == 0 && len(m.Taints) == 0
+	return empty
+}
+
+// Merge layers other on top of the metadata.  Labels and annotations in other replace those with the same key.  Taints in other replace all taints with the same key, whatever their effect, so a more specific config can change a taint's effect.
+func (m NodeMetadata) Merge(other NodeMetadata) (merged NodeMetadata) {
+	merged.Labels = mergeMaps(m.Labels, other.Labels)
+	merged.Annotations = mergeMaps(m.Annotations, other.Annotations)
+
+	replaced := make(map[string]bool, len(other.Taints))
+	for _, taint := range other.Taints {
+		replaced[taint.Key] = true
+	}
+
+	for _, taint := range m.Taints {
+		if replaced[taint.Key] {
+			continue
+		}
+
+		merged.Taints = append(merged.Taints, taint)
+	}
+
+	merged.Taints = append(merged.Taints, other.Taints...)
+
+	return merged
+}
+
+// mergeMaps copies base and overlays other on it.  The result is nil if both are empty.
+func mergeMaps(base map[string]string, other map[string]string) (merged map[string]string) {
+	if len(base) == 0 && len(other) == 0 {
+		return merged
+	}
+
+	merged = make(map[string]string, len(base)+len(other))
+	for k, v := range base {
+		merged[k] = v
+	}
+
+	for k, v := range other {
+		merged[k] = v
+	}
+
+	return merged
+}
+
+// Validate checks every label, annotation and taint in the change.
+func (c NodeMetadataChange) Validate() (err error) {
+	problems := make([]string, 0)
+
+	for _, key := range sortedKeys(c.Set.Labels) {
+		for _, problem := range validation.IsQualifiedName(key) {
+			problems = append(problems, fmt.Sprintf("label %s: %s", key, problem))
+		}
+
+		for _, problem := range validation.IsValidLabelValue(c.Set.Labels[key]) {
+			problems = append(problems, fmt.Sprintf("label %s: %s", key, problem))
+		}
+	}
+
+	for _, key := range c.RemoveLabels {
+		for _, problem := range validation.IsQualifiedName(key) {
+			problems = append(problems, fmt.Sprintf("label %s: %s", key, problem))
+		}
+	}
+
+	for _, key := range append(sortedKeys(c.Set.Annotations), c.RemoveAnnotations...) {
+		for _, problem := range validation.IsQualifiedName(key) {
+			problems = append(problems, fmt.Sprintf("annotation %s: %s", key, problem))
+		}
+	}
+
+	for _, taint := range append(append([]Taint{}, c.Set.Taints...), c.RemoveTaints...) {
+		taintErr := taint.Validate()
+		if taintErr != nil {
+			problems = append(problems, taintErr.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		err = errors.Errorf("invalid node metadata: %s", strings.Join(problems, "; "))
+		return err
+	}
+
+	return err
+}
+
+// Empty says whether the change changes nothing.
+func (c NodeMetadataChange) Empty() (empty bool) {
+	empty = c.Set.Empty() && len(c.RemoveLabels) == 0 && len(c.RemoveAnnotations) == 0 && len(c.RemoveTaints) == 0
+	return empty
+}
+
+// sortedKeys returns a map's keys in order.
+func sortedKeys(m map[string]string) (keys []string) {
+	keys = make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// MetadataPatch renders the label and annotation part of a change as a JSON merge patch for a node.  Removed keys are set to null.  It's empty if the change has no labels or annotations.
+func MetadataPatch(change NodeMetadataChange) (patch []byte, err error) {
+	labels := patchMap(change.Set.Labels, change.RemoveLabels)
+	annotations := patchMap(change.Set.Annotations, change.RemoveAnnotations)
+
+	if len(labels) == 0 && len(annotations) == 0 {
+		return patch, err
+	}
+
+	metadata := make(map[string]interface{})
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+
+	patch, err = json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		err = errors.Wrapf(err, "failed marshalling node metadata patch")
+		return patch, err
+	}
+
+	return patch, err
+}
+
+// patchMap makes the merge patch for one map.  Keys that are both set and removed are set.
+func patchMap(set map[string]string, remove []string) (patch map[string]interface{}) {
+	patch = make(map[string]interface{}, len(set)+len(remove))
+	for _, key := range remove {
+		patch[key] = nil
+	}
+
+	for key, value := range set {
+		patch[key] = value
+	}
+
+	return patch
+}
+
+// MergeTaints works out a node's taints after a change.  Existing taints are kept in order, including their time added, unless removed, or replaced by a taint being set with the same key and another effect.  changed says whether the result differs from existing.
+func MergeTaints(existing []corev1.Taint, set []Taint, remove []Taint) (taints []corev1.Taint, changed bool) {
+	taints = make([]corev1.Taint, 0, len(existing)+len(set))
+
+	for _, taint := range existing {
+		i := findTaint(set, taint.Key, taint.Effect)
+
+		// A taint being set with another effect replaces this one, as Merge does for configs.
+		if i < 0 && (taintRemoved(taint, remove) || taintKeySet(set, taint.Key)) {
+			changed = true
+			continue
+		}
+
+		if i >= 0 && set[i].Value != taint.Value {
+			taint.Value = set[i].Value
+			changed = true
+		}
+
+		taints = append(taints, taint)
+	}
+
+	for _, taint := range set {
+		if hasTaint(taints, taint.Key, taint.TaintEffect()) {
+			continue
+		}
+
+		taints = append(taints, corev1.Taint{Key: taint.Key, Value: taint.Value, Effect: taint.TaintEffect()})
+		changed = true
+	}
+
+	return taints, changed
+}
+
+// taintRemoved says whether a node's taint is matched by one of the taints to remove.
+func taintRemoved(taint corev1.Taint, remove []Taint) (removed bool) {
+	for _, r := range remove {
+		if r.Key == taint.Key && (r.Effect == "" || corev1.TaintEffect(r.Effect) == taint.Effect) {
+			removed = true
+			return removed
+		}
+	}
+
+	return removed
+}
+
+// taintKeySet says whether any of the taints being set has the key.
+func taintKeySet(set []Taint, key string) (found bool) {
+	for _, taint := range set {
+		if taint.Key == key {
+			found = true
+			return found
+		}
+	}
+
+	return found
+}
+
+// findTaint returns the index of the taint with the key and effect, or -1.
+func findTaint(taints []Taint, key string, effect corev1.TaintEffect) (index int) {
+	for i, taint := range taints {
+		if taint.Key == key && taint.TaintEffect() == effect {
+			index = i
+			return index
+		}
+	}
+
+	index = -1
+
+	return index
+}
+
+// hasTaint says whether a node's taints include the key and effect.
+func hasTaint(taints []corev1.Taint, key string, effect corev1.TaintEffect) (found bool) {
+	for _, taint := range taints {
+		if taint.Key == key && taint.Effect == effect {
+			found = true
+			return found
+		}
+	}
+
+	return found
+}
+
+// ApplyNodeMetadata makes a change to a node's labels, annotations and taints.  It's safe to repeat.
+//
+// Labels and annotations are changed with a merge patch, which only touches the keys given.  The taints are a list, so they're read, changed, and written back with the node's resourceVersion, which is retried if the kubelet or a controller changed the node in between.  Nothing is written if the taints are already right.
+func ApplyNodeMetadata(ctx context.Context, client *k8s_utility_client.K8sClients, nodeName string, change NodeMetadataChange, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Applying labels, annotations and taints to node %s\n", nodeName)
+
+	err = checkClient(client)
+	if err != nil {
+		return err
+	}
+
+	err = change.Validate()
+	if err != nil {
+		return err
+	}
+
+	nodes := client.ClientSet.CoreV1().Nodes()
+
+	metadataPatch, patchErr := MetadataPatch(change)
+	if patchErr != nil {
+		err = patchErr
+		return err
+	}
+
+	if len(metadataPatch) > 0 {
+		_, err = nodes.Patch(ctx, nodeName, types.MergePatchType, metadataPatch, metav1.PatchOptions{FieldManager: FieldManager})
+		if err != nil {
+			err = errors.Wrapf(err, "failed patching labels and annotations of node %s", nodeName)
+			return err
+		}
+	}
+
+	if len(change.Set.Taints) == 0 && len(change.RemoveTaints) == 0 {
+		return err
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() (retryErr error) {
+		node, getErr := nodes.Get(ctx, nodeName, metav1.GetOptions{})
+		if getErr != nil {
+			retryErr = getErr
+			return retryErr
+		}
+
+		taints, changed := MergeTaints(node.Spec.Taints, change.Set.Taints, change.RemoveTaints)
+		if !changed {
+			manager.VerboseOutput(verbose, "Taints of node %s already up to date\n", nodeName)
+			return retryErr
+		}
+
+		taintPatch, marshalErr := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{"resourceVersion": node.ResourceVersion},
+			"spec":     map[string]interface{}{"taints": taints},
+		})
+		if marshalErr != nil {
+			retryErr = marshalErr
+			return retryErr
+		}
+
+		_, retryErr = nodes.Patch(ctx, nodeName, types.MergePatchType, taintPatch, metav1.PatchOptions{FieldManager: FieldManager})
+
+		return retryErr
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed patching taints of node %s", nodeName)
+		return err
+	}
+
+	manager.VerboseOutput(verbose, "Successfully applied labels, annotations and taints to node %s\n", nodeName)
+
+	return err
+}
@@ -0,0 +1,195 @@
+package kubernetes
+
+import (
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"testing"
+)
+
+func TestParseTaint(t *testing.T) {
+	cases := []struct {
+		name     string
+		spec     string
+		expected Taint
+		errored  bool
+	}{
+		{
+			name:     "full",
+			spec:     "dedicated=gpu:NoExecute",
+			expected: Taint{Key: "dedicated", Value: "gpu", Effect: "NoExecute"},
+		},
+		{
+			name:     "no value",
+			spec:     "example.com/drain:PreferNoSchedule",
+			expected: Taint{Key: "example.com/drain", Effect: "PreferNoSchedule"},
+		},
+		{
+			name:     "no effect",
+			spec:     "dedicated=gpu",
+			expected: Taint{Key: "dedicated", Value: "gpu"},
+		},
+		{
+			name:    "bad effect",
+			spec:    "dedicated=gpu:Never",
+			errored: true,
+		},
+		{
+			name:    "bad key",
+			spec:    "not a key:NoSchedule",
+			errored: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			taint, err := ParseTaint(tc.spec)
+			if tc.errored {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, tc.expected, taint, "taint does not meet expectations")
+		})
+	}
+}
+
+func TestParseKeyValueArgs(t *testing.T) {
+	set, remove, err := ParseKeyValueArgs([]string{"tier=backend", "old-", "empty="})
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, map[string]string{"tier": "backend", "empty": ""}, set, "set does not meet expectations")
+	assert.Equal(t, []string{"old"}, remove, "remove does not meet expectations")
+
+	_, _, err = ParseKeyValueArgs([]string{"tier"})
+	assert.Error(t, err, "expected an error")
+}
+
+func TestParseTaintArgs(t *testing.T) {
+	set, remove, err := ParseTaintArgs([]string{"dedicated=gpu:NoSchedule", "purpose-", "drain:NoExecute-"})
+	assert.NoError(t, err, "unexpected error")
+	assert.Equal(t, []Taint{{Key: "dedicated", Value: "gpu", Effect: "NoSchedule"}}, set, "set does not meet expectations")
+	assert.Equal(t, []Taint{{Key: "purpose"}, {Key: "drain", Effect: "NoExecute"}}, remove, "remove does not meet expectations")
+}
+
+func TestMetadataPatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		change   NodeMetadataChange
+		expected string
+	}{
+		{
+			name: "nothing",
+		},
+		{
+			name: "labels and annotations",
+			change: NodeMetadataChange{
+				Set: NodeMetadata{
+					Labels:      map[string]string{"tier": "backend"},
+					Annotations: map[string]string{"example.com/owner": "team-a"},
+				},
+				RemoveLabels: []string{"old"},
+			},
+			expected: `{"metadata":{"annotations":{"example.com/owner":"team-a"},"labels":{"old":null,"tier":"backend"}}}`,
+		},
+		{
+			name: "taints only",
+			change: NodeMetadataChange{
+				Set: NodeMetadata{Taints: []Taint{{Key: "dedicated"}}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			patch, err := MetadataPatch(tc.change)
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, tc.expected, string(patch), "patch does not meet expectations")
+		})
+	}
+}
+
+func TestMergeTaints(t *testing.T) {
+	notReady := corev1.Taint{Key: "node.kubernetes.io/not-ready", Effect: corev1.TaintEffectNoExecute}
+	purpose := corev1.Taint{Key: "purpose", Value: "gpu", Effect: corev1.TaintEffectNoSchedule}
+
+	cases := []struct {
+		name     string
+		existing []corev1.Taint
+		set      []Taint
+		remove   []Taint
+		expected []corev1.Taint
+		changed  bool
+	}{
+		{
+			name:     "already there",
+			existing: []corev1.Taint{notReady, purpose},
+			set:      []Taint{{Key: "purpose", Value: "gpu"}},
+			expected: []corev1.Taint{notReady, purpose},
+		},
+		{
+			name:     "added",
+			existing: []corev1.Taint{notReady},
+			set:      []Taint{{Key: "purpose", Value: "gpu"}},
+			expected: []corev1.Taint{notReady, purpose},
+			changed:  true,
+		},
+		{
+			name:     "value changed",
+			existing: []corev1.Taint{purpose},
+			set:      []Taint{{Key: "purpose", Value: "ingress", Effect: "NoSchedule"}},
+			expected: []corev1.Taint{{Key: "purpose", Value: "ingress", Effect: corev1.TaintEffectNoSchedule}},
+			changed:  true,
+		},
+		{
+			name:     "removed by key",
+			existing: []corev1.Taint{notReady, purpose},
+			remove:   []Taint{{Key: "purpose"}},
+			expected: []corev1.Taint{notReady},
+			changed:  true,
+		},
+		{
+			name:     "effect changed",
+			existing: []corev1.Taint{notReady, purpose},
+			set:      []Taint{{Key: "purpose", Value: "gpu", Effect: "NoExecute"}},
+			expected: []corev1.Taint{notReady, {Key: "purpose", Value: "gpu", Effect: corev1.TaintEffectNoExecute}},
+			changed:  true,
+		},
+		{
+			name:     "both effects set",
+			existing: []corev1.Taint{purpose},
+			set:      []Taint{{Key: "purpose", Value: "gpu"}, {Key: "purpose", Value: "gpu", Effect: "NoExecute"}},
+			expected: []corev1.Taint{purpose, {Key: "purpose", Value: "gpu", Effect: corev1.TaintEffectNoExecute}},
+			changed:  true,
+		},
+		{
+			name:     "other effect not removed",
+			existing: []corev1.Taint{purpose},
+			remove:   []Taint{{Key: "purpose", Effect: "NoExecute"}},
+			expected: []corev1.Taint{purpose},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			taints, changed := MergeTaints(tc.existing, tc.set, tc.remove)
+			assert.Equal(t, tc.expected, taints, "taints do not meet expectations")
+			assert.Equal(t, tc.changed, changed, "changed does not meet expectations")
+		})
+	}
+}
+
+func TestNodeMetadataChangeValidate(t *testing.T) {
+	good := NodeMetadataChange{
+		Set: NodeMetadata{
+			Labels:      map[string]string{"topology.example.com/rack": "r1"},
+			Annotations: map[string]string{"example.com/note": "anything at all, even spaces"},
+			Taints:      []Taint{{Key: "dedicated", Value: "gpu", Effect: "NoExecute"}},
+		},
+	}
+	assert.NoError(t, good.Validate(), "unexpected error")
+
+	bad := NodeMetadataChange{
+		Set: NodeMetadata{Labels: map[string]string{"tier": "not a valid value"}},
+	}
+	assert.Error(t, bad.Validate(), "expected an error")
+}
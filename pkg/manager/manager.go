@@ -47,7 +47,10 @@ type K8sClusterManager interface {
 
 type DNSManager interface {
 	RegisterNode(ctx context.Context, node ClusterNode, verbose bool) (err error)
-	DeregisterNode(ctx context.Context, nodeName string, verbose bool) (err error)
+	DeregisterNode(ctx context.Context, nodeName string, domain string, verbose bool) (err error)
+	ListRecords(ctx context.Context, domain string, verbose bool) (records []DNSRecord, err error) // List the address records under the domain
+	UpsertAlias(ctx context.Context, name string, target string, verbose bool) (err error)         // Point name at target (CNAME, or ALIAS where supported)
+	LookupAlias(ctx context.Context, name string, verbose bool) (target string, err error)         // What name currently points at.  Empty if nothing.
 }
 
 type DNSManagerStruct struct{}
@@ -55,9 +58,28 @@ type DNSManagerStruct struct{}
 func (DNSManagerStruct) RegisterNode(ctx context.Context, node ClusterNode, verbose bool) (err error) {
 	return err
 }
-func (DNSManagerStruct) DeregisterNode(ctx context.Context, nodeName string, verbose bool) (err error) {
+func (DNSManagerStruct) DeregisterNode(ctx context.Context, nodeName string, domain string, verbose bool) (err error) {
 	return err
 }
+func (DNSManagerStruct) ListRecords(ctx context.Context, domain string, verbose bool) (records []DNSRecord, err error) {
+	return records, err
+}
+func (DNSManagerStruct) UpsertAlias(ctx context.Context, name string, target string, verbose bool) (err error) {
+	return err
+}
+func (DNSManagerStruct) LookupAlias(ctx context.Context, name string, verbose bool) (target string, err error) {
+	return target, err
+}
+
+// DNSRecord is a provider-neutral view of an address record.
+type DNSRecord struct {
+	ID      string
+	Name    string // Fully qualified record name
+	Type    string // A, AAAA, etc
+	Content string // IP address the record points to
+	Comment string
+	Owned   bool // An ownership record marks the record as created by this tool, for this owner
+}
 
 // CostEstimator provides cost estimation for compute resources.
 type CostEstimator interface {
@@ -72,23 +94,28 @@ type ClusterInfo struct {
 	Provider                   string
 	Nodes                      []NodeInfo
 	LoadBalancers              []LBInfo
-	ScheduleWorkloadsOnCPNodes bool     // TODO  How do we keep track of this?
-	EstimatedDailyCost         *float64 `json:"estimated_daily_cost,omitempty"` // Optional cost estimate in USD
-	TotalVCPUs                 int      `json:"total_vcpus,omitempty"`          // Total vCPUs across all nodes
-	TotalMemoryGiB             float64  `json:"total_memory_gib,omitempty"`     // Total memory in GiB across all nodes
+	ScheduleWorkloadsOnCPNodes bool            // TODO  How do we keep track of this?
+	EstimatedDailyCost         *float64        `json:"estimated_daily_cost,omitempty"` // Optional cost estimate in USD
+	TotalVCPUs                 int             `json:"total_vcpus,omitempty"`          // Total vCPUs across all nodes
+	TotalMemoryGiB             float64         `json:"total_memory_gib,omitempty"`     // Total memory in GiB across all nodes
+	DNSRecords                 []ClusterRecord `json:"dns_records,omitempty"`          // Cluster level DNS records pointing at the load balancers
 }
 
 type NodeInfo struct {
 	Name         string
 	ID           string
 	InstanceType string
-	VCPUs        int     `json:"vcpus,omitempty"`      // Number of vCPUs for this instance
-	MemoryGiB    float64 `json:"memory_gib,omitempty"` // Memory in GiB for this instance
-	DailyCost    float64 `json:"daily_cost,omitempty"` // Estimated daily cost in USD
+	IP           string  `json:"ip,omitempty"`            // Private IP address of the instance
+	Zone         string  `json:"zone,omitempty"`          // Availability zone of the instance
+	CapacityType string  `json:"capacity_type,omitempty"` // Whether the instance is on-demand or spot
+	VCPUs        int     `json:"vcpus,omitempty"`         // Number of vCPUs for this instance
+	MemoryGiB    float64 `json:"memory_gib,omitempty"`    // Memory in GiB for this instance
+	DailyCost    float64 `json:"daily_cost,omitempty"`    // Estimated daily cost in USD
 }
 
 type LBInfo struct {
 	Name         string
+	DNSName      string
 	IsAPIServer  bool
 	Targets      []LBTargetInfo
 	TargetGroups []LBTargetGroupInfo
@@ -145,6 +172,13 @@ func (i ClusterInfo) ConsolePrint() {
 			target.ConsolePrint("      ")
 		}
 	}
+
+	if len(i.DNSRecords) > 0 {
+		fmt.Printf("DNS Records: (%d)\n", len(i.DNSRecords))
+		for _, record := range i.DNSRecords {
+			record.ConsolePrint("  ")
+		}
+	}
 }
 
 func (i NodeInfo) ConsolePrint(indent string) {
@@ -171,6 +205,17 @@ func (i LBInfo) ConsolePrint(indent string) {
 	fmt.Printf("%s%s\n", indent, i.Name)
 }
 
+func (r ClusterRecord) ConsolePrint(indent string) {
+	switch {
+	case r.InSync():
+		fmt.Printf("%s%s -> %s (%s)\n", indent, r.Name, r.Target, r.LBType)
+	case r.Current == "":
+		fmt.Printf("%s%s -> %s (%s) MISSING\n", indent, r.Name, r.Target, r.LBType)
+	default:
+		fmt.Printf("%s%s -> %s (%s) OUT OF SYNC, currently %s\n", indent, r.Name, r.Target, r.LBType, r.Current)
+	}
+}
+
 func (i LBTargetInfo) ConsolePrint(indent string) {
 	fmt.Printf("%s%s:%d State: %s\n", indent, i.Name, i.Port, i.State)
 }
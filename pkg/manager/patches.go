@@ -0,0 +1,302 @@
+package manager
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PatchKeyPrefix starts the keys of the optional machine config patches in the secret.  patch.yaml, the role patch, doesn't have it.
+const PatchKeyPrefix = "patch-"
+
+// PatchKeySuffix ends the keys of the machine config patches in the secret.
+const PatchKeySuffix = ".yaml"
+
+// ClusterPatchKey is the optional key in the secret holding the patch for every node in the cluster.
+const ClusterPatchKey = "patch-cluster.yaml"
+
+// PurposePatchKeyPrefix starts the keys of the optional per purpose patches in the secret, e.g. patch-purpose-ingress.yaml.
+const PurposePatchKeyPrefix = "patch-purpose-"
+
+// Subdirectories of a patches directory, one per layer.  Roles, purposes, and nodes each have a directory per name below them.
+const (
+	ClusterPatchDir = "cluster"
+	RolePatchDir    = "roles"
+	PurposePatchDir = "purposes"
+	NodePatchDir    = "nodes"
+)
+
+// PurposePatchKey is the key in the secret holding the patch for nodes of a purpose.
+func PurposePatchKey(purpose string) (key string) {
+	key = fmt.Sprintf("%s%s%s", PurposePatchKeyPrefix, purpose, PatchKeySuffix)
+	return key
+}
+
+// NodePatchKey is the key in the secret holding the patch for a single node.
+func NodePatchKey(nodeName string) (key string) {
+	key = fmt.Sprintf("%s%s%s", PatchKeyPrefix, nodeName, PatchKeySuffix)
+	return key
+}
+
+// Patch is a machine config patch, strategic merge or JSON6902, and where it came from.
+type Patch struct {
+	Source  string
+	Content []byte
+}
+
+// PatchSet is the machine config patches for the nodes of a role, in layers.  A node gets the cluster patches, then the role patches, then the patches for its purpose, then its own.  Later patches win.
+type PatchSet struct {
+	Cluster  []Patch
+	Role     []Patch
+	Purposes map[string][]Patch
+	Nodes    map[string][]Patch
+}
+
+// ForNode returns the patches for a node, in the order they're applied.
+func (ps PatchSet) ForNode(nodeName string, purpose string) (patches []Patch) {
+	patches = make([]Patch, 0, len(ps.Cluster)+len(ps.Role))
+	patches = append(patches, ps.Cluster...)
+	patches = append(patches, ps.Role...)
+
+	if purpose != "" {
+		patches = append(patches, ps.Purposes[purpose]...)
+	}
+
+	patches = append(patches, ps.Nodes[nodeName]...)
+
+	return patches
+}
+
+// Merge adds the patches in other after the ones in ps, layer by layer.
+func (ps PatchSet) Merge(other PatchSet) (merged PatchSet) {
+	merged = PatchSet{
+		Cluster:  append(append([]Patch{}, ps.Cluster...), other.Cluster...),
+		Role:     append(append([]Patch{}, ps.Role...), other.Role...),
+		Purposes: mergePatchMaps(ps.Purposes, other.Purposes),
+		Nodes:    mergePatchMaps(ps.Nodes, other.Nodes),
+	}
+
+	return merged
+}
+
+func mergePatchMaps(a map[string][]Patch, b map[string][]Patch) (merged map[string][]Patch) {
+	merged = make(map[string][]Patch)
+
+	for _, m := range []map[string][]Patch{a, b} {
+		for name, patches := range m {
+			merged[name] = append(merged[name], patches...)
+		}
+	}
+
+	return merged
+}
+
+// PatchContents returns the contents of the patches, as the Talos config patcher takes them.
+func PatchContents(patches []Patch) (contents []string) {
+	contents = make([]string, 0, len(patches))
+	for _, p := range patches {
+		contents = append(contents, string(p.Content))
+	}
+
+	return contents
+}
+
+// PatchSources returns where each of the patches came from.
+func PatchSources(patches []Patch) (sources []string) {
+	sources = make([]string, 0, len(patches))
+	for _, p := range patches {
+		sources = append(sources, p.Source)
+	}
+
+	return sources
+}
+
+// PatchSetFromSecretData extracts the cluster, purpose, and node patches from the contents of a secret.  The role patch, patch.yaml, is left to the caller, as it can be overridden by a file.
+//
+// A patch key that isn't one of the known forms is an error, rather than a patch for a node nobody has, so a typo like patch-purposes-ingress.yaml doesn't silently drop the patch.
+func PatchSetFromSecretData(secretData map[string]interface{}) (ps PatchSet, err error) {
+	ps.Purposes = make(map[string][]Patch)
+	ps.Nodes = make(map[string][]Patch)
+
+	keys := make([]string, 0, len(secretData))
+	for key := range secretData {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, PatchKeyPrefix) || !strings.HasSuffix(key, PatchKeySuffix) {
+			continue
+		}
+
+		content, ok := secretData[key].(string)
+		if !ok {
+			err = errors.Errorf("patch %s in secret is not a string", key)
+			return ps, err
+		}
+
+		patch := Patch{Source: key, Content: []byte(content)}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, PatchKeyPrefix), PatchKeySuffix)
+
+		switch {
+		case key == ClusterPatchKey:
+			ps.Cluster = append(ps.Cluster, patch)
+		case strings.HasPrefix(key, PurposePatchKeyPrefix):
+			purpose := strings.TrimSuffix(strings.TrimPrefix(key, PurposePatchKeyPrefix), PatchKeySuffix)
+			if !validPatchName(purpose) {
+				err = errors.Errorf("bad purpose patch key %s in secret: %q is not a valid purpose", key, purpose)
+				return ps, err
+			}
+
+			ps.Purposes[purpose] = append(ps.Purposes[purpose], patch)
+		case strings.HasPrefix(name, "cluster") || strings.HasPrefix(name, "purpose"):
+			err = errors.Errorf("unknown patch key %s in secret.  Expected %s, %s, or %s", key, ClusterPatchKey, PurposePatchKey("<purpose>"), NodePatchKey("<node name>"))
+			return ps, err
+		default:
+			if !validPatchName(name) {
+				err = errors.Errorf("bad node patch key %s in secret: %q is not a valid node name", key, name)
+				return ps, err
+			}
+
+			ps.Nodes[name] = append(ps.Nodes[name], patch)
+		}
+	}
+
+	return ps, err
+}
+
+// validPatchName reports whether name could be a node name or purpose: lower case letters, digits and dashes, not starting or ending with a dash.
+func validPatchName(name string) (valid bool) {
+	if name == "" || strings.HasPrefix(name, "-") || strings.HasSuffix(name, "-") {
+		return valid
+	}
+
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return valid
+		}
+	}
+
+	valid = true
+
+	return valid
+}
+
+// LoadPatchDir loads the patches for the nodes of a role from a directory laid out like:
+//
+//	cluster/*.yaml
+//	roles/<role>/*.yaml
+//	purposes/<purpose>/*.yaml
+//	nodes/<node name>/*.yaml
+//
+// Any of them may be missing.  Within a directory, files are applied in name order.  .yml and .json files are read too.
+func LoadPatchDir(dir string, nodeRole string) (ps PatchSet, err error) {
+	info, statErr := os.Stat(dir)
+	if statErr != nil {
+		err = errors.Wrapf(statErr, "failed reading patches directory %s", dir)
+		return ps, err
+	}
+
+	if !info.IsDir() {
+		err = errors.Errorf("patches directory %s is not a directory", dir)
+		return ps, err
+	}
+
+	ps.Cluster, err = loadPatchFiles(filepath.Join(dir, ClusterPatchDir))
+	if err != nil {
+		return ps, err
+	}
+
+	ps.Role, err = loadPatchFiles(filepath.Join(dir, RolePatchDir, nodeRole))
+	if err != nil {
+		return ps, err
+	}
+
+	ps.Purposes, err = loadPatchSubdirs(filepath.Join(dir, PurposePatchDir))
+	if err != nil {
+		return ps, err
+	}
+
+	ps.Nodes, err = loadPatchSubdirs(filepath.Join(dir, NodePatchDir))
+	if err != nil {
+		return ps, err
+	}
+
+	return ps, err
+}
+
+// loadPatchSubdirs loads the patches in each directory below dir, keyed by the directory's name.
+func loadPatchSubdirs(dir string) (patches map[string][]Patch, err error) {
+	patches = make(map[string][]Patch)
+
+	entries, readErr := os.ReadDir(dir)
+	if os.IsNotExist(readErr) {
+		return patches, err
+	}
+
+	if readErr != nil {
+		err = errors.Wrapf(readErr, "failed reading patches directory %s", dir)
+		return patches, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		dirPatches, loadErr := loadPatchFiles(filepath.Join(dir, entry.Name()))
+		if loadErr != nil {
+			err = loadErr
+			return patches, err
+		}
+
+		patches[entry.Name()] = dirPatches
+	}
+
+	return patches, err
+}
+
+// loadPatchFiles loads the patch files in dir, in name order.  A missing directory has no patches.
+func loadPatchFiles(dir string) (patches []Patch, err error) {
+	entries, readErr := os.ReadDir(dir)
+	if os.IsNotExist(readErr) {
+		return patches, err
+	}
+
+	if readErr != nil {
+		err = errors.Wrapf(readErr, "failed reading patches directory %s", dir)
+		return patches, err
+	}
+
+	// ReadDir sorts by name.
+	for _, entry := range entries {
+		if entry.IsDir() || !isPatchFile(entry.Name()) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		content, fileErr := os.ReadFile(path)
+		if fileErr != nil {
+			err = errors.Wrapf(fileErr, "failed reading patch %s", path)
+			return patches, err
+		}
+
+		patches = append(patches, Patch{Source: path, Content: content})
+	}
+
+	return patches, err
+}
+
+func isPatchFile(name string) (ok bool) {
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		ok = true
+	}
+
+	return ok
+}
@@ -0,0 +1,160 @@
+package manager
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPatchSetForNode(t *testing.T) {
+	ps := PatchSet{
+		Cluster: []Patch{{Source: "cluster"}},
+		Role:    []Patch{{Source: "role"}},
+		Purposes: map[string][]Patch{
+			"ingress": {{Source: "purpose-ingress"}},
+			"gpu":     {{Source: "purpose-gpu"}},
+		},
+		Nodes: map[string][]Patch{
+			"prod-worker-1": {{Source: "node-1a"}, {Source: "node-1b"}},
+			"prod-worker-2": {{Source: "node-2"}},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		node     string
+		purpose  string
+		expected []string
+	}{
+		{
+			name:     "all layers",
+			node:     "prod-worker-1",
+			purpose:  "ingress",
+			expected: []string{"cluster", "role", "purpose-ingress", "node-1a", "node-1b"},
+		},
+		{
+			name:     "no purpose",
+			node:     "prod-worker-2",
+			expected: []string{"cluster", "role", "node-2"},
+		},
+		{
+			name:     "no node patches",
+			node:     "prod-worker-3",
+			purpose:  "gpu",
+			expected: []string{"cluster", "role", "purpose-gpu"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, PatchSources(ps.ForNode(tc.node, tc.purpose)), "patches do not meet expectations")
+		})
+	}
+}
+
+func TestPatchSetFromSecretData(t *testing.T) {
+	secretData := map[string]interface{}{
+		"config.yaml":                "config",
+		"patch.yaml":                 "role",
+		"patch-cluster.yaml":         "cluster",
+		"patch-purpose-ingress.yaml": "ingress",
+		"patch-prod-worker-1.yaml":   "node",
+		"patch-notes.txt":            "ignored",
+		"node-aws.yaml":              "ignored",
+	}
+
+	expected := PatchSet{
+		Cluster:  []Patch{{Source: "patch-cluster.yaml", Content: []byte("cluster")}},
+		Purposes: map[string][]Patch{"ingress": {{Source: "patch-purpose-ingress.yaml", Content: []byte("ingress")}}},
+		Nodes:    map[string][]Patch{"prod-worker-1": {{Source: "patch-prod-worker-1.yaml", Content: []byte("node")}}},
+	}
+
+	ps, err := PatchSetFromSecretData(secretData)
+	assert.NoError(t, err, "error does not meet expectations")
+	assert.Equal(t, expected, ps, "patches do not meet expectations")
+}
+
+func TestPatchSetFromSecretDataUnknownKeys(t *testing.T) {
+	cases := []struct {
+		name string
+		key  string
+	}{
+		{"misspelled purpose", "patch-purposes-ingress.yaml"},
+		{"purpose without a name", "patch-purpose-.yaml"},
+		{"misspelled cluster", "patch-clusters.yaml"},
+		{"bad node name", "patch-Prod_Worker.yaml"},
+		{"empty node name", "patch-.yaml"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := PatchSetFromSecretData(map[string]interface{}{tc.key: "patch"})
+			assert.Error(t, err, "error does not meet expectations")
+		})
+	}
+}
+
+func TestLoadPatchDir(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"cluster/20-b.yaml":                 "cluster b",
+		"cluster/10-a.yaml":                 "cluster a",
+		"cluster/README.md":                 "ignored",
+		"roles/worker/patch.yml":            "worker",
+		"roles/controlplane/patch.yaml":     "controlplane",
+		"purposes/ingress/patch.json":       "ingress",
+		"nodes/prod-worker-1/hostname.yaml": "node",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatalf("failed making dir: %s", err)
+		}
+
+		err = os.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("failed writing %s: %s", path, err)
+		}
+	}
+
+	ps, err := LoadPatchDir(dir, NodeRoleWorker)
+	if err != nil {
+		t.Fatalf("failed loading patches: %s", err)
+	}
+
+	expected := []string{
+		filepath.Join(dir, "cluster/10-a.yaml"),
+		filepath.Join(dir, "cluster/20-b.yaml"),
+		filepath.Join(dir, "roles/worker/patch.yml"),
+		filepath.Join(dir, "purposes/ingress/patch.json"),
+		filepath.Join(dir, "nodes/prod-worker-1/hostname.yaml"),
+	}
+
+	assert.Equal(t, expected, PatchSources(ps.ForNode("prod-worker-1", "ingress")), "patches do not meet expectations")
+
+	// Directory patches go after the secret's, layer by layer.
+	secret := PatchSet{
+		Cluster: []Patch{{Source: "patch-cluster.yaml"}},
+		Role:    []Patch{{Source: "patch.yaml"}},
+	}
+
+	merged := secret.Merge(ps)
+
+	expected = []string{
+		"patch-cluster.yaml",
+		filepath.Join(dir, "cluster/10-a.yaml"),
+		filepath.Join(dir, "cluster/20-b.yaml"),
+		"patch.yaml",
+		filepath.Join(dir, "roles/worker/patch.yml"),
+	}
+
+	assert.Equal(t, expected, PatchSources(merged.ForNode("prod-worker-2", "")), "merged patches do not meet expectations")
+
+	_, err = LoadPatchDir(filepath.Join(dir, "missing"), NodeRoleWorker)
+	assert.Error(t, err, "a missing patches directory should be an error")
+}
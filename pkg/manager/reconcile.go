@@ -3,6 +3,7 @@ package manager
 import (
 	"context"
 	"fmt"
+	"strings"
 )
 
 // AWSReconciler provides AWS-specific reconciliation methods.
@@ -28,6 +29,156 @@ type ReconciliationReport struct {
 	LBWithoutEC2      map[string][]string // LB name -> targets without EC2 instance
 }
 
+// DNSMismatch is a node whose DNS record points somewhere other than the node's IP.
+type DNSMismatch struct {
+	Node   NodeInfo
+	Record DNSRecord
+}
+
+// DNSReconciliation contains discrepancies between a cluster's instances and its DNS records.
+type DNSReconciliation struct {
+	Records    []DNSRecord   // Records belonging to the cluster
+	Orphaned   []DNSRecord   // Records marked as the cluster's, pointing at IPs that don't belong to any cluster instance
+	Unclaimed  []DNSRecord   // Records that only look like the cluster's by name, pointing at IPs that don't belong to any cluster instance.  They may be somebody else's, so are never deleted.
+	Missing    []NodeInfo    // Instances with no record
+	Mismatched []DNSMismatch // Records whose IP differs from the instance's IP
+}
+
+// ReconcileDNS compares the cluster's instances with the DNS records in the zone.
+// A record is considered part of the cluster if it's named after one of the cluster's nodes, is named with the cluster name as a prefix, or carries a comment naming the cluster.
+// Only records with an ownership record, or a comment naming the cluster, can be orphaned.  Stray records that merely share the name prefix are reported as unclaimed.
+func ReconcileDNS(clusterName string, nodes []NodeInfo, records []DNSRecord) (report DNSReconciliation) {
+	report = DNSReconciliation{
+		Records:    make([]DNSRecord, 0),
+		Orphaned:   make([]DNSRecord, 0),
+		Unclaimed:  make([]DNSRecord, 0),
+		Missing:    make([]NodeInfo, 0),
+		Mismatched: make([]DNSMismatch, 0),
+	}
+
+	nodesByName := make(map[string]NodeInfo)
+	nodeIPs := make(map[string]bool)
+
+	// Instances without a name or an IP (e.g. terminated) can't have a meaningful record.
+	for _, node := range nodes {
+		if node.Name == "" || node.IP == "" {
+			continue
+		}
+
+		nodesByName[shortName(node.Name)] = node
+		nodeIPs[node.IP] = true
+	}
+
+	recordNames := make(map[string]bool)
+
+	for _, record := range records {
+		name := shortName(record.Name)
+		node, isNode := nodesByName[name]
+
+		claimed := record.Owned || RecordCommentNamesCluster(record.Comment, clusterName)
+
+		if !isNode && !claimed && !strings.HasPrefix(name, clusterName+"-") {
+			continue
+		}
+
+		report.Records = append(report.Records, record)
+		recordNames[name] = true
+
+		if isNode {
+			if record.Content != node.IP {
+				report.Mismatched = append(report.Mismatched, DNSMismatch{Node: node, Record: record})
+			}
+
+			continue
+		}
+
+		if nodeIPs[record.Content] {
+			continue
+		}
+
+		if claimed {
+			report.Orphaned = append(report.Orphaned, record)
+			continue
+		}
+
+		report.Unclaimed = append(report.Unclaimed, record)
+	}
+
+	for _, node := range nodes {
+		if node.Name == "" || node.IP == "" {
+			continue
+		}
+
+		if !recordNames[shortName(node.Name)] {
+			report.Missing = append(report.Missing, node)
+		}
+	}
+
+	return report
+}
+
+// IssueCount returns the number of discrepancies in the report that can be fixed.  Unclaimed records are left for a human.
+func (r DNSReconciliation) IssueCount() (count int) {
+	count = len(r.Orphaned) + len(r.Missing) + len(r.Mismatched)
+	return count
+}
+
+// DNSFix is what fixing a DNSReconciliation will change, and what it has to leave alone.
+type DNSFix struct {
+	Delete   []DNSRecord // Orphaned records to delete
+	Register []NodeInfo  // Instances whose record is missing or has the wrong IP
+	Skipped  []DNSRecord // Orphaned or mismatched records that ownership tracking says aren't ours to change
+}
+
+// Fix works out what fixing the report will change.  If ownership is tracked, only records with an ownership record can be deleted or overwritten.  The rest are skipped, as the DNS manager would refuse them.
+func (r DNSReconciliation) Fix(ownershipTracked bool) (fix DNSFix) {
+	fix = DNSFix{
+		Delete:   make([]DNSRecord, 0),
+		Register: make([]NodeInfo, 0),
+		Skipped:  make([]DNSRecord, 0),
+	}
+
+	for _, record := range r.Orphaned {
+		if ownershipTracked && !record.Owned {
+			fix.Skipped = append(fix.Skipped, record)
+			continue
+		}
+
+		fix.Delete = append(fix.Delete, record)
+	}
+
+	fix.Register = append(fix.Register, r.Missing...)
+
+	for _, mismatch := range r.Mismatched {
+		if ownershipTracked && !mismatch.Record.Owned {
+			fix.Skipped = append(fix.Skipped, mismatch.Record)
+			continue
+		}
+
+		fix.Register = append(fix.Register, mismatch.Node)
+	}
+
+	return fix
+}
+
+// RecordCommentNamesCluster reports whether a record comment contains a `cluster=<name>` token for the given cluster.
+func RecordCommentNamesCluster(comment string, clusterName string) (names bool) {
+	for _, token := range strings.Fields(comment) {
+		if token == "cluster="+clusterName {
+			names = true
+			return names
+		}
+	}
+
+	return names
+}
+
+// shortName strips the domain from a host name.  E.g. "charlie-cp-1.terrace.fi" -> "charlie-cp-1".
+func shortName(name string) (short string) {
+	short = strings.Split(name, ".")[0]
+	return short
+}
+
 // ReconcileCluster performs a comprehensive reconciliation of cluster state.
 func ReconcileCluster(ctx context.Context, clusterName string, cm K8sClusterManager, verbose bool) (report ReconciliationReport, err error) {
 	report = ReconciliationReport{
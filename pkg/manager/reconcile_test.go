@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReconcileDNS(t *testing.T) {
+	nodes := []NodeInfo{
+		{Name: "prod-cp-1", ID: "i-0000000000000001", IP: "10.0.1.1"},
+		{Name: "prod-worker-1", ID: "i-0000000000000002", IP: "10.0.1.2"},
+		{Name: "prod-worker-2", ID: "i-0000000000000003", IP: "10.0.1.3"},
+		{Name: "prod-worker-3", ID: "i-0000000000000004", IP: ""}, // terminated
+	}
+
+	records := []DNSRecord{
+		{ID: "1", Name: "prod-cp-1.example.com", Type: "A", Content: "10.0.1.1"},
+		{ID: "2", Name: "prod-worker-1.example.com", Type: "A", Content: "10.0.9.9"},
+		{ID: "3", Name: "prod-worker-9.example.com", Type: "A", Content: "10.0.1.9"},
+		{ID: "4", Name: "www.example.com", Type: "A", Content: "10.0.5.5"},
+		{ID: "5", Name: "legacy.example.com", Type: "A", Content: "10.0.7.7", Comment: "k8s-cluster-manager cluster=prod instance=i-0000000000000009"},
+		{ID: "6", Name: "staging-worker-1.example.com", Type: "A", Content: "10.0.8.8", Comment: "k8s-cluster-manager cluster=prod-staging"},
+		{ID: "7", Name: "prod-alias.example.com", Type: "A", Content: "10.0.1.3"},
+		{ID: "8", Name: "prod-worker-8.example.com", Type: "A", Content: "10.0.1.8", Owned: true},
+	}
+
+	report := ReconcileDNS("prod", nodes, records)
+
+	assert.Len(t, report.Records, 6, "cluster records do not meet expectations")
+
+	orphaned := make([]string, 0)
+	for _, record := range report.Orphaned {
+		orphaned = append(orphaned, record.ID)
+	}
+	assert.Equal(t, []string{"5", "8"}, orphaned, "orphaned records do not meet expectations")
+
+	unclaimed := make([]string, 0)
+	for _, record := range report.Unclaimed {
+		unclaimed = append(unclaimed, record.ID)
+	}
+	assert.Equal(t, []string{"3"}, unclaimed, "unclaimed records do not meet expectations")
+
+	missing := make([]string, 0)
+	for _, node := range report.Missing {
+		missing = append(missing, node.Name)
+	}
+	assert.Equal(t, []string{"prod-worker-2"}, missing, "missing records do not meet expectations")
+
+	if assert.Len(t, report.Mismatched, 1, "mismatched records do not meet expectations") {
+		assert.Equal(t, "prod-worker-1", report.Mismatched[0].Node.Name)
+		assert.Equal(t, "10.0.9.9", report.Mismatched[0].Record.Content)
+	}
+
+	assert.Equal(t, 4, report.IssueCount(), "issue count does not meet expectations")
+}
+
+func TestDNSReconciliationFix(t *testing.T) {
+	report := DNSReconciliation{
+		Orphaned: []DNSRecord{
+			{ID: "1", Name: "prod-worker-8.example.com", Type: "A", Content: "10.0.1.8", Owned: true},
+			{ID: "2", Name: "legacy.example.com", Type: "A", Content: "10.0.7.7", Comment: "k8s-cluster-manager cluster=prod"},
+		},
+		Missing: []NodeInfo{{Name: "prod-worker-2", IP: "10.0.1.3"}},
+		Mismatched: []DNSMismatch{
+			{Node: NodeInfo{Name: "prod-worker-1", IP: "10.0.1.2"}, Record: DNSRecord{ID: "3", Name: "prod-worker-1.example.com", Content: "10.0.9.9", Owned: true}},
+			{Node: NodeInfo{Name: "prod-worker-4", IP: "10.0.1.4"}, Record: DNSRecord{ID: "4", Name: "prod-worker-4.example.com", Content: "10.0.9.4"}},
+		},
+	}
+
+	ids := func(records []DNSRecord) (ids []string) {
+		ids = make([]string, 0)
+		for _, record := range records {
+			ids = append(ids, record.ID)
+		}
+
+		return ids
+	}
+
+	names := func(nodes []NodeInfo) (names []string) {
+		names = make([]string, 0)
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+
+		return names
+	}
+
+	untracked := report.Fix(false)
+	assert.Equal(t, []string{"1", "2"}, ids(untracked.Delete), "deletions without ownership tracking do not meet expectations")
+	assert.Equal(t, []string{"prod-worker-2", "prod-worker-1", "prod-worker-4"}, names(untracked.Register), "registrations without ownership tracking do not meet expectations")
+	assert.Empty(t, untracked.Skipped, "nothing should be skipped without ownership tracking")
+
+	tracked := report.Fix(true)
+	assert.Equal(t, []string{"1"}, ids(tracked.Delete), "deletions with ownership tracking do not meet expectations")
+	assert.Equal(t, []string{"prod-worker-2", "prod-worker-1"}, names(tracked.Register), "registrations with ownership tracking do not meet expectations")
+	assert.Equal(t, []string{"2", "4"}, ids(tracked.Skipped), "skipped records do not meet expectations")
+}
+
+func TestRecordCommentNamesCluster(t *testing.T) {
+	cases := []struct {
+		name     string
+		comment  string
+		cluster  string
+		expected bool
+	}{
+		{"match", "k8s-cluster-manager cluster=prod instance=i-1", "prod", true},
+		{"other cluster", "k8s-cluster-manager cluster=prod-2", "prod", false},
+		{"no comment", "", "prod", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, RecordCommentNamesCluster(tc.comment, tc.cluster))
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package manager
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// ClusterConfigKey is the optional key in the secret holding the cluster config.
+const ClusterConfigKey = "cluster.yaml"
+
+// TalosMachineConfigKey is the key in the secret holding the Talos machine config.
+const TalosMachineConfigKey = "config.yaml"
+
+// TalosMachineConfigPatchKey is the key in the secret holding the Talos machine config patch.
+const TalosMachineConfigPatchKey = "patch.yaml"
+
+// TalosconfigKey is the optional key in the control plane secret holding the admin talosconfig for the cluster.  Worker secrets never hold it.
+const TalosconfigKey = "talosconfig"
+
+// KubeconfigKey is the optional key in the control plane secret holding an admin kubeconfig for the cluster.  Worker secrets never hold it.
+const KubeconfigKey = "kubeconfig"
+
+// TalosSecretsBundleKey is the optional key in the control plane secret holding the Talos secrets bundle the configs were generated from.
+const TalosSecretsBundleKey = "secrets.yaml"
+
+// ErrSecretNotFound is returned, wrapped, by backends that can tell a secret doesn't exist from failing to read it.  Test for it with errors.Is.
+//
+//nolint:gochecknoglobals // Sentinel error
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretBackend is somewhere cluster secrets are kept.  Every backend uses the same layout: one secret per cluster and node role, named by SecretName, holding the keys read by ConfigsFromBackend.
+type SecretBackend interface {
+	ReadSecret(name string, verbose bool) (data map[string]interface{}, err error)
+	WriteSecret(name string, data map[string]interface{}, verbose bool) (err error)
+}
+
+type ConfigData struct {
+	TalosMachineConfig      []byte
+	TalosMachineConfigPatch []byte
+	NodeConfig              []byte
+	ClusterConfig           []byte
+	Talosconfig             []byte
+	Kubeconfig              []byte
+	CloudflareAPIToken      string
+	CloudflareZoneID        string
+	Patches                 PatchSet // Cluster, purpose, and node patches.  The role patch is TalosMachineConfigPatch.
+}
+
+// SecretName is the name of the secret holding the configs for a cluster's node role.
+func SecretName(clusterName string, nodeRole string) (name string) {
+	name = fmt.Sprintf("cluster-%s-%s", clusterName, nodeRole)
+	return name
+}
+
+// NodeConfigKey is the key in the secret holding the node config for a cloud provider.
+func NodeConfigKey(cloudProvider string) (key string) {
+	key = fmt.Sprintf("node-%s.yaml", cloudProvider)
+	return key
+}
+
+// ConfigsFromBackend loads the cluster configs for a node role from a secret backend.
+func ConfigsFromBackend(backend SecretBackend, clusterName string, nodeRole string, cloudProvider string, verbose bool) (data ConfigData, err error) {
+	name := SecretName(clusterName, nodeRole)
+
+	VerboseOutput(verbose, "Loading machine config from secret %s", name)
+
+	secretData, secretErr := backend.ReadSecret(name, verbose)
+	if secretErr != nil {
+		err = errors.Wrapf(secretErr, "failed getting secret %s", name)
+		return data, err
+	}
+
+	data, err = ConfigDataFromSecretData(secretData, cloudProvider)
+
+	return data, err
+}
+
+// ConfigDataFromSecretData extracts the cluster configs from the contents of a secret.
+func ConfigDataFromSecretData(secretData map[string]interface{}, cloudProvider string) (data ConfigData, err error) {
+	nodeKey := NodeConfigKey(cloudProvider)
+
+	c, ok := secretData[TalosMachineConfigKey].(string)
+	if !ok {
+		err = errors.New("Could not extract bytes for config.yaml from secret")
+		return data, err
+	}
+
+	data.TalosMachineConfig = []byte(c)
+
+	p, ok := secretData[TalosMachineConfigPatchKey].(string)
+	if !ok {
+		err = errors.New("Could not extract bytes for patch.yaml from secret")
+		return data, err
+	}
+
+	data.TalosMachineConfigPatch = []byte(p)
+
+	data.Patches, err = PatchSetFromSecretData(secretData)
+	if err != nil {
+		return data, err
+	}
+
+	n, ok := secretData[nodeKey].(string)
+	if !ok {
+		err = errors.New(fmt.Sprintf("Could not extract bytes for %s from secret", nodeKey))
+		return data, err
+	}
+
+	data.NodeConfig = []byte(n)
+
+	cc, ok := secretData[ClusterConfigKey].(string)
+	if ok {
+		data.ClusterConfig = []byte(cc)
+	}
+
+	tc, ok := secretData[TalosconfigKey].(string)
+	if ok {
+		data.Talosconfig = []byte(tc)
+	}
+
+	kc, ok := secretData[KubeconfigKey].(string)
+	if ok {
+		data.Kubeconfig = []byte(kc)
+	}
+
+	zoneIDFromSecret, ok := secretData[CloudflareZoneIDEnvVar].(string)
+	if ok {
+		data.CloudflareZoneID = zoneIDFromSecret
+	}
+
+	cfTokenFromSecret, ok := secretData[CloudflareAPITokenEnvVar].(string)
+	if ok {
+		data.CloudflareAPIToken = cfTokenFromSecret
+	}
+
+	return data, err
+}
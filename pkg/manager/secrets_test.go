@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestConfigDataFromSecretData(t *testing.T) {
+	secretData := map[string]interface{}{
+		"config.yaml":              "config",
+		"patch.yaml":               "patch",
+		"node-aws.yaml":            "node",
+		"CLOUDFLARE_ZONE_ID":       "zone",
+		"CLOUDFLARE_API_TOKEN":     "token",
+		ClusterConfigKey:           "cluster",
+		KubeconfigKey:              "kube",
+		"patch-prod-worker-1.yaml": "node patch",
+		"some-other-key-ignored":   "x",
+	}
+
+	expected := ConfigData{
+		TalosMachineConfig:      []byte("config"),
+		TalosMachineConfigPatch: []byte("patch"),
+		NodeConfig:              []byte("node"),
+		ClusterConfig:           []byte("cluster"),
+		Kubeconfig:              []byte("kube"),
+		CloudflareAPIToken:      "token",
+		CloudflareZoneID:        "zone",
+		Patches: PatchSet{
+			Purposes: map[string][]Patch{},
+			Nodes: map[string][]Patch{
+				"prod-worker-1": {{Source: "patch-prod-worker-1.yaml", Content: []byte("node patch")}},
+			},
+		},
+	}
+
+	actual, err := ConfigDataFromSecretData(secretData, "aws")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual, "config data does not meet expectations")
+
+	_, err = ConfigDataFromSecretData(secretData, "gcp")
+	assert.Error(t, err, "missing node config should be an error")
+
+	assert.Equal(t, "cluster-prod-worker", SecretName("prod", "worker"))
+}
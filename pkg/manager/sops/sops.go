@@ -0,0 +1,215 @@
+package sops
+
+import (
+	"fmt"
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	"github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/config"
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/getsops/sops/v3/keyservice"
+	sopsyaml "github.com/getsops/sops/v3/stores/yaml"
+	"github.com/getsops/sops/v3/version"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+)
+
+// SOPSBackend is a SecretBackend holding each secret in a SOPS encrypted YAML file, e.g. in a git repo.  Files are named <secret>.yaml, and hold the same keys as the Vault secret.
+//
+// Keys are found the way the sops CLI finds them, e.g. age identities from SOPS_AGE_KEY_FILE or ~/.config/sops/age/keys.txt, and PGP keys from the gpg agent.  New files are encrypted for AgeRecipients if given, or else by the creation rules in the nearest .sops.yaml.
+type SOPSBackend struct {
+	Dir           string
+	AgeRecipients string // Optional: comma separated age recipients to encrypt new files for.
+}
+
+// NewSOPSBackend creates a secret backend reading from the files in dir.
+func NewSOPSBackend(dir string, ageRecipients string) (backend SOPSBackend) {
+	backend = SOPSBackend{
+		Dir:           dir,
+		AgeRecipients: ageRecipients,
+	}
+
+	return backend
+}
+
+// SecretFile is the file holding the secret called name.
+func (b SOPSBackend) SecretFile(name string) (path string) {
+	path = filepath.Join(b.Dir, fmt.Sprintf("%s.yaml", name))
+	return path
+}
+
+// ReadSecret decrypts the file holding the secret called name.
+func (b SOPSBackend) ReadSecret(name string, verbose bool) (data map[string]interface{}, err error) {
+	path := b.SecretFile(name)
+
+	manager.VerboseOutput(verbose, "Decrypting %s", path)
+
+	encrypted, readErr := os.ReadFile(path)
+	if os.IsNotExist(readErr) {
+		err = errors.Wrapf(manager.ErrSecretNotFound, "no file %s", path)
+		return data, err
+	}
+
+	if readErr != nil {
+		err = errors.Wrapf(readErr, "failed reading %s", path)
+		return data, err
+	}
+
+	cleartext, decryptErr := decrypt.Data(encrypted, "yaml")
+	if decryptErr != nil {
+		err = errors.Wrapf(decryptErr, "failed decrypting %s", path)
+		return data, err
+	}
+
+	data, err = ParseSecret(cleartext)
+	if err != nil {
+		err = errors.Wrapf(err, "failed parsing %s", path)
+		return data, err
+	}
+
+	return data, err
+}
+
+// WriteSecret encrypts data into the file for the secret called name, replacing what's there.
+func (b SOPSBackend) WriteSecret(name string, data map[string]interface{}, verbose bool) (err error) {
+	path, pathErr := filepath.Abs(b.SecretFile(name))
+	if pathErr != nil {
+		err = errors.Wrapf(pathErr, "failed finding absolute path of %s", b.SecretFile(name))
+		return err
+	}
+
+	manager.VerboseOutput(verbose, "Encrypting %s", path)
+
+	cleartext, marshalErr := yaml.Marshal(data)
+	if marshalErr != nil {
+		err = errors.Wrapf(marshalErr, "failed marshalling secret %s", name)
+		return err
+	}
+
+	metadata, metadataErr := b.metadata(path)
+	if metadataErr != nil {
+		err = metadataErr
+		return err
+	}
+
+	store := sopsyaml.NewStore(&config.YAMLStoreConfig{})
+
+	branches, loadErr := store.LoadPlainFile(cleartext)
+	if loadErr != nil {
+		err = errors.Wrapf(loadErr, "failed loading secret %s", name)
+		return err
+	}
+
+	tree := sops.Tree{
+		Branches: branches,
+		Metadata: metadata,
+		FilePath: path,
+	}
+
+	dataKey, keyErrs := tree.GenerateDataKeyWithKeyServices([]keyservice.KeyServiceClient{keyservice.NewLocalClient()})
+	if len(keyErrs) > 0 {
+		err = errors.Errorf("failed generating data key: %v", keyErrs)
+		return err
+	}
+
+	err = common.EncryptTree(common.EncryptTreeOpts{
+		DataKey: dataKey,
+		Tree:    &tree,
+		Cipher:  aes.NewCipher(),
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed encrypting secret %s", name)
+		return err
+	}
+
+	encrypted, emitErr := store.EmitEncryptedFile(tree)
+	if emitErr != nil {
+		err = errors.Wrapf(emitErr, "failed encoding secret %s", name)
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating %s", filepath.Dir(path))
+		return err
+	}
+
+	err = os.WriteFile(path, encrypted, 0600)
+	if err != nil {
+		err = errors.Wrapf(err, "failed writing %s", path)
+		return err
+	}
+
+	return err
+}
+
+// metadata says whom a new file at path is encrypted for.
+func (b SOPSBackend) metadata(path string) (metadata sops.Metadata, err error) {
+	metadata.Version = version.Version
+
+	if b.AgeRecipients != "" {
+		ageKeys, ageErr := age.MasterKeysFromRecipients(b.AgeRecipients)
+		if ageErr != nil {
+			err = errors.Wrapf(ageErr, "invalid age recipients")
+			return metadata, err
+		}
+
+		group := make(sops.KeyGroup, 0, len(ageKeys))
+		for _, k := range ageKeys {
+			group = append(group, k)
+		}
+
+		metadata.KeyGroups = []sops.KeyGroup{group}
+
+		return metadata, err
+	}
+
+	confPath, findErr := config.FindConfigFile(path)
+	if findErr != nil {
+		err = errors.Wrapf(findErr, "no age recipients given, and no .sops.yaml found for %s", path)
+		return metadata, err
+	}
+
+	rule, ruleErr := config.LoadCreationRuleForFile(confPath, path, make(map[string]*string))
+	if ruleErr != nil {
+		err = errors.Wrapf(ruleErr, "failed loading creation rules from %s", confPath)
+		return metadata, err
+	}
+
+	if rule == nil {
+		err = errors.Errorf("no creation rules in %s", confPath)
+		return metadata, err
+	}
+
+	metadata.KeyGroups = rule.KeyGroups
+	metadata.ShamirThreshold = rule.ShamirThreshold
+	metadata.UnencryptedSuffix = rule.UnencryptedSuffix
+	metadata.EncryptedSuffix = rule.EncryptedSuffix
+	metadata.UnencryptedRegex = rule.UnencryptedRegex
+	metadata.EncryptedRegex = rule.EncryptedRegex
+	metadata.UnencryptedCommentRegex = rule.UnencryptedCommentRegex
+	metadata.EncryptedCommentRegex = rule.EncryptedCommentRegex
+	metadata.MACOnlyEncrypted = rule.MACOnlyEncrypted
+
+	return metadata, err
+}
+
+// ParseSecret parses decrypted YAML into the contents of a secret.
+func ParseSecret(cleartext []byte) (data map[string]interface{}, err error) {
+	data = make(map[string]interface{})
+
+	err = yaml.Unmarshal(cleartext, &data)
+	if err != nil {
+		err = errors.Wrapf(err, "failed unmarshalling secret")
+		return data, err
+	}
+
+	// Leftover sops metadata isn't part of the secret.
+	delete(data, "sops")
+
+	return data, err
+}
@@ -0,0 +1,89 @@
+package sops
+
+import (
+	"filippo.io/age"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestParseSecret(t *testing.T) {
+	input := `config.yaml: |
+  version: v1alpha1
+  machine:
+    type: worker
+patch.yaml: |
+  machine:
+    network: {}
+node-aws.yaml: |
+  image_id: ami-00123456789
+CLOUDFLARE_ZONE_ID: zone
+sops:
+  age:
+    - recipient: age1example
+`
+
+	expected := map[string]interface{}{
+		"config.yaml":        "version: v1alpha1\nmachine:\n  type: worker\n",
+		"patch.yaml":         "machine:\n  network: {}\n",
+		"node-aws.yaml":      "image_id: ami-00123456789\n",
+		"CLOUDFLARE_ZONE_ID": "zone",
+	}
+
+	actual, err := ParseSecret([]byte(input))
+	if err != nil {
+		t.Errorf("failed parsing secret: %s", err)
+	}
+
+	assert.Equal(t, expected, actual, "parsed secret does not meet expectations")
+}
+
+func TestSecretFile(t *testing.T) {
+	backend := NewSOPSBackend("secrets/prod", "")
+	assert.Equal(t, "secrets/prod/cluster-prod-worker.yaml", backend.SecretFile("cluster-prod-worker"))
+}
+
+func TestWriteReadSecret(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed generating age identity: %s", err)
+	}
+
+	t.Setenv("SOPS_AGE_KEY", identity.String())
+
+	backend := NewSOPSBackend(t.TempDir(), identity.Recipient().String())
+
+	expected := map[string]interface{}{
+		"config.yaml":        "version: v1alpha1\n",
+		"patch.yaml":         "machine: {}\n",
+		"CLOUDFLARE_ZONE_ID": "zone",
+	}
+
+	err = backend.WriteSecret("cluster-prod-worker", expected, false)
+	if err != nil {
+		t.Fatalf("failed writing secret: %s", err)
+	}
+
+	encrypted, err := os.ReadFile(backend.SecretFile("cluster-prod-worker"))
+	if err != nil {
+		t.Fatalf("failed reading secret file: %s", err)
+	}
+
+	assert.NotContains(t, string(encrypted), "v1alpha1", "secret was written in the clear")
+
+	actual, err := backend.ReadSecret("cluster-prod-worker", false)
+	if err != nil {
+		t.Fatalf("failed reading secret: %s", err)
+	}
+
+	assert.Equal(t, expected, actual, "secret did not survive the round trip")
+}
+
+func TestReadMissingSecret(t *testing.T) {
+	backend := NewSOPSBackend(t.TempDir(), "")
+
+	_, err := backend.ReadSecret("cluster-prod-worker", false)
+	assert.True(t, errors.Is(err, manager.ErrSecretNotFound), "missing secret does not meet expectations")
+}
@@ -0,0 +1,211 @@
+package talos
+
+import (
+	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"time"
+)
+
+// DefaultTryTimeout is how long Talos keeps a config applied in try mode before rolling it back, unless it's confirmed.  It leaves room to watch the node for TrySettleTime and then confirm.
+const DefaultTryTimeout = 3 * time.Minute
+
+// TrySettleTime is how long a node is left alone after a config is applied in try mode, before its health decides whether the config is kept.  It's longer than the node controller waits for a silent kubelet before marking its node NotReady (node-monitor-grace-period, 40s to 50s), so a node that was Ready when the config went on can't still look Ready only because nobody noticed yet.
+const TrySettleTime = time.Minute
+
+// TryConfirmMargin is the time a try needs after TrySettleTime to check the node and confirm the config, before Talos rolls back by itself.
+const TryConfirmMargin = 30 * time.Second
+
+// TryHealthTimeout is how long a node gets to answer the health check that decides whether a tried config is kept.
+const TryHealthTimeout = 15 * time.Second
+
+// CheckTryTimeout makes sure a try lasts long enough to watch the node and confirm the config before Talos rolls it back.
+func CheckTryTimeout(tryTimeout time.Duration) (err error) {
+	minimum := TrySettleTime + TryConfirmMargin
+	if tryTimeout < minimum {
+		err = errors.Errorf("try timeout %v is too short.  It has to be at least %v, to watch the node for %v and then confirm", tryTimeout, minimum, TrySettleTime)
+		return err
+	}
+
+	return err
+}
+
+// ApplyMode is how a node takes a new machine config, like talosctl apply-config --mode.
+type ApplyMode string
+
+const (
+	ApplyModeAuto     ApplyMode = "auto"
+	ApplyModeReboot   ApplyMode = "reboot"
+	ApplyModeNoReboot ApplyMode = "no-reboot"
+	ApplyModeStaged   ApplyMode = "staged"
+	ApplyModeTry      ApplyMode = "try"
+)
+
+// ApplyModes are the apply modes, in the order they're listed in help text.
+//
+//nolint:gochecknoglobals // Constant list
+var ApplyModes = []ApplyMode{ApplyModeAuto, ApplyModeReboot, ApplyModeNoReboot, ApplyModeStaged, ApplyModeTry}
+
+// ParseApplyMode parses an apply mode name.
+func ParseApplyMode(name string) (mode ApplyMode, err error) {
+	mode = ApplyMode(name)
+
+	for _, m := range ApplyModes {
+		if m == mode {
+			return mode, err
+		}
+	}
+
+	err = errors.Errorf("unknown apply mode %q.  Use one of %v", name, ApplyModes)
+
+	return mode, err
+}
+
+func (m ApplyMode) String() (s string) {
+	s = string(m)
+	return s
+}
+
+// RequestMode is the Talos API mode for the apply mode.  Anything unknown is treated as auto.
+func (m ApplyMode) RequestMode() (reqMode machineapi.ApplyConfigurationRequest_Mode) {
+	switch m {
+	case ApplyModeReboot:
+		reqMode = machineapi.ApplyConfigurationRequest_REBOOT
+	case ApplyModeNoReboot:
+		reqMode = machineapi.ApplyConfigurationRequest_NO_REBOOT
+	case ApplyModeStaged:
+		reqMode = machineapi.ApplyConfigurationRequest_STAGED
+	case ApplyModeTry:
+		reqMode = machineapi.ApplyConfigurationRequest_TRY
+	default:
+		reqMode = machineapi.ApplyConfigurationRequest_AUTO
+	}
+
+	return reqMode
+}
+
+// ApplyResult is what a node reported after taking a machine config.
+type ApplyResult struct {
+	Mode     machineapi.ApplyConfigurationRequest_Mode // The mode the node actually used.  Auto resolves to reboot or no-reboot.
+	Details  string
+	Warnings []string
+	Config   []byte // The config that was sent.
+}
+
+// Rebooting is true if applying the config made the node reboot.
+func (r ApplyResult) Rebooting() (rebooting bool) {
+	rebooting = r.Mode == machineapi.ApplyConfigurationRequest_REBOOT
+	return rebooting
+}
+
+// Staged is true if the config won't take effect until the node next reboots.
+func (r ApplyResult) Staged() (staged bool) {
+	staged = r.Mode == machineapi.ApplyConfigurationRequest_STAGED
+	return staged
+}
+
+// Summary describes the result in a few words, for output.
+func (r ApplyResult) Summary() (summary string) {
+	switch {
+	case r.Rebooting():
+		summary = "node is rebooting"
+	case r.Staged():
+		summary = "staged for the next reboot"
+	case r.Mode == machineapi.ApplyConfigurationRequest_TRY:
+		summary = "applied in try mode"
+	default:
+		summary = "applied without reboot"
+	}
+
+	return summary
+}
+
+// ApplyRequest builds the Talos apply request for the config.  The try timeout is only sent in try mode.
+func ApplyRequest(cfgBytes []byte, mode ApplyMode, tryTimeout time.Duration) (req *machineapi.ApplyConfigurationRequest) {
+	req = &machineapi.ApplyConfigurationRequest{
+		Data:   cfgBytes,
+		Mode:   mode.RequestMode(),
+		DryRun: false,
+	}
+
+	if mode == ApplyModeTry {
+		if tryTimeout <= 0 {
+			tryTimeout = DefaultTryTimeout
+		}
+
+		req.TryModeTimeout = durationpb.New(tryTimeout)
+	}
+
+	return req
+}
+
+// ApplyResultFrom reads the result out of the node's response.
+func ApplyResultFrom(resp *machineapi.ApplyConfigurationResponse, cfgBytes []byte) (result ApplyResult) {
+	result.Config = cfgBytes
+
+	for _, msg := range resp.GetMessages() {
+		result.Mode = msg.GetMode()
+		result.Details = msg.GetModeDetails()
+		result.Warnings = append(result.Warnings, msg.GetWarnings()...)
+	}
+
+	return result
+}
+
+// sendConfig sends an already rendered config to the node.
+func sendConfig(ctx context.Context, tClient *client.Client, nodeName string, nodeIP string, cfgBytes []byte, mode ApplyMode, tryTimeout time.Duration) (result ApplyResult, err error) {
+	resp, applyErr := tClient.ApplyConfiguration(ctx, ApplyRequest(cfgBytes, mode, tryTimeout))
+	if applyErr != nil {
+		err = errors.Wrapf(applyErr, "failed applying machine configuration to %s at %s", nodeName, nodeIP)
+		return result, err
+	}
+
+	result = ApplyResultFrom(resp, cfgBytes)
+
+	return result, err
+}
+
+// ConfirmConfig makes a config applied in try mode permanent.  Talos ends the try when it gets another config, so the same config is sent again without a reboot.
+func ConfirmConfig(ctx context.Context, talosconfig []byte, nodeName string, nodeIP string, cfgBytes []byte, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Confirming config on %s (%s)\n", nodeName, nodeIP)
+
+	tClient, clientErr := NewClient(ctx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return err
+	}
+
+	defer tClient.Close()
+
+	_, err = sendConfig(ctx, tClient, nodeName, nodeIP, cfgBytes, ApplyModeNoReboot, 0)
+	if err != nil {
+		err = errors.Wrapf(err, "failed confirming config on %s", nodeName)
+		return err
+	}
+
+	return err
+}
+
+// RollbackConfig puts back the config a node ran before a try, without waiting for the try to time out.
+func RollbackConfig(ctx context.Context, talosconfig []byte, nodeName string, nodeIP string, previous []byte, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Rolling back config on %s (%s)\n", nodeName, nodeIP)
+
+	tClient, clientErr := NewClient(ctx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return err
+	}
+
+	defer tClient.Close()
+
+	_, err = sendConfig(ctx, tClient, nodeName, nodeIP, previous, ApplyModeNoReboot, 0)
+	if err != nil {
+		err = errors.Wrapf(err, "failed rolling back config on %s", nodeName)
+		return err
+	}
+
+	return err
+}
@@ -0,0 +1,144 @@
+package talos
+
+import (
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseApplyMode(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		mode    ApplyMode
+		reqMode machineapi.ApplyConfigurationRequest_Mode
+		errored bool
+	}{
+		{
+			name:    "auto",
+			input:   "auto",
+			mode:    ApplyModeAuto,
+			reqMode: machineapi.ApplyConfigurationRequest_AUTO,
+		},
+		{
+			name:    "reboot",
+			input:   "reboot",
+			mode:    ApplyModeReboot,
+			reqMode: machineapi.ApplyConfigurationRequest_REBOOT,
+		},
+		{
+			name:    "no-reboot",
+			input:   "no-reboot",
+			mode:    ApplyModeNoReboot,
+			reqMode: machineapi.ApplyConfigurationRequest_NO_REBOOT,
+		},
+		{
+			name:    "staged",
+			input:   "staged",
+			mode:    ApplyModeStaged,
+			reqMode: machineapi.ApplyConfigurationRequest_STAGED,
+		},
+		{
+			name:    "try",
+			input:   "try",
+			mode:    ApplyModeTry,
+			reqMode: machineapi.ApplyConfigurationRequest_TRY,
+		},
+		{
+			name:    "unknown",
+			input:   "interactive",
+			errored: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mode, err := ParseApplyMode(tc.input)
+			if tc.errored {
+				assert.Error(t, err, "expected an error")
+				return
+			}
+
+			assert.NoError(t, err, "unexpected error")
+			assert.Equal(t, tc.mode, mode, "mode does not meet expectations")
+			assert.Equal(t, tc.reqMode, mode.RequestMode(), "request mode does not meet expectations")
+		})
+	}
+}
+
+func TestApplyRequest(t *testing.T) {
+	cfg := []byte("version: v1alpha1")
+
+	req := ApplyRequest(cfg, ApplyModeAuto, 5*time.Minute)
+	assert.Equal(t, machineapi.ApplyConfigurationRequest_AUTO, req.GetMode(), "mode does not meet expectations")
+	assert.Nil(t, req.GetTryModeTimeout(), "try timeout should only be set in try mode")
+	assert.Equal(t, cfg, req.GetData(), "data does not meet expectations")
+
+	req = ApplyRequest(cfg, ApplyModeTry, 5*time.Minute)
+	assert.Equal(t, 5*time.Minute, req.GetTryModeTimeout().AsDuration(), "try timeout does not meet expectations")
+
+	req = ApplyRequest(cfg, ApplyModeTry, 0)
+	assert.Equal(t, DefaultTryTimeout, req.GetTryModeTimeout().AsDuration(), "default try timeout does not meet expectations")
+}
+
+func TestApplyResultFrom(t *testing.T) {
+	cases := []struct {
+		name      string
+		mode      machineapi.ApplyConfigurationRequest_Mode
+		rebooting bool
+		staged    bool
+		summary   string
+	}{
+		{
+			name:      "reboot",
+			mode:      machineapi.ApplyConfigurationRequest_REBOOT,
+			rebooting: true,
+			summary:   "node is rebooting",
+		},
+		{
+			name:    "no reboot",
+			mode:    machineapi.ApplyConfigurationRequest_NO_REBOOT,
+			summary: "applied without reboot",
+		},
+		{
+			name:    "staged",
+			mode:    machineapi.ApplyConfigurationRequest_STAGED,
+			staged:  true,
+			summary: "staged for the next reboot",
+		},
+		{
+			name:    "try",
+			mode:    machineapi.ApplyConfigurationRequest_TRY,
+			summary: "applied in try mode",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &machineapi.ApplyConfigurationResponse{
+				Messages: []*machineapi.ApplyConfiguration{
+					{
+						Mode:        tc.mode,
+						ModeDetails: "details",
+						Warnings:    []string{"some warning"},
+					},
+				},
+			}
+
+			result := ApplyResultFrom(resp, []byte("cfg"))
+
+			assert.Equal(t, tc.rebooting, result.Rebooting(), "rebooting does not meet expectations")
+			assert.Equal(t, tc.staged, result.Staged(), "staged does not meet expectations")
+			assert.Equal(t, tc.summary, result.Summary(), "summary does not meet expectations")
+			assert.Equal(t, []string{"some warning"}, result.Warnings, "warnings do not meet expectations")
+			assert.Equal(t, []byte("cfg"), result.Config, "config does not meet expectations")
+		})
+	}
+}
+
+func TestCheckTryTimeout(t *testing.T) {
+	assert.NoError(t, CheckTryTimeout(DefaultTryTimeout), "default try timeout should be long enough")
+	assert.NoError(t, CheckTryTimeout(TrySettleTime+TryConfirmMargin), "unexpected error")
+	assert.Error(t, CheckTryTimeout(time.Minute), "expected an error")
+}
@@ -0,0 +1,165 @@
+package talos
+
+import (
+	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// BootstrapPollInterval is how often a node is checked while waiting for it during a bootstrap.
+const BootstrapPollInterval = 10 * time.Second
+
+// WaitForAPI waits for the node at nodeIP to answer on the Talos API with the cluster's talosconfig.  Fresh nodes only do that once they've installed and rebooted with their config.
+func WaitForAPI(ctx context.Context, talosconfig []byte, nodeIP string, timeout time.Duration, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Waiting for the Talos API on %s (timeout: %v)", nodeIP, timeout)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(BootstrapPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeoutCtx.Done():
+			err = errors.Errorf("timeout waiting for the Talos API on %s after %v", nodeIP, timeout)
+			return err
+		case <-ticker.C:
+			version, versionErr := NodeVersion(timeoutCtx, talosconfig, nodeIP)
+			if versionErr != nil {
+				manager.VerboseOutput(verbose, "%s not answering yet, continuing to wait...", nodeIP)
+				continue
+			}
+
+			manager.VerboseOutput(verbose, "%s is up, running Talos %s", nodeIP, version)
+			return err
+		}
+	}
+}
+
+// WaitForBoot waits for the node at nodeIP to answer on the Talos API, either with the cluster's talosconfig, or insecurely, as it does in maintenance mode before it has a config.  maintenance is set in the latter case.
+func WaitForBoot(ctx context.Context, talosconfig []byte, nodeIP string, timeout time.Duration, verbose bool) (maintenance bool, err error) {
+	manager.VerboseOutput(verbose, "Waiting for %s to boot (timeout: %v)", nodeIP, timeout)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(BootstrapPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeoutCtx.Done():
+			err = errors.Errorf("timeout waiting for %s to boot after %v", nodeIP, timeout)
+			return maintenance, err
+		case <-ticker.C:
+			version, versionErr := NodeVersion(timeoutCtx, talosconfig, nodeIP)
+			if versionErr == nil {
+				manager.VerboseOutput(verbose, "%s is up, running Talos %s", nodeIP, version)
+				return maintenance, err
+			}
+
+			// A node with a config refuses clients without the cluster's certificate, so answering one means it has none.
+			if inMaintenance(timeoutCtx, nodeIP) {
+				manager.VerboseOutput(verbose, "%s is up in maintenance mode", nodeIP)
+				maintenance = true
+				return maintenance, err
+			}
+
+			manager.VerboseOutput(verbose, "%s not answering yet, continuing to wait...", nodeIP)
+		}
+	}
+}
+
+// inMaintenance reports whether the node at nodeIP answers an insecure client.
+func inMaintenance(ctx context.Context, nodeIP string) (maintenance bool) {
+	tClient, clientErr := NewInsecureClient(ctx, nodeIP)
+	if clientErr != nil {
+		return maintenance
+	}
+
+	defer tClient.Close()
+
+	_, versionErr := tClient.Version(ctx)
+	maintenance = versionErr == nil
+
+	return maintenance
+}
+
+// Bootstrap tells the control plane node at nodeIP to bootstrap etcd.  It must only ever be done once per cluster.  already is set if the node said etcd was bootstrapped before, which isn't an error.
+func Bootstrap(ctx context.Context, talosconfig []byte, nodeIP string, verbose bool) (already bool, err error) {
+	manager.VerboseOutput(verbose, "Bootstrapping etcd on %s", nodeIP)
+
+	tClient, clientErr := NewClient(ctx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return already, err
+	}
+
+	defer tClient.Close()
+
+	bootstrapErr := tClient.Bootstrap(ctx, &machineapi.BootstrapRequest{})
+	if status.Code(bootstrapErr) == codes.AlreadyExists {
+		already = true
+		return already, err
+	}
+
+	if bootstrapErr != nil {
+		err = errors.Wrapf(bootstrapErr, "failed bootstrapping etcd on %s", nodeIP)
+		return already, err
+	}
+
+	return already, err
+}
+
+// Kubeconfig fetches an admin kubeconfig for the cluster from the control plane node at nodeIP.
+func Kubeconfig(ctx context.Context, talosconfig []byte, nodeIP string) (kubeconfig []byte, err error) {
+	tClient, clientErr := NewClient(ctx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return kubeconfig, err
+	}
+
+	defer tClient.Close()
+
+	kubeconfig, err = tClient.Kubeconfig(ctx)
+	if err != nil {
+		err = errors.Wrapf(err, "failed getting kubeconfig from %s", nodeIP)
+		return kubeconfig, err
+	}
+
+	return kubeconfig, err
+}
+
+// WaitForKubeconfig waits for the control plane node at nodeIP to hand out an admin kubeconfig.  It can't until the cluster's Kubernetes secrets exist, shortly after bootstrap.
+func WaitForKubeconfig(ctx context.Context, talosconfig []byte, nodeIP string, timeout time.Duration, verbose bool) (kubeconfig []byte, err error) {
+	manager.VerboseOutput(verbose, "Waiting for a kubeconfig from %s (timeout: %v)", nodeIP, timeout)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(BootstrapPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeoutCtx.Done():
+			err = errors.Errorf("timeout waiting for a kubeconfig from %s after %v", nodeIP, timeout)
+			return kubeconfig, err
+		case <-ticker.C:
+			var kcErr error
+
+			kubeconfig, kcErr = Kubeconfig(timeoutCtx, talosconfig, nodeIP)
+			if kcErr != nil {
+				manager.VerboseOutput(verbose, "No kubeconfig from %s yet: %s", nodeIP, kcErr)
+				continue
+			}
+
+			return kubeconfig, err
+		}
+	}
+}
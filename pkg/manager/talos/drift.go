@@ -0,0 +1,195 @@
+package talos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/cosi-project/runtime/pkg/safe"
+	"github.com/pkg/errors"
+	"github.com/siderolabs/talos/pkg/machinery/config/configloader"
+	"github.com/siderolabs/talos/pkg/machinery/config/encoder"
+	configres "github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"gopkg.in/yaml.v3"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RedactedSecret replaces secrets in configs that are compared, so they're never printed, and never count as drift.
+const RedactedSecret = "REDACTED"
+
+// DriftIgnoredPaths are config paths that don't count as drift.  The cluster identity and CA certificates are generated with the secrets bundle, and the rest are deprecated fields Talos fills in itself.
+//
+//nolint:gochecknoglobals // Constant list
+var DriftIgnoredPaths = []string{
+	"cluster.id",
+	"cluster.ca.crt",
+	"cluster.aggregatorCA.crt",
+	"cluster.etcd.ca.crt",
+	"machine.ca.crt",
+	"debug",
+	"persist",
+}
+
+// LiveConfig fetches the machine config the node at nodeIP is running.
+func LiveConfig(ctx context.Context, talosconfig []byte, nodeIP string) (cfgBytes []byte, err error) {
+	tClient, clientErr := NewClient(ctx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return cfgBytes, err
+	}
+
+	defer tClient.Close()
+
+	mc, getErr := safe.StateGetByID[*configres.MachineConfig](ctx, tClient.COSI, configres.V1Alpha1ID)
+	if getErr != nil {
+		err = errors.Wrapf(getErr, "failed getting machine config from %s", nodeIP)
+		return cfgBytes, err
+	}
+
+	cfgBytes, err = mc.Provider().EncodeBytes(encoder.WithComments(encoder.CommentsDisabled))
+	if err != nil {
+		err = errors.Wrapf(err, "failed encoding machine config from %s", nodeIP)
+		return cfgBytes, err
+	}
+
+	return cfgBytes, err
+}
+
+// FlattenConfig loads a machine config, redacts its secrets, and flattens it into a map of paths, e.g. machine.network.hostname, to values.  Documents other than the v1alpha1 config are prefixed with their kind and name.
+func FlattenConfig(cfgBytes []byte) (flat map[string]string, err error) {
+	cfg, loadErr := configloader.NewFromBytes(cfgBytes)
+	if loadErr != nil {
+		err = errors.Wrapf(loadErr, "failed loading machine config")
+		return flat, err
+	}
+
+	redacted, encodeErr := cfg.RedactSecrets(RedactedSecret).EncodeBytes(encoder.WithComments(encoder.CommentsDisabled))
+	if encodeErr != nil {
+		err = errors.Wrapf(encodeErr, "failed encoding machine config")
+		return flat, err
+	}
+
+	flat = make(map[string]string)
+
+	decoder := yaml.NewDecoder(bytes.NewReader(redacted))
+
+	for {
+		var doc map[string]interface{}
+
+		decodeErr := decoder.Decode(&doc)
+		if errors.Is(decodeErr, io.EOF) {
+			break
+		}
+
+		if decodeErr != nil {
+			err = errors.Wrapf(decodeErr, "failed decoding machine config")
+			return flat, err
+		}
+
+		prefix := ""
+		if kind, ok := doc["kind"].(string); ok {
+			prefix = kind
+			if name, named := doc["name"].(string); named {
+				prefix = fmt.Sprintf("%s/%s", kind, name)
+			}
+
+			prefix += ":"
+		}
+
+		flattenValue(flat, prefix, doc)
+	}
+
+	return flat, err
+}
+
+func flattenValue(flat map[string]string, path string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			flat[path] = "{}"
+			return
+		}
+
+		for key, child := range v {
+			childPath := path + key
+			if path != "" && !strings.HasSuffix(path, ":") {
+				childPath = path + "." + key
+			}
+
+			flattenValue(flat, childPath, child)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			flat[path] = "[]"
+			return
+		}
+
+		for i, child := range v {
+			flattenValue(flat, fmt.Sprintf("%s[%d]", path, i), child)
+		}
+	default:
+		flat[path] = fmt.Sprintf("%v", v)
+	}
+}
+
+// driftIgnored is true if the path is, or is below, one of the ignored paths.
+func driftIgnored(path string) (ignored bool) {
+	ignored = slices.ContainsFunc(DriftIgnoredPaths, func(p string) (match bool) {
+		match = path == p || strings.HasPrefix(path, p+".") || strings.HasPrefix(path, p+"[")
+		return match
+	})
+
+	return ignored
+}
+
+// DiffConfigs compares the expected machine config with the live one, ignoring secrets and the fields in DriftIgnoredPaths.  Each difference is a line: '- path: value' is expected but missing, '+ path: value' is live but not expected, and '~ path: expected -> live' differs.
+func DiffConfigs(expected []byte, live []byte) (diffs []string, err error) {
+	expectedFlat, expectedErr := FlattenConfig(expected)
+	if expectedErr != nil {
+		err = errors.Wrapf(expectedErr, "failed loading expected config")
+		return diffs, err
+	}
+
+	liveFlat, liveErr := FlattenConfig(live)
+	if liveErr != nil {
+		err = errors.Wrapf(liveErr, "failed loading live config")
+		return diffs, err
+	}
+
+	paths := make([]string, 0, len(expectedFlat)+len(liveFlat))
+	for path := range expectedFlat {
+		paths = append(paths, path)
+	}
+
+	for path := range liveFlat {
+		if _, ok := expectedFlat[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+
+	diffs = make([]string, 0)
+
+	for _, path := range paths {
+		if driftIgnored(path) {
+			continue
+		}
+
+		expectedValue, inExpected := expectedFlat[path]
+		liveValue, inLive := liveFlat[path]
+
+		switch {
+		case !inLive:
+			diffs = append(diffs, fmt.Sprintf("- %s: %s", path, expectedValue))
+		case !inExpected:
+			diffs = append(diffs, fmt.Sprintf("+ %s: %s", path, liveValue))
+		case expectedValue != liveValue:
+			diffs = append(diffs, fmt.Sprintf("~ %s: %s -> %s", path, expectedValue, liveValue))
+		}
+	}
+
+	return diffs, err
+}
@@ -0,0 +1,87 @@
+package talos
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	configs, err := GenerateConfigs("prod", "https://api.prod.some.domain:6443", "", "", false)
+	if err != nil {
+		t.Fatalf("failed generating configs: %s", err)
+	}
+
+	expected, err := PatchedConfig(testNode{}, configs.Worker, []string{StarterPatch})
+	if err != nil {
+		t.Fatalf("failed rendering expected config: %s", err)
+	}
+
+	cases := []struct {
+		name    string
+		patches []string
+		diffs   []string
+	}{
+		{
+			name:    "in sync",
+			patches: []string{StarterPatch},
+			diffs:   []string{},
+		},
+		{
+			name:    "patch not applied",
+			patches: []string{},
+			diffs: []string{
+				"- machine.install.disk: /dev/xvda",
+				"- machine.kubelet.extraArgs.rotate-server-certificates: true",
+				"- machine.sysctls.net.netfilter.nf_conntrack_max: 1048576",
+			},
+		},
+		{
+			name: "extra setting",
+			patches: []string{StarterPatch, `machine:
+  sysctls:
+    vm.max_map_count: "262144"
+`},
+			diffs: []string{"+ machine.sysctls.vm.max_map_count: 262144"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			live, renderErr := PatchedConfig(testNode{}, configs.Worker, tc.patches)
+			if renderErr != nil {
+				t.Fatalf("failed rendering live config: %s", renderErr)
+			}
+
+			diffs, diffErr := DiffConfigs(expected, live)
+			if diffErr != nil {
+				t.Fatalf("failed diffing configs: %s", diffErr)
+			}
+
+			assert.Equal(t, tc.diffs, diffs, "diffs do not meet expectations")
+		})
+	}
+
+	t.Run("secrets ignored", func(t *testing.T) {
+		// Configs generated again differ in nothing but their secrets.
+		regenerated, genErr := GenerateConfigs("prod", "https://api.prod.some.domain:6443", "", "", false)
+		if genErr != nil {
+			t.Fatalf("failed generating configs: %s", genErr)
+		}
+
+		for _, pair := range [][2][]byte{{configs.Worker, regenerated.Worker}, {configs.ControlPlane, regenerated.ControlPlane}} {
+			diffs, diffErr := DiffConfigs(pair[0], pair[1])
+			if diffErr != nil {
+				t.Fatalf("failed diffing configs: %s", diffErr)
+			}
+
+			assert.Empty(t, diffs, "secrets should not count as drift")
+		}
+	})
+}
+
+func TestDriftIgnored(t *testing.T) {
+	assert.True(t, driftIgnored("debug"), "debug should be ignored")
+	assert.True(t, driftIgnored("persist"), "persist should be ignored")
+	assert.False(t, driftIgnored("debugger"), "debugger should not be ignored")
+	assert.False(t, driftIgnored("machine.install.disk"), "machine.install.disk should not be ignored")
+}
@@ -0,0 +1,338 @@
+package talos
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EtcdMember is a member of the cluster's etcd, as reported by the Talos API.
+type EtcdMember struct {
+	ID        uint64
+	Hostname  string
+	PeerURLs  []string
+	IsLearner bool
+}
+
+// EtcdNodeStatus is what one control plane node says about its etcd member.
+type EtcdNodeStatus struct {
+	Node     string // IP the node was reached on.
+	MemberID uint64
+	Leader   uint64
+	Errors   []string
+	Err      error // Set if the node couldn't be asked.
+}
+
+// EtcdHealth sums up the state of etcd across the control plane.
+type EtcdHealth struct {
+	Members  []EtcdMember
+	Statuses []EtcdNodeStatus
+	Problems []string
+}
+
+// Healthy is true if nothing is wrong with etcd.
+func (h EtcdHealth) Healthy() (healthy bool) {
+	healthy = len(h.Problems) == 0
+	return healthy
+}
+
+// HealthyMembers counts the members that answered without errors.
+func (h EtcdHealth) HealthyMembers() (count int) {
+	for _, status := range h.Statuses {
+		if status.Err == nil && len(status.Errors) == 0 {
+			count++
+		}
+	}
+
+	return count
+}
+
+// EtcdMembers lists the etcd members, as seen by the node at nodeIP.
+func EtcdMembers(ctx context.Context, talosconfig []byte, nodeIP string) (members []EtcdMember, err error) {
+	tClient, clientErr := NewClient(ctx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return members, err
+	}
+
+	defer tClient.Close()
+
+	resp, listErr := tClient.EtcdMemberList(ctx, &machineapi.EtcdMemberListRequest{})
+	if listErr != nil {
+		err = errors.Wrapf(listErr, "failed listing etcd members from %s", nodeIP)
+		return members, err
+	}
+
+	members = make([]EtcdMember, 0)
+
+	for _, msg := range resp.GetMessages() {
+		for _, m := range msg.GetMembers() {
+			members = append(members, EtcdMember{
+				ID:        m.GetId(),
+				Hostname:  m.GetHostname(),
+				PeerURLs:  m.GetPeerUrls(),
+				IsLearner: m.GetIsLearner(),
+			})
+		}
+	}
+
+	return members, err
+}
+
+// EtcdNodeStatuses asks each control plane node for the status of its etcd member.  Nodes that can't be asked are reported with Err set, rather than failing the whole check.
+func EtcdNodeStatuses(ctx context.Context, talosconfig []byte, cpIPs []string) (statuses []EtcdNodeStatus) {
+	statuses = make([]EtcdNodeStatus, 0, len(cpIPs))
+
+	for _, ip := range cpIPs {
+		status := EtcdNodeStatus{Node: ip}
+
+		tClient, clientErr := NewClient(ctx, talosconfig, ip)
+		if clientErr != nil {
+			status.Err = clientErr
+			statuses = append(statuses, status)
+			continue
+		}
+
+		resp, statusErr := tClient.EtcdStatus(ctx)
+		_ = tClient.Close()
+
+		if statusErr != nil {
+			status.Err = errors.Wrapf(statusErr, "failed getting etcd status from %s", ip)
+			statuses = append(statuses, status)
+			continue
+		}
+
+		for _, msg := range resp.GetMessages() {
+			memberStatus := msg.GetMemberStatus()
+			status.MemberID = memberStatus.GetMemberId()
+			status.Leader = memberStatus.GetLeader()
+			status.Errors = memberStatus.GetErrors()
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// CheckEtcdHealth checks etcd across the control plane nodes at cpIPs.  Problems are reported in the result.  An error means etcd couldn't be checked at all.
+func CheckEtcdHealth(ctx context.Context, talosconfig []byte, cpIPs []string, verbose bool) (health EtcdHealth, err error) {
+	if len(cpIPs) == 0 {
+		err = errors.New("no control plane nodes to check etcd on")
+		return health, err
+	}
+
+	var members []EtcdMember
+	var membersErr error
+
+	// Any node that answers will do for the member list.
+	for _, ip := range cpIPs {
+		members, membersErr = EtcdMembers(ctx, talosconfig, ip)
+		if membersErr == nil {
+			break
+		}
+
+		manager.VerboseOutput(verbose, "Failed listing etcd members from %s: %s", ip, membersErr)
+	}
+
+	if membersErr != nil {
+		err = errors.Wrapf(membersErr, "no control plane node could list etcd members")
+		return health, err
+	}
+
+	statuses := EtcdNodeStatuses(ctx, talosconfig, cpIPs)
+
+	health = EvaluateEtcdHealth(members, statuses)
+
+	for _, problem := range health.Problems {
+		manager.VerboseOutput(verbose, "etcd: %s", problem)
+	}
+
+	return health, err
+}
+
+// EvaluateEtcdHealth works out what's wrong, if anything, from the member list and the status reported by each node.
+func EvaluateEtcdHealth(members []EtcdMember, statuses []EtcdNodeStatus) (health EtcdHealth) {
+	health = EtcdHealth{
+		Members:  members,
+		Statuses: statuses,
+		Problems: make([]string, 0),
+	}
+
+	memberIDs := make(map[uint64]bool)
+	for _, m := range members {
+		memberIDs[m.ID] = true
+
+		if m.IsLearner {
+			health.Problems = append(health.Problems, fmt.Sprintf("member %s (%x) is still a learner", m.Hostname, m.ID))
+		}
+	}
+
+	leaders := make(map[uint64]bool)
+	reporting := make(map[uint64]bool)
+
+	for _, status := range statuses {
+		if status.Err != nil {
+			health.Problems = append(health.Problems, fmt.Sprintf("node %s did not answer: %s", status.Node, status.Err))
+			continue
+		}
+
+		for _, e := range status.Errors {
+			health.Problems = append(health.Problems, fmt.Sprintf("node %s reports: %s", status.Node, e))
+		}
+
+		if status.Leader == 0 {
+			health.Problems = append(health.Problems, fmt.Sprintf("node %s has no leader", status.Node))
+		} else {
+			leaders[status.Leader] = true
+		}
+
+		if !memberIDs[status.MemberID] {
+			health.Problems = append(health.Problems, fmt.Sprintf("node %s is not in the member list", status.Node))
+		}
+
+		reporting[status.MemberID] = true
+	}
+
+	if len(leaders) > 1 {
+		health.Problems = append(health.Problems, fmt.Sprintf("nodes disagree on the leader: %d different leaders", len(leaders)))
+	}
+
+	missing := make([]string, 0)
+	for _, m := range members {
+		if !reporting[m.ID] {
+			missing = append(missing, fmt.Sprintf("%s (%x)", m.Hostname, m.ID))
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		health.Problems = append(health.Problems, fmt.Sprintf("members with no running control plane node: %v", missing))
+	}
+
+	return health
+}
+
+// MemberForNode finds the etcd member belonging to the named node.  Talos names members after the node's hostname, which may or may not carry the domain.
+func MemberForNode(members []EtcdMember, nodeName string) (member EtcdMember, found bool) {
+	for _, m := range members {
+		if m.Hostname == nodeName || strings.HasPrefix(m.Hostname, nodeName+".") {
+			member = m
+			found = true
+			return member, found
+		}
+	}
+
+	return member, found
+}
+
+// CheckMemberRemoval returns an error if removing the given member would leave etcd without quorum.  The remaining members need a healthy majority among themselves.
+func CheckMemberRemoval(health EtcdHealth, memberID uint64) (err error) {
+	if len(health.Members) <= 1 {
+		err = errors.New("refusing to remove the last etcd member")
+		return err
+	}
+
+	remaining := len(health.Members) - 1
+	quorum := remaining/2 + 1
+
+	healthyRemaining := 0
+	for _, status := range health.Statuses {
+		if status.Err == nil && len(status.Errors) == 0 && status.Leader != 0 && status.MemberID != memberID {
+			healthyRemaining++
+		}
+	}
+
+	if healthyRemaining < quorum {
+		err = errors.Errorf("removing member %x would leave %d healthy of %d members, and quorum needs %d", memberID, healthyRemaining, remaining, quorum)
+		return err
+	}
+
+	return err
+}
+
+// LeaveEtcd has the node at nodeIP leave etcd gracefully.
+func LeaveEtcd(ctx context.Context, talosconfig []byte, nodeIP string, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Having %s leave etcd", nodeIP)
+
+	tClient, clientErr := NewClient(ctx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return err
+	}
+
+	defer tClient.Close()
+
+	err = tClient.EtcdLeaveCluster(ctx, &machineapi.EtcdLeaveClusterRequest{})
+	if err != nil {
+		err = errors.Wrapf(err, "%s failed leaving etcd", nodeIP)
+		return err
+	}
+
+	return err
+}
+
+// RemoveEtcdMember removes a member from etcd by ID, by way of the node at viaIP.  This is for members whose nodes can't leave on their own.
+func RemoveEtcdMember(ctx context.Context, talosconfig []byte, viaIP string, memberID uint64, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Removing etcd member %x via %s", memberID, viaIP)
+
+	tClient, clientErr := NewClient(ctx, talosconfig, viaIP)
+	if clientErr != nil {
+		err = clientErr
+		return err
+	}
+
+	defer tClient.Close()
+
+	err = tClient.EtcdRemoveMemberByID(ctx, &machineapi.EtcdRemoveMemberByIDRequest{MemberId: memberID})
+	if err != nil {
+		err = errors.Wrapf(err, "failed removing etcd member %x via %s", memberID, viaIP)
+		return err
+	}
+
+	return err
+}
+
+// WaitForEtcdMember waits for the named node to be a full, voting member of a healthy etcd.
+func WaitForEtcdMember(ctx context.Context, talosconfig []byte, cpIPs []string, nodeName string, timeout time.Duration, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Waiting for %s to join etcd (timeout: %v)", nodeName, timeout)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(UpgradePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeoutCtx.Done():
+			err = errors.Errorf("timeout waiting for %s to join etcd after %v", nodeName, timeout)
+			return err
+		case <-ticker.C:
+			health, healthErr := CheckEtcdHealth(timeoutCtx, talosconfig, cpIPs, false)
+			if healthErr != nil {
+				manager.VerboseOutput(verbose, "etcd not answering yet, continuing to wait...")
+				continue
+			}
+
+			member, found := MemberForNode(health.Members, nodeName)
+			if !found || member.IsLearner {
+				manager.VerboseOutput(verbose, "%s is not a voting etcd member yet, continuing to wait...", nodeName)
+				continue
+			}
+
+			if !health.Healthy() {
+				manager.VerboseOutput(verbose, "etcd is not healthy yet (%s), continuing to wait...", strings.Join(health.Problems, "; "))
+				continue
+			}
+
+			manager.VerboseOutput(verbose, "%s has joined etcd", nodeName)
+			return err
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package talos
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEvaluateEtcdHealth(t *testing.T) {
+	members := []EtcdMember{
+		{ID: 1, Hostname: "prod-cp-1"},
+		{ID: 2, Hostname: "prod-cp-2"},
+		{ID: 3, Hostname: "prod-cp-3"},
+	}
+
+	healthy := []EtcdNodeStatus{
+		{Node: "10.0.1.1", MemberID: 1, Leader: 2},
+		{Node: "10.0.1.2", MemberID: 2, Leader: 2},
+		{Node: "10.0.1.3", MemberID: 3, Leader: 2},
+	}
+
+	cases := []struct {
+		name     string
+		members  []EtcdMember
+		statuses []EtcdNodeStatus
+		problems int
+		healthy  int
+	}{
+		{
+			name:     "healthy",
+			members:  members,
+			statuses: healthy,
+			problems: 0,
+			healthy:  3,
+		},
+		{
+			name:    "node down",
+			members: members,
+			statuses: []EtcdNodeStatus{
+				healthy[0],
+				healthy[1],
+				{Node: "10.0.1.3", Err: errors.New("connection refused")},
+			},
+			problems: 2, // The node didn't answer, and its member has nobody reporting for it.
+			healthy:  2,
+		},
+		{
+			name:    "member errors",
+			members: members,
+			statuses: []EtcdNodeStatus{
+				healthy[0],
+				healthy[1],
+				{Node: "10.0.1.3", MemberID: 3, Leader: 2, Errors: []string{"NOSPACE"}},
+			},
+			problems: 1,
+			healthy:  2,
+		},
+		{
+			name:    "split leaders",
+			members: members,
+			statuses: []EtcdNodeStatus{
+				healthy[0],
+				healthy[1],
+				{Node: "10.0.1.3", MemberID: 3, Leader: 3},
+			},
+			problems: 1,
+			healthy:  3,
+		},
+		{
+			name:    "no leader",
+			members: members,
+			statuses: []EtcdNodeStatus{
+				{Node: "10.0.1.1", MemberID: 1},
+				{Node: "10.0.1.2", MemberID: 2},
+				{Node: "10.0.1.3", MemberID: 3},
+			},
+			problems: 3,
+			healthy:  3,
+		},
+		{
+			name:     "stale member",
+			members:  append(members, EtcdMember{ID: 4, Hostname: "prod-cp-4"}),
+			statuses: healthy,
+			problems: 1,
+			healthy:  3,
+		},
+		{
+			name:     "learner",
+			members:  []EtcdMember{members[0], members[1], {ID: 3, Hostname: "prod-cp-3", IsLearner: true}},
+			statuses: healthy,
+			problems: 1,
+			healthy:  3,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			health := EvaluateEtcdHealth(tc.members, tc.statuses)
+			assert.Len(t, health.Problems, tc.problems, "problems do not meet expectations: %v", health.Problems)
+			assert.Equal(t, tc.problems == 0, health.Healthy(), "health does not meet expectations")
+			assert.Equal(t, tc.healthy, health.HealthyMembers(), "healthy member count does not meet expectations")
+		})
+	}
+}
+
+func TestMemberForNode(t *testing.T) {
+	members := []EtcdMember{
+		{ID: 1, Hostname: "prod-cp-1.some.domain"},
+		{ID: 2, Hostname: "prod-cp-2"},
+		{ID: 10, Hostname: "prod-cp-10.some.domain"},
+	}
+
+	cases := []struct {
+		name  string
+		node  string
+		id    uint64
+		found bool
+	}{
+		{
+			name:  "fqdn hostname",
+			node:  "prod-cp-1",
+			id:    1,
+			found: true,
+		},
+		{
+			name:  "short hostname",
+			node:  "prod-cp-2",
+			id:    2,
+			found: true,
+		},
+		{
+			name:  "similar name",
+			node:  "prod-cp-10",
+			id:    10,
+			found: true,
+		},
+		{
+			name:  "missing",
+			node:  "prod-cp-3",
+			found: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			member, found := MemberForNode(members, tc.node)
+			assert.Equal(t, tc.found, found, "found does not meet expectations")
+			assert.Equal(t, tc.id, member.ID, "member does not meet expectations")
+		})
+	}
+}
+
+func TestCheckMemberRemoval(t *testing.T) {
+	three := []EtcdMember{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	cases := []struct {
+		name     string
+		members  []EtcdMember
+		statuses []EtcdNodeStatus
+		remove   uint64
+		errors   bool
+	}{
+		{
+			name:    "healthy three",
+			members: three,
+			statuses: []EtcdNodeStatus{
+				{MemberID: 1, Leader: 1},
+				{MemberID: 2, Leader: 1},
+				{MemberID: 3, Leader: 1},
+			},
+			remove: 3,
+			errors: false,
+		},
+		{
+			name:    "removing a dead member",
+			members: three,
+			statuses: []EtcdNodeStatus{
+				{MemberID: 1, Leader: 1},
+				{MemberID: 2, Leader: 1},
+				{Err: errors.New("connection refused")},
+			},
+			remove: 3,
+			errors: false,
+		},
+		{
+			name:    "another member down",
+			members: three,
+			statuses: []EtcdNodeStatus{
+				{MemberID: 1, Leader: 1},
+				{Err: errors.New("connection refused")},
+				{MemberID: 3, Leader: 1},
+			},
+			remove: 3,
+			errors: true,
+		},
+		{
+			name:    "another member erroring",
+			members: three,
+			statuses: []EtcdNodeStatus{
+				{MemberID: 1, Leader: 1},
+				{MemberID: 2, Leader: 1, Errors: []string{"NOSPACE"}},
+				{MemberID: 3, Leader: 1},
+			},
+			remove: 3,
+			errors: true,
+		},
+		{
+			name:     "last member",
+			members:  []EtcdMember{{ID: 1}},
+			statuses: []EtcdNodeStatus{{MemberID: 1, Leader: 1}},
+			remove:   1,
+			errors:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckMemberRemoval(EtcdHealth{Members: tc.members, Statuses: tc.statuses}, tc.remove)
+			if tc.errors {
+				assert.Error(t, err, "removal should have been refused")
+			} else {
+				assert.NoError(t, err, "removal should have been allowed")
+			}
+		})
+	}
+}
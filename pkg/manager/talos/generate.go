@@ -0,0 +1,133 @@
+package talos
+
+import (
+	"fmt"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	"github.com/siderolabs/talos/pkg/machinery/config"
+	"github.com/siderolabs/talos/pkg/machinery/config/encoder"
+	"github.com/siderolabs/talos/pkg/machinery/config/generate"
+	"github.com/siderolabs/talos/pkg/machinery/config/generate/secrets"
+	"github.com/siderolabs/talos/pkg/machinery/config/machine"
+	"github.com/siderolabs/talos/pkg/machinery/constants"
+	"strings"
+	"time"
+)
+
+// DefaultKubernetesVersion is the Kubernetes version new clusters get unless told otherwise.
+const DefaultKubernetesVersion = constants.DefaultKubernetesVersion
+
+// APIServerPort is the port the Kubernetes API server listens on behind the apiserver load balancer.
+const APIServerPort = 6443
+
+// StarterPatch is the patch.yaml written for a new cluster.  Edit it to suit.
+const StarterPatch = `machine:
+  install:
+    disk: /dev/xvda
+  kubelet:
+    extraArgs:
+      rotate-server-certificates: true
+  sysctls:
+    net.netfilter.nf_conntrack_max: "1048576"
+`
+
+// GeneratedConfigs holds everything generated for a new cluster.
+type GeneratedConfigs struct {
+	SecretsBundle []byte // The cluster's CA's, keys, and tokens.  Keep it to regenerate configs later.
+	ControlPlane  []byte // controlplane.yaml
+	Worker        []byte // worker.yaml
+	Talosconfig   []byte // Client config for talking to the nodes.
+}
+
+// ClusterEndpoint turns an apiserver host name, e.g. the apiserver load balancer's, into a cluster endpoint URL.  Full URL's are returned as is.
+func ClusterEndpoint(host string) (endpoint string) {
+	if strings.Contains(host, "://") {
+		endpoint = host
+		return endpoint
+	}
+
+	endpoint = fmt.Sprintf("https://%s:%d", host, APIServerPort)
+
+	return endpoint
+}
+
+// GenerateConfigs creates a new secrets bundle for a cluster, and the machine configs and talosconfig that go with it, much as `talosctl gen config` does.  Empty versions mean the defaults of the Talos library in use.
+func GenerateConfigs(clusterName string, endpoint string, kubernetesVersion string, talosVersion string, verbose bool) (configs GeneratedConfigs, err error) {
+	if kubernetesVersion == "" {
+		kubernetesVersion = DefaultKubernetesVersion
+	}
+
+	versionContract := config.TalosVersionCurrent
+
+	if talosVersion != "" {
+		versionContract, err = config.ParseContractFromVersion(talosVersion)
+		if err != nil {
+			err = errors.Wrapf(err, "invalid talos version %q", talosVersion)
+			return configs, err
+		}
+	}
+
+	manager.VerboseOutput(verbose, "Generating configs for cluster %s at %s, Kubernetes %s", clusterName, endpoint, kubernetesVersion)
+
+	bundle, bundleErr := secrets.NewBundle(secrets.NewFixedClock(time.Now()), versionContract)
+	if bundleErr != nil {
+		err = errors.Wrapf(bundleErr, "failed generating secrets bundle")
+		return configs, err
+	}
+
+	input, inputErr := generate.NewInput(clusterName, endpoint, kubernetesVersion,
+		generate.WithSecretsBundle(bundle),
+		generate.WithVersionContract(versionContract),
+	)
+	if inputErr != nil {
+		err = errors.Wrapf(inputErr, "failed creating config generation input")
+		return configs, err
+	}
+
+	configs.SecretsBundle, err = encoder.NewEncoder(bundle, encoder.WithComments(encoder.CommentsDisabled)).Encode()
+	if err != nil {
+		err = errors.Wrapf(err, "failed encoding secrets bundle")
+		return configs, err
+	}
+
+	configs.ControlPlane, err = machineConfigBytes(input, machine.TypeControlPlane)
+	if err != nil {
+		return configs, err
+	}
+
+	configs.Worker, err = machineConfigBytes(input, machine.TypeWorker)
+	if err != nil {
+		return configs, err
+	}
+
+	talosconfig, talosconfigErr := input.Talosconfig()
+	if talosconfigErr != nil {
+		err = errors.Wrapf(talosconfigErr, "failed generating talosconfig")
+		return configs, err
+	}
+
+	configs.Talosconfig, err = talosconfig.Bytes()
+	if err != nil {
+		err = errors.Wrapf(err, "failed encoding talosconfig")
+		return configs, err
+	}
+
+	return configs, err
+}
+
+// machineConfigBytes generates the machine config for a machine type.
+func machineConfigBytes(input *generate.Input, machineType machine.Type) (configBytes []byte, err error) {
+	cfg, cfgErr := input.Config(machineType)
+	if cfgErr != nil {
+		err = errors.Wrapf(cfgErr, "failed generating %s config", machineType)
+		return configBytes, err
+	}
+
+	configBytes, err = cfg.EncodeBytes(encoder.WithComments(encoder.CommentsDisabled))
+	if err != nil {
+		err = errors.Wrapf(err, "failed encoding %s config", machineType)
+		return configBytes, err
+	}
+
+	return configBytes, err
+}
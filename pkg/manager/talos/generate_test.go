@@ -0,0 +1,45 @@
+package talos
+
+import (
+	"github.com/siderolabs/talos/pkg/machinery/config/configloader"
+	"github.com/siderolabs/talos/pkg/machinery/config/machine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestClusterEndpoint(t *testing.T) {
+	assert.Equal(t, "https://api.prod.some.domain:6443", ClusterEndpoint("api.prod.some.domain"))
+	assert.Equal(t, "https://api.prod.some.domain:443", ClusterEndpoint("https://api.prod.some.domain:443"))
+}
+
+func TestGenerateConfigs(t *testing.T) {
+	configs, err := GenerateConfigs("prod", "https://api.prod.some.domain:6443", "", "", false)
+	if err != nil {
+		t.Fatalf("failed generating configs: %s", err)
+	}
+
+	assert.NotEmpty(t, configs.SecretsBundle)
+	assert.NotEmpty(t, configs.Talosconfig)
+
+	cases := []struct {
+		name     string
+		config   []byte
+		expected machine.Type
+	}{
+		{"controlplane", configs.ControlPlane, machine.TypeControlPlane},
+		{"worker", configs.Worker, machine.TypeWorker},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, loadErr := configloader.NewFromBytes(tc.config)
+			if loadErr != nil {
+				t.Fatalf("generated config doesn't load: %s", loadErr)
+			}
+
+			assert.Equal(t, tc.expected, cfg.Machine().Type(), "machine type does not meet expectations")
+			assert.Equal(t, "prod", cfg.Cluster().Name(), "cluster name does not meet expectations")
+			assert.Equal(t, "https://api.prod.some.domain:6443", cfg.Cluster().Endpoint().String(), "endpoint does not meet expectations")
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package talos
+
+import (
+	"context"
+	"fmt"
+	"github.com/cosi-project/runtime/pkg/safe"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/resources/config"
+	timeres "github.com/siderolabs/talos/pkg/machinery/resources/time"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ServiceRunning is the state Talos reports for a running service.
+const ServiceRunning = "Running"
+
+// ServiceEtcd is the Talos service running etcd.  Only control plane nodes run it.
+const ServiceEtcd = "etcd"
+
+// RequiredServices are the Talos services every node has to be running.
+//
+//nolint:gochecknoglobals // Constant list
+var RequiredServices = []string{"apid", "kubelet"}
+
+// WatchedMounts are the mounts whose disk usage is checked.
+//
+//nolint:gochecknoglobals // Constant list
+var WatchedMounts = []string{"/var", "/system/state"}
+
+// ServiceState is the state of a Talos service on a node.
+type ServiceState struct {
+	ID            string
+	State         string
+	Healthy       bool
+	HealthUnknown bool
+	Message       string
+}
+
+// DiskUsage is the usage of a filesystem on a node.
+type DiskUsage struct {
+	MountPoint string
+	Size       uint64
+	Available  uint64
+}
+
+// UsedPercent is how full the filesystem is.
+func (d DiskUsage) UsedPercent() (percent float64) {
+	if d.Size == 0 {
+		return percent
+	}
+
+	percent = float64(d.Size-d.Available) / float64(d.Size) * 100
+
+	return percent
+}
+
+// NodeHealth is what a node's Talos API says about its health.
+type NodeHealth struct {
+	Node         string
+	IP           string
+	ControlPlane bool // Control plane nodes have to run etcd.
+	Services     []ServiceState
+	EtcdAlarms   []string
+	TimeChecked  bool
+	TimeSynced   bool
+	Disks        []DiskUsage
+	DiskMaxUsage float64  // Percent used above which a disk counts as a problem.  0 disables the check.
+	CheckErrors  []string // Checks that failed, while others worked.
+	Err          error    // Set if the node couldn't be asked at all.
+}
+
+// Problems lists everything wrong with the node.
+func (h NodeHealth) Problems() (problems []string) {
+	if h.Err != nil {
+		problems = h.ServiceProblems()
+		return problems
+	}
+
+	problems = make([]string, 0)
+	problems = append(problems, h.CheckErrors...)
+	problems = append(problems, h.ServiceProblems()...)
+
+	for _, alarm := range h.EtcdAlarms {
+		problems = append(problems, fmt.Sprintf("etcd alarm %s", alarm))
+	}
+
+	if h.TimeChecked && !h.TimeSynced {
+		problems = append(problems, "time is not in sync")
+	}
+
+	if h.DiskMaxUsage > 0 {
+		for _, d := range h.Disks {
+			if d.UsedPercent() > h.DiskMaxUsage {
+				problems = append(problems, fmt.Sprintf("%s is %.0f%% full", d.MountPoint, d.UsedPercent()))
+			}
+		}
+	}
+
+	return problems
+}
+
+// ServiceProblems lists what's wrong with the services the node has to run, or that it couldn't be asked.  Control plane nodes have to run etcd, so it missing is a problem.
+func (h NodeHealth) ServiceProblems() (problems []string) {
+	problems = make([]string, 0)
+
+	if h.Err != nil {
+		problems = append(problems, fmt.Sprintf("talos api not answering: %s", h.Err))
+		return problems
+	}
+
+	services := make(map[string]ServiceState)
+	for _, s := range h.Services {
+		services[s.ID] = s
+	}
+
+	watched := slices.Clone(RequiredServices)
+	if _, ok := services[ServiceEtcd]; ok || h.ControlPlane {
+		watched = append(watched, ServiceEtcd)
+	}
+
+	slices.Sort(watched)
+
+	for _, id := range watched {
+		s, ok := services[id]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("service %s not found", id))
+		case s.State != ServiceRunning:
+			problems = append(problems, fmt.Sprintf("service %s is %s", id, s.State))
+		case !s.HealthUnknown && !s.Healthy:
+			problems = append(problems, fmt.Sprintf("service %s is unhealthy: %s", id, s.Message))
+		}
+	}
+
+	return problems
+}
+
+// Healthy is true if nothing is wrong with the node.
+func (h NodeHealth) Healthy() (healthy bool) {
+	healthy = len(h.Problems()) == 0
+	return healthy
+}
+
+// CheckNodeHealth asks the node at nodeIP about its services, etcd alarms, time sync, and disk usage.  The node says itself whether it's a control plane node, and so has to run etcd.  The whole check gives up after timeout.  Failures are reported in the result rather than returned, so one bad node doesn't hide the others.
+func CheckNodeHealth(ctx context.Context, talosconfig []byte, nodeName string, nodeIP string, timeout time.Duration, diskMaxUsage float64) (health NodeHealth) {
+	health = NodeHealth{
+		Node:         nodeName,
+		IP:           nodeIP,
+		CheckErrors:  make([]string, 0),
+		DiskMaxUsage: diskMaxUsage,
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tClient, clientErr := NewClient(timeoutCtx, talosconfig, nodeIP)
+	if clientErr != nil {
+		health.Err = clientErr
+		return health
+	}
+
+	defer tClient.Close()
+
+	servicesResp, servicesErr := tClient.ServiceList(timeoutCtx)
+	if servicesErr != nil {
+		health.Err = servicesErr
+		return health
+	}
+
+	health.Services = make([]ServiceState, 0)
+	for _, msg := range servicesResp.GetMessages() {
+		for _, s := range msg.GetServices() {
+			health.Services = append(health.Services, ServiceState{
+				ID:            s.GetId(),
+				State:         s.GetState(),
+				Healthy:       s.GetHealth().GetHealthy(),
+				HealthUnknown: s.GetHealth().GetUnknown(),
+				Message:       s.GetHealth().GetLastMessage(),
+			})
+		}
+	}
+
+	machineType, typeErr := safe.StateGetByID[*config.MachineType](timeoutCtx, tClient.COSI, config.MachineTypeID)
+	if typeErr != nil {
+		health.CheckErrors = append(health.CheckErrors, fmt.Sprintf("failed getting machine type: %s", typeErr))
+	} else {
+		health.ControlPlane = machineType.MachineType().IsControlPlane()
+	}
+
+	runsEtcd := slices.ContainsFunc(health.Services, func(s ServiceState) (match bool) {
+		match = s.ID == ServiceEtcd
+		return match
+	})
+
+	if runsEtcd || health.ControlPlane {
+		alarmsResp, alarmsErr := tClient.EtcdAlarmList(timeoutCtx)
+		if alarmsErr != nil {
+			health.CheckErrors = append(health.CheckErrors, fmt.Sprintf("failed listing etcd alarms: %s", alarmsErr))
+		} else {
+			health.EtcdAlarms = EtcdAlarms(alarmsResp)
+		}
+	}
+
+	timeStatus, timeErr := safe.StateGetByID[*timeres.Status](timeoutCtx, tClient.COSI, timeres.StatusID)
+	if timeErr != nil {
+		health.CheckErrors = append(health.CheckErrors, fmt.Sprintf("failed getting time status: %s", timeErr))
+	} else {
+		health.TimeChecked = true
+		health.TimeSynced = timeStatus.TypedSpec().Synced || timeStatus.TypedSpec().SyncDisabled
+	}
+
+	mountsResp, mountsErr := tClient.Mounts(timeoutCtx)
+	if mountsErr != nil {
+		health.CheckErrors = append(health.CheckErrors, fmt.Sprintf("failed getting disk usage: %s", mountsErr))
+	} else {
+		health.Disks = WatchedDisks(mountsResp)
+	}
+
+	return health
+}
+
+// CheckNodesHealth checks the health of all the given nodes at once, so a slow node only costs its own timeout.  nodes maps node names to IPs.  The results are in the order of names.
+func CheckNodesHealth(ctx context.Context, talosconfig []byte, names []string, nodes map[string]string, timeout time.Duration, diskMaxUsage float64) (results []NodeHealth) {
+	results = make([]NodeHealth, len(names))
+
+	var wg sync.WaitGroup
+
+	for i, name := range names {
+		wg.Add(1)
+
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = CheckNodeHealth(ctx, talosconfig, name, nodes[name], timeout, diskMaxUsage)
+		}(i, name)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// EtcdAlarms lists the active alarms in an alarm list response, e.g. NOSPACE.
+func EtcdAlarms(resp *machineapi.EtcdAlarmListResponse) (alarms []string) {
+	alarms = make([]string, 0)
+
+	for _, msg := range resp.GetMessages() {
+		for _, a := range msg.GetMemberAlarms() {
+			if a.GetAlarm() == machineapi.EtcdMemberAlarm_NONE {
+				continue
+			}
+
+			alarms = append(alarms, fmt.Sprintf("%s on member %x", a.GetAlarm(), a.GetMemberId()))
+		}
+	}
+
+	return alarms
+}
+
+// WatchedDisks picks the usage of the watched mounts out of a mounts response.
+func WatchedDisks(resp *machineapi.MountsResponse) (disks []DiskUsage) {
+	disks = make([]DiskUsage, 0)
+
+	for _, msg := range resp.GetMessages() {
+		for _, stat := range msg.GetStats() {
+			if !slices.Contains(WatchedMounts, stat.GetMountedOn()) {
+				continue
+			}
+
+			disks = append(disks, DiskUsage{
+				MountPoint: stat.GetMountedOn(),
+				Size:       stat.GetSize(),
+				Available:  stat.GetAvailable(),
+			})
+		}
+	}
+
+	return disks
+}
@@ -0,0 +1,149 @@
+package talos
+
+import (
+	"github.com/pkg/errors"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNodeHealthProblems(t *testing.T) {
+	running := func(id string) (s ServiceState) {
+		s = ServiceState{ID: id, State: ServiceRunning, Healthy: true}
+		return s
+	}
+
+	cases := []struct {
+		name     string
+		health   NodeHealth
+		problems []string
+	}{
+		{
+			name: "healthy worker",
+			health: NodeHealth{
+				Services:     []ServiceState{running("apid"), running("kubelet")},
+				TimeChecked:  true,
+				TimeSynced:   true,
+				Disks:        []DiskUsage{{MountPoint: "/var", Size: 100, Available: 50}},
+				DiskMaxUsage: 85,
+			},
+			problems: []string{},
+		},
+		{
+			name: "degraded control plane",
+			health: NodeHealth{
+				Services: []ServiceState{
+					running("apid"),
+					{ID: "etcd", State: ServiceRunning, Healthy: false, Message: "context deadline exceeded"},
+					{ID: "kubelet", State: "Waiting"},
+				},
+				EtcdAlarms:   []string{"NOSPACE on member 1"},
+				TimeChecked:  true,
+				TimeSynced:   false,
+				Disks:        []DiskUsage{{MountPoint: "/var", Size: 100, Available: 10}},
+				DiskMaxUsage: 85,
+			},
+			problems: []string{
+				"service etcd is unhealthy: context deadline exceeded",
+				"service kubelet is Waiting",
+				"etcd alarm NOSPACE on member 1",
+				"time is not in sync",
+				"/var is 90% full",
+			},
+		},
+		{
+			name: "missing service and unknown health",
+			health: NodeHealth{
+				Services: []ServiceState{{ID: "apid", State: ServiceRunning, HealthUnknown: true}},
+			},
+			problems: []string{"service kubelet not found"},
+		},
+		{
+			name: "failed checks",
+			health: NodeHealth{
+				Services:    []ServiceState{running("apid"), running("kubelet")},
+				CheckErrors: []string{"failed getting disk usage: unavailable"},
+			},
+			problems: []string{"failed getting disk usage: unavailable"},
+		},
+		{
+			name:     "unreachable",
+			health:   NodeHealth{Err: errors.New("connection refused")},
+			problems: []string{"talos api not answering: connection refused"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.problems, tc.health.Problems(), "problems do not meet expectations")
+			assert.Equal(t, len(tc.problems) == 0, tc.health.Healthy(), "health does not meet expectations")
+		})
+	}
+}
+
+func TestEtcdAlarms(t *testing.T) {
+	resp := &machineapi.EtcdAlarmListResponse{
+		Messages: []*machineapi.EtcdAlarm{
+			{
+				MemberAlarms: []*machineapi.EtcdMemberAlarm{
+					{MemberId: 1, Alarm: machineapi.EtcdMemberAlarm_NONE},
+					{MemberId: 2, Alarm: machineapi.EtcdMemberAlarm_NOSPACE},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, []string{"NOSPACE on member 2"}, EtcdAlarms(resp), "alarms do not meet expectations")
+}
+
+func TestWatchedDisks(t *testing.T) {
+	resp := &machineapi.MountsResponse{
+		Messages: []*machineapi.Mounts{
+			{
+				Stats: []*machineapi.MountStat{
+					{MountedOn: "/", Size: 100, Available: 0},
+					{MountedOn: "/var", Size: 1000, Available: 400},
+					{MountedOn: "/system/state", Size: 100, Available: 90},
+				},
+			},
+		},
+	}
+
+	disks := WatchedDisks(resp)
+
+	assert.Equal(t, []DiskUsage{
+		{MountPoint: "/var", Size: 1000, Available: 400},
+		{MountPoint: "/system/state", Size: 100, Available: 90},
+	}, disks, "disks do not meet expectations")
+	assert.InDelta(t, 60.0, disks[0].UsedPercent(), 0.01, "used percent does not meet expectations")
+}
+
+func TestNodeHealthServiceProblems(t *testing.T) {
+	health := NodeHealth{
+		Services:    []ServiceState{{ID: "apid", State: ServiceRunning, Healthy: true}, {ID: "kubelet", State: "Waiting"}},
+		CheckErrors: []string{"failed getting disk usage: unavailable"},
+		TimeChecked: true,
+	}
+
+	assert.Equal(t, []string{"service kubelet is Waiting"}, health.ServiceProblems(), "service problems do not meet expectations")
+}
+
+func TestNodeHealthControlPlaneEtcd(t *testing.T) {
+	running := []ServiceState{{ID: "apid", State: ServiceRunning, Healthy: true}, {ID: "kubelet", State: ServiceRunning, Healthy: true}}
+
+	cases := []struct {
+		name         string
+		controlPlane bool
+		expected     []string
+	}{
+		{"worker", false, []string{}},
+		{"control plane", true, []string{"service etcd not found"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			health := NodeHealth{ControlPlane: tc.controlPlane, Services: running}
+			assert.Equal(t, tc.expected, health.ServiceProblems(), "service problems do not meet expectations")
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package talos
+
+import (
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	"github.com/siderolabs/talos/pkg/machinery/config/configloader"
+	"github.com/siderolabs/talos/pkg/machinery/config/encoder"
+)
+
+// MaskedSecret replaces secrets in rendered configs unless they're asked for.
+const MaskedSecret = "******"
+
+// ValidationMode is the runtime mode a config is validated for, like talosctl validate --mode.
+type ValidationMode string
+
+const (
+	ValidationModeCloud ValidationMode = "cloud"
+	ValidationModeMetal ValidationMode = "metal"
+)
+
+// ParseValidationMode parses a validation mode name.
+func ParseValidationMode(name string) (mode ValidationMode, err error) {
+	mode = ValidationMode(name)
+
+	switch mode {
+	case ValidationModeCloud, ValidationModeMetal:
+		return mode, err
+	default:
+		err = errors.Errorf("unknown validation mode %q.  Use %s or %s", name, ValidationModeCloud, ValidationModeMetal)
+		return mode, err
+	}
+}
+
+func (m ValidationMode) String() (s string) {
+	s = string(m)
+	return s
+}
+
+// RequiresInstall is true for metal, where Talos installs itself to disk.  Cloud images come installed.
+func (m ValidationMode) RequiresInstall() (requires bool) {
+	requires = m == ValidationModeMetal
+	return requires
+}
+
+// InContainer is always false.  Nodes made here are VMs.
+func (m ValidationMode) InContainer() (inContainer bool) {
+	return inContainer
+}
+
+// RenderConfig renders the final machine config for a node the way ApplyConfig does, without talking to any node, and validates it for the given mode.  Secrets are masked unless showSecrets is set.  Validation warnings are returned alongside the config.  Validation errors are returned as an error, with the config, so it can still be looked at.
+func RenderConfig(node manager.ClusterNode, machineConfigBytes []byte, machineConfigPatches []string, mode ValidationMode, showSecrets bool) (cfgBytes []byte, warnings []string, err error) {
+	patched, patchErr := PatchedConfig(node, machineConfigBytes, machineConfigPatches)
+	if patchErr != nil {
+		err = patchErr
+		return cfgBytes, warnings, err
+	}
+
+	cfg, loadErr := configloader.NewFromBytes(patched)
+	if loadErr != nil {
+		err = errors.Wrapf(loadErr, "failed loading patched config")
+		return cfgBytes, warnings, err
+	}
+
+	// Validate before masking, as masked secrets aren't valid.
+	warnings, validateErr := cfg.Validate(mode)
+
+	if !showSecrets {
+		cfg = cfg.RedactSecrets(MaskedSecret)
+	}
+
+	cfgBytes, err = cfg.EncodeBytes(encoder.WithComments(encoder.CommentsDisabled))
+	if err != nil {
+		err = errors.Wrapf(err, "failed encoding patched config")
+		return cfgBytes, warnings, err
+	}
+
+	if validateErr != nil {
+		err = errors.Wrapf(validateErr, "config for %s is not valid in %s mode", node.Name(), mode)
+		return cfgBytes, warnings, err
+	}
+
+	return cfgBytes, warnings, err
+}
@@ -0,0 +1,80 @@
+package talos
+
+import (
+	"github.com/siderolabs/talos/pkg/machinery/config/configloader"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestParseValidationMode(t *testing.T) {
+	mode, err := ParseValidationMode("metal")
+	assert.NoError(t, err, "metal should parse")
+	assert.True(t, mode.RequiresInstall(), "metal should require install")
+
+	mode, err = ParseValidationMode("cloud")
+	assert.NoError(t, err, "cloud should parse")
+	assert.False(t, mode.RequiresInstall(), "cloud should not require install")
+
+	_, err = ParseValidationMode("container")
+	assert.Error(t, err, "container should not parse")
+}
+
+func TestRenderConfig(t *testing.T) {
+	configs, err := GenerateConfigs("prod", "https://api.prod.some.domain:6443", "", "", false)
+	if err != nil {
+		t.Fatalf("failed generating configs: %s", err)
+	}
+
+	cases := []struct {
+		name        string
+		patches     []string
+		showSecrets bool
+		invalid     bool
+	}{
+		{
+			name:    "masked",
+			patches: []string{StarterPatch},
+		},
+		{
+			name:        "secrets shown",
+			patches:     []string{StarterPatch},
+			showSecrets: true,
+		},
+		{
+			name: "invalid",
+			patches: []string{`machine:
+  network:
+    interfaces:
+      - interface: eth0
+        addresses:
+          - not-a-cidr
+`},
+			invalid: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rendered, _, renderErr := RenderConfig(testNode{}, configs.Worker, tc.patches, ValidationModeCloud, tc.showSecrets)
+			if tc.invalid {
+				assert.Error(t, renderErr, "config should not be valid")
+				assert.NotEmpty(t, rendered, "invalid config should still be rendered")
+				return
+			}
+
+			if renderErr != nil {
+				t.Fatalf("failed rendering config: %s", renderErr)
+			}
+
+			assert.Equal(t, !tc.showSecrets, strings.Contains(string(rendered), MaskedSecret), "secret masking does not meet expectations")
+
+			cfg, loadErr := configloader.NewFromBytes(rendered)
+			if loadErr != nil {
+				t.Fatalf("rendered config doesn't load: %s", loadErr)
+			}
+
+			assert.Equal(t, "prod-worker-1.some.domain", cfg.Machine().Network().Hostname(), "hostname does not meet expectations")
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package talos
+
+import (
+	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/constants"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// ResetPollInterval is how often a node is checked while waiting for it to finish resetting.
+const ResetPollInterval = 5 * time.Second
+
+// ResetDoneChecks is how many checks in a row a node has to be unreachable for before its reset is taken as done.  A node that's busy resetting can miss one.
+const ResetDoneChecks = 3
+
+// ResetRequest is a graceful reset that wipes the STATE and EPHEMERAL partitions and halts the node.  Graceful means the node drains, and control plane nodes leave etcd, first.
+func ResetRequest() (req *machineapi.ResetRequest) {
+	req = &machineapi.ResetRequest{
+		Graceful: true,
+		Reboot:   false,
+		SystemPartitionsToWipe: []*machineapi.ResetPartitionSpec{
+			{Label: constants.StatePartitionLabel, Wipe: true},
+			{Label: constants.EphemeralPartitionLabel, Wipe: true},
+		},
+	}
+
+	return req
+}
+
+// ResetNode gracefully resets the node at nodeIP, and waits for it to stop answering, which it does once the reset is done and it halts.  It has to be unreachable for ResetDoneChecks checks in a row, so a node that's merely slow to answer, or answers with an error, isn't taken for done.  It gives up with an error if the node doesn't accept the reset, or isn't done, within the timeout.
+func ResetNode(ctx context.Context, talosconfig []byte, nodeIP string, timeout time.Duration, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Resetting %s (timeout: %v)", nodeIP, timeout)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tClient, clientErr := NewClient(timeoutCtx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return err
+	}
+
+	_, err = tClient.ResetGenericWithResponse(timeoutCtx, ResetRequest())
+	_ = tClient.Close()
+
+	if err != nil {
+		err = errors.Wrapf(err, "%s did not accept the reset", nodeIP)
+		return err
+	}
+
+	ticker := time.NewTicker(ResetPollInterval)
+	defer ticker.Stop()
+
+	unreachable := 0
+
+	for {
+		select {
+		case <-timeoutCtx.Done():
+			err = errors.Errorf("timeout waiting for %s to finish resetting after %v", nodeIP, timeout)
+			return err
+		case <-ticker.C:
+			_, versionErr := NodeVersion(timeoutCtx, talosconfig, nodeIP)
+			if timeoutCtx.Err() != nil {
+				continue
+			}
+
+			if !Unreachable(versionErr) {
+				unreachable = 0
+				manager.VerboseOutput(verbose, "%s still resetting, continuing to wait...", nodeIP)
+				continue
+			}
+
+			unreachable++
+			if unreachable < ResetDoneChecks {
+				manager.VerboseOutput(verbose, "%s not answering (%d of %d checks), continuing to wait...", nodeIP, unreachable, ResetDoneChecks)
+				continue
+			}
+
+			manager.VerboseOutput(verbose, "%s has stopped answering.  Reset done.", nodeIP)
+			return err
+		}
+	}
+}
+
+// Unreachable reports whether err from a Talos API call means nothing is answering at the node's address, as opposed to the node answering with an error.
+func Unreachable(err error) (unreachable bool) {
+	if err == nil {
+		return unreachable
+	}
+
+	if status.Code(errors.Cause(err)) == codes.Unavailable {
+		unreachable = true
+		return unreachable
+	}
+
+	unreachable = strings.Contains(err.Error(), "connection refused")
+
+	return unreachable
+}
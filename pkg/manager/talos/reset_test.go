@@ -0,0 +1,45 @@
+package talos
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestResetRequest(t *testing.T) {
+	req := ResetRequest()
+
+	assert.True(t, req.GetGraceful(), "reset should be graceful")
+	assert.False(t, req.GetReboot(), "reset should halt, not reboot")
+
+	labels := make([]string, 0)
+	for _, p := range req.GetSystemPartitionsToWipe() {
+		assert.True(t, p.GetWipe(), "partition %s should be wiped", p.GetLabel())
+		labels = append(labels, p.GetLabel())
+	}
+
+	assert.Equal(t, []string{"STATE", "EPHEMERAL"}, labels, "wiped partitions do not meet expectations")
+}
+
+func TestUnreachable(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"no error", nil, false},
+		{"unavailable", status.Error(codes.Unavailable, "connection error"), true},
+		{"wrapped unavailable", errors.Wrapf(status.Error(codes.Unavailable, "connection error"), "failed getting version"), true},
+		{"connection refused", errors.New("dial tcp 10.0.0.1:50000: connect: connection refused"), true},
+		{"permission denied", status.Error(codes.PermissionDenied, "not authorized"), false},
+		{"internal", status.Error(codes.Internal, "resetting"), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Unreachable(tc.err), "unreachable does not meet expectations")
+		})
+	}
+}
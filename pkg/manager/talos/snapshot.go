@@ -0,0 +1,116 @@
+package talos
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+	bolt "go.etcd.io/bbolt"
+	"io"
+	"os"
+	"time"
+)
+
+// EtcdKeyBucket is the bbolt bucket etcd keeps its revisions in.
+const EtcdKeyBucket = "key"
+
+// EtcdSnapshot streams an etcd snapshot from the node at nodeIP into w.
+func EtcdSnapshot(ctx context.Context, talosconfig []byte, nodeIP string, w io.Writer, verbose bool) (size int64, err error) {
+	manager.VerboseOutput(verbose, "Taking etcd snapshot from %s", nodeIP)
+
+	tClient, clientErr := NewClient(ctx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return size, err
+	}
+
+	defer tClient.Close()
+
+	r, snapErr := tClient.EtcdSnapshot(ctx, &machineapi.EtcdSnapshotRequest{})
+	if snapErr != nil {
+		err = errors.Wrapf(snapErr, "failed taking etcd snapshot from %s", nodeIP)
+		return size, err
+	}
+
+	defer r.Close()
+
+	size, err = io.Copy(w, r)
+	if err != nil {
+		err = errors.Wrapf(err, "failed streaming etcd snapshot from %s", nodeIP)
+		return size, err
+	}
+
+	return size, err
+}
+
+// SnapshotRevision reads the etcd revision from the snapshot file at path.  The revision is the main revision of the last key in etcd's key bucket, as etcdutl reports it.
+func SnapshotRevision(path string) (revision int64, err error) {
+	db, openErr := bolt.Open(path, 0400, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if openErr != nil {
+		err = errors.Wrapf(openErr, "failed opening snapshot %s", path)
+		return revision, err
+	}
+
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) (viewErr error) {
+		bucket := tx.Bucket([]byte(EtcdKeyBucket))
+		if bucket == nil {
+			viewErr = errors.Errorf("snapshot %s has no %s bucket", path, EtcdKeyBucket)
+			return viewErr
+		}
+
+		last, _ := bucket.Cursor().Last()
+		if len(last) < 8 {
+			return viewErr
+		}
+
+		revision = int64(binary.BigEndian.Uint64(last[:8]))
+
+		return viewErr
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "failed reading revision from snapshot %s", path)
+		return revision, err
+	}
+
+	return revision, err
+}
+
+// RecoverEtcd uploads the snapshot at path to the control plane node at nodeIP, and bootstraps etcd from it.  The node has to be a fresh control plane node, configured but not yet bootstrapped.
+func RecoverEtcd(ctx context.Context, talosconfig []byte, nodeIP string, path string, verbose bool) (err error) {
+	f, openErr := os.Open(path)
+	if openErr != nil {
+		err = errors.Wrapf(openErr, "failed opening snapshot %s", path)
+		return err
+	}
+
+	defer f.Close()
+
+	tClient, clientErr := NewClient(ctx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return err
+	}
+
+	defer tClient.Close()
+
+	manager.VerboseOutput(verbose, "Uploading snapshot %s to %s", path, nodeIP)
+
+	_, err = tClient.EtcdRecover(ctx, f)
+	if err != nil {
+		err = errors.Wrapf(err, "failed uploading snapshot to %s", nodeIP)
+		return err
+	}
+
+	manager.VerboseOutput(verbose, "Bootstrapping etcd on %s from the snapshot", nodeIP)
+
+	err = tClient.Bootstrap(ctx, &machineapi.BootstrapRequest{RecoverEtcd: true})
+	if err != nil {
+		err = errors.Wrapf(err, "failed bootstrapping etcd on %s from the snapshot", nodeIP)
+		return err
+	}
+
+	return err
+}
@@ -0,0 +1,56 @@
+package talos
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+	"path/filepath"
+	"testing"
+)
+
+// revisionKey builds a key the way etcd does: the main revision, an underscore, then the sub revision.
+func revisionKey(main int64, sub int64) (key []byte) {
+	key = make([]byte, 17)
+	binary.BigEndian.PutUint64(key[0:8], uint64(main))
+	key[8] = '_'
+	binary.BigEndian.PutUint64(key[9:], uint64(sub))
+
+	return key
+}
+
+func TestSnapshotRevision(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("failed creating snapshot: %s", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) (txErr error) {
+		bucket, txErr := tx.CreateBucket([]byte(EtcdKeyBucket))
+		if txErr != nil {
+			return txErr
+		}
+
+		for _, rev := range []int64{2, 15, 1234} {
+			txErr = bucket.Put(revisionKey(rev, 0), []byte("value"))
+			if txErr != nil {
+				return txErr
+			}
+		}
+
+		return txErr
+	})
+	if err != nil {
+		t.Fatalf("failed writing snapshot: %s", err)
+	}
+
+	_ = db.Close()
+
+	revision, err := SnapshotRevision(path)
+	if err != nil {
+		t.Fatalf("failed reading revision: %s", err)
+	}
+
+	assert.Equal(t, int64(1234), revision, "revision does not meet expectations")
+}
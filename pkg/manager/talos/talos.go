@@ -6,72 +6,150 @@ import (
 	"fmt"
 	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
 	"github.com/pkg/errors"
-	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
 	"github.com/siderolabs/talos/pkg/machinery/client"
+	clientconfig "github.com/siderolabs/talos/pkg/machinery/client/config"
 	"github.com/siderolabs/talos/pkg/machinery/config/configpatcher"
+	"time"
 )
 
-func ApplyConfig(ctx context.Context, node manager.ClusterNode, machineConfigBytes []byte, machineConfigPatches []string, insecure bool, verbose bool) (err error) {
-	manager.VerboseOutput(verbose, "Applying config to %s (%s)\n", node.Name(), node.IP())
+// ApplyConfig patches the machine config for the node and applies it in the given mode.  tryTimeout is how long Talos waits for a try to be confirmed before rolling it back, and only matters in try mode.
+//
+// Fresh instances in maintenance mode have no certificate we could trust, so they get the config with insecure set.  Nodes already in the cluster must be reached with insecure unset, which verifies them with the cluster's talosconfig.
+func ApplyConfig(ctx context.Context, node manager.ClusterNode, machineConfigBytes []byte, machineConfigPatches []string, talosconfig []byte, insecure bool, mode ApplyMode, tryTimeout time.Duration, verbose bool) (result ApplyResult, err error) {
+	manager.VerboseOutput(verbose, "Applying config to %s (%s) in %s mode\n", node.Name(), node.IP(), mode)
 
-	tlsConfig := &tls.Config{}
+	cfgBytes, cfgErr := PatchedConfig(node, machineConfigBytes, machineConfigPatches)
+	if cfgErr != nil {
+		err = cfgErr
+		return result, err
+	}
+
+	// Create Talos Client
+	var tClient *client.Client
+	var clientErr error
 
-	// The cert on a newly created node won't be trusted, so the initial config apply will need this.
 	if insecure {
-		tlsConfig.InsecureSkipVerify = true
+		tClient, clientErr = NewInsecureClient(ctx, node.IP())
+	} else {
+		tClient, clientErr = NewClient(ctx, talosconfig, node.IP())
+	}
+
+	if clientErr != nil {
+		err = errors.Wrapf(clientErr, "failed creating new talos client")
+		return result, err
 	}
 
+	defer tClient.Close()
+
+	// Actually apply the config.
+	result, err = sendConfig(ctx, tClient, node.Name(), node.IP(), cfgBytes, mode, tryTimeout)
+	if err != nil {
+		return result, err
+	}
+
+	for _, warning := range result.Warnings {
+		fmt.Printf("Warning: %s: %s\n", node.Name(), warning)
+	}
+
+	manager.VerboseOutput(verbose, "%s: %s\n", node.Name(), result.Details)
+
+	return result, err
+}
+
+// PatchedConfig applies the patches, and the node's hostname, to the machine config.
+func PatchedConfig(node manager.ClusterNode, machineConfigBytes []byte, machineConfigPatches []string) (cfgBytes []byte, err error) {
 	// Crude yaml patch to put the node name into the machine config.  Note the spaces (not tabs) cos it's yaml.
 	nodeNamePatch := fmt.Sprintf(`machine:
   network:
     hostname: %s.%s
 `, node.Name(), node.Domain())
 
-	machineConfigPatches = append(machineConfigPatches, nodeNamePatch)
+	// Copy, so the caller's patches aren't appended to.
+	allPatches := make([]string, 0, len(machineConfigPatches)+1)
+	allPatches = append(allPatches, machineConfigPatches...)
+	allPatches = append(allPatches, nodeNamePatch)
 
 	// Load config patches
-	patches, patchErr := configpatcher.LoadPatches(machineConfigPatches)
+	patches, patchErr := configpatcher.LoadPatches(allPatches)
 	if patchErr != nil {
 		err = errors.Wrapf(patchErr, "failed loading config patches")
-		return err
+		return cfgBytes, err
 	}
 
 	// patch the machine config with things like the node name and other specifics
 	cfg, cfgErr := configpatcher.Apply(configpatcher.WithBytes(machineConfigBytes), patches)
 	if cfgErr != nil {
 		err = errors.Wrapf(cfgErr, "failed applying config patches to machine config ")
-		return err
+		return cfgBytes, err
 	}
 
 	// Extract the patched config bytes
-	cfgBytes, bytesErr := cfg.Bytes()
-	if bytesErr != nil {
-		err = errors.Wrapf(bytesErr, "failed extracting config bytes")
-		return err
+	cfgBytes, err = cfg.Bytes()
+	if err != nil {
+		err = errors.Wrapf(err, "failed extracting config bytes")
+		return cfgBytes, err
 	}
 
-	// Create Talos Client
-	tClient, clientErr := client.New(ctx, client.WithTLSConfig(tlsConfig), client.WithEndpoints(node.IP()))
-	if clientErr != nil {
-		err = errors.Wrapf(clientErr, "failed creating new talos client")
-		return err
+	return cfgBytes, err
+}
+
+// NewClient creates a Talos client for a node that's already in the cluster.  The node's certificate is verified against the CA in the talosconfig, and the client authenticates with the talosconfig's client certificate.
+func NewClient(ctx context.Context, talosconfig []byte, nodeIP string) (tClient *client.Client, err error) {
+	if len(talosconfig) == 0 {
+		err = errors.New("no talosconfig for the cluster.  Use --talosconfig, or put it in the secret.")
+		return tClient, err
 	}
 
-	defer tClient.Close()
+	cfg, cfgErr := clientconfig.FromBytes(talosconfig)
+	if cfgErr != nil {
+		err = errors.Wrapf(cfgErr, "failed parsing talosconfig")
+		return tClient, err
+	}
 
-	// Create apply config request
-	req := &machineapi.ApplyConfigurationRequest{
-		Data:   cfgBytes,
-		Mode:   machineapi.ApplyConfigurationRequest_AUTO,
-		DryRun: false,
+	tClient, err = client.New(ctx, client.WithConfig(cfg), client.WithEndpoints(nodeIP))
+	if err != nil {
+		err = errors.Wrapf(err, "failed creating talos client for %s", nodeIP)
+		return tClient, err
 	}
 
-	// Actually apply the config.
-	_, err = tClient.ApplyConfiguration(ctx, req)
+	return tClient, err
+}
+
+// ClusterTalosconfig selects the context for the cluster in a talosconfig that may hold many clusters, such as ~/.talos/config.  Talos names contexts after their clusters.  The current context is never assumed to be the right one.
+func ClusterTalosconfig(talosconfig []byte, clusterName string) (clusterTalosconfig []byte, err error) {
+	cfg, cfgErr := clientconfig.FromBytes(talosconfig)
+	if cfgErr != nil {
+		err = errors.Wrapf(cfgErr, "failed parsing talosconfig")
+		return clusterTalosconfig, err
+	}
+
+	_, ok := cfg.Contexts[clusterName]
+	if !ok {
+		err = errors.Errorf("talosconfig has no context for cluster %s", clusterName)
+		return clusterTalosconfig, err
+	}
+
+	cfg.Context = clusterName
+
+	clusterTalosconfig, err = cfg.Bytes()
+	if err != nil {
+		err = errors.Wrapf(err, "failed writing talosconfig")
+		return clusterTalosconfig, err
+	}
+
+	return clusterTalosconfig, err
+}
+
+// NewInsecureClient creates a Talos client that doesn't verify the node.  It's only for fresh instances in maintenance mode.
+func NewInsecureClient(ctx context.Context, nodeIP string) (tClient *client.Client, err error) {
+	// The cert on a newly created node won't be trusted, so the initial config apply will need this.
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	tClient, err = client.New(ctx, client.WithTLSConfig(tlsConfig), client.WithEndpoints(nodeIP))
 	if err != nil {
-		err = errors.Wrapf(err, "failed applying machine configuration to %s at %s", node.Name(), node.IP())
-		return err
+		err = errors.Wrapf(err, "failed creating insecure talos client for %s", nodeIP)
+		return tClient, err
 	}
 
-	return err
+	return tClient, err
 }
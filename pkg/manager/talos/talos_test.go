@@ -0,0 +1,118 @@
+package talos
+
+import (
+	"context"
+	clientconfig "github.com/siderolabs/talos/pkg/machinery/client/config"
+	"github.com/siderolabs/talos/pkg/machinery/config/configloader"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testNode struct{}
+
+func (n testNode) Name() (name string) {
+	name = "prod-worker-1"
+	return name
+}
+
+func (n testNode) Role() (role string) {
+	role = "worker"
+	return role
+}
+
+func (n testNode) IP() (ip string) {
+	ip = "10.0.1.23"
+	return ip
+}
+
+func (n testNode) ID() (id string) {
+	id = "i-0af01c0123456789a"
+	return id
+}
+
+func (n testNode) Domain() (domain string) {
+	domain = "some.domain"
+	return domain
+}
+
+func TestPatchedConfig(t *testing.T) {
+	configs, err := GenerateConfigs("prod", "https://api.prod.some.domain:6443", "", "", false)
+	if err != nil {
+		t.Fatalf("failed generating configs: %s", err)
+	}
+
+	patches := []string{StarterPatch}
+
+	patched, err := PatchedConfig(testNode{}, configs.Worker, patches)
+	if err != nil {
+		t.Fatalf("failed patching config: %s", err)
+	}
+
+	assert.Len(t, patches, 1, "caller's patches were modified")
+
+	cfg, err := configloader.NewFromBytes(patched)
+	if err != nil {
+		t.Fatalf("patched config doesn't load: %s", err)
+	}
+
+	assert.Equal(t, "prod-worker-1.some.domain", cfg.Machine().Network().Hostname(), "hostname does not meet expectations")
+	assert.Equal(t, "/dev/xvda", cfg.Machine().Install().Disk(), "patch was not applied")
+}
+
+func TestNewClientRequiresTalosconfig(t *testing.T) {
+	_, err := NewClient(context.Background(), nil, "10.0.1.23")
+	assert.Error(t, err, "a client without a talosconfig would not verify the node")
+}
+
+func TestPatchedConfigLayered(t *testing.T) {
+	configs, err := GenerateConfigs("prod", "https://api.prod.some.domain:6443", "", "", false)
+	if err != nil {
+		t.Fatalf("failed generating configs: %s", err)
+	}
+
+	// A strategic merge patch, then a JSON6902 patch overriding it.
+	jsonPatch := `- op: replace
+  path: /machine/install/disk
+  value: /dev/nvme0n1
+- op: add
+  path: /machine/nodeLabels
+  value:
+    rack: r1
+`
+
+	patched, err := PatchedConfig(testNode{}, configs.Worker, []string{StarterPatch, jsonPatch})
+	if err != nil {
+		t.Fatalf("failed patching config: %s", err)
+	}
+
+	cfg, err := configloader.NewFromBytes(patched)
+	if err != nil {
+		t.Fatalf("patched config doesn't load: %s", err)
+	}
+
+	assert.Equal(t, "/dev/nvme0n1", cfg.Machine().Install().Disk(), "later patch did not win")
+	assert.Equal(t, "r1", cfg.Machine().NodeLabels()["rack"], "JSON6902 patch was not applied")
+	assert.Equal(t, "prod-worker-1.some.domain", cfg.Machine().Network().Hostname(), "hostname does not meet expectations")
+}
+
+func TestClusterTalosconfig(t *testing.T) {
+	configs, err := GenerateConfigs("prod", "https://api.prod.some.domain:6443", "", "", false)
+	if err != nil {
+		t.Fatalf("failed generating configs: %s", err)
+	}
+
+	selected, err := ClusterTalosconfig(configs.Talosconfig, "prod")
+	if err != nil {
+		t.Fatalf("failed selecting context: %s", err)
+	}
+
+	cfg, err := clientconfig.FromBytes(selected)
+	if err != nil {
+		t.Fatalf("selected talosconfig doesn't load: %s", err)
+	}
+
+	assert.Equal(t, "prod", cfg.Context, "context does not meet expectations")
+
+	_, err = ClusterTalosconfig(configs.Talosconfig, "staging")
+	assert.Error(t, err, "a talosconfig without the cluster's context should be an error")
+}
@@ -0,0 +1,161 @@
+package talos
+
+import (
+	"context"
+	"github.com/nikogura/k8s-cluster-manager/pkg/manager"
+	"github.com/pkg/errors"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"strings"
+	"time"
+)
+
+// UpgradePollInterval is how often a node is checked while waiting for it to come back from an upgrade.
+const UpgradePollInterval = 10 * time.Second
+
+// ImageVersion returns the Talos version an installer image carries in its tag, e.g. v1.9.5 for ghcr.io/siderolabs/installer:v1.9.5.
+func ImageVersion(image string) (version string) {
+	// Drop any digest.
+	image, _, _ = strings.Cut(image, "@")
+
+	// The tag follows the last colon, as long as that colon isn't part of a registry host:port.
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i+1:], "/") {
+		return version
+	}
+
+	version = image[i+1:]
+
+	return version
+}
+
+// NodeVersion asks the node which Talos version it runs.
+func NodeVersion(ctx context.Context, talosconfig []byte, nodeIP string) (version string, err error) {
+	tClient, clientErr := NewClient(ctx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return version, err
+	}
+
+	defer tClient.Close()
+
+	resp, versionErr := tClient.Version(ctx)
+	if versionErr != nil {
+		err = errors.Wrapf(versionErr, "failed getting talos version from %s", nodeIP)
+		return version, err
+	}
+
+	for _, msg := range resp.GetMessages() {
+		version = msg.GetVersion().GetTag()
+	}
+
+	return version, err
+}
+
+// NodeBootTime asks the node when it booted, in seconds since the epoch.  It changes when the node reboots.
+func NodeBootTime(ctx context.Context, talosconfig []byte, nodeIP string) (bootTime uint64, err error) {
+	tClient, clientErr := NewClient(ctx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return bootTime, err
+	}
+
+	defer tClient.Close()
+
+	resp, statErr := tClient.MachineClient.SystemStat(ctx, &emptypb.Empty{})
+	if statErr != nil {
+		err = errors.Wrapf(statErr, "failed getting boot time from %s", nodeIP)
+		return bootTime, err
+	}
+
+	for _, msg := range resp.GetMessages() {
+		bootTime = msg.GetBootTime()
+	}
+
+	return bootTime, err
+}
+
+// WaitForReboot waits for the node at nodeIP to come back up after a reboot: to answer with a boot time other than bootTime.  Answers with the old boot time mean the node hasn't gone down yet.
+func WaitForReboot(ctx context.Context, talosconfig []byte, nodeIP string, bootTime uint64, timeout time.Duration, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Waiting for %s to reboot (timeout: %v)", nodeIP, timeout)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(UpgradePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeoutCtx.Done():
+			err = errors.Errorf("timeout waiting for %s to reboot after %v", nodeIP, timeout)
+			return err
+		case <-ticker.C:
+			current, bootErr := NodeBootTime(timeoutCtx, talosconfig, nodeIP)
+			if bootErr != nil {
+				manager.VerboseOutput(verbose, "%s not answering, continuing to wait...", nodeIP)
+				continue
+			}
+
+			if current != bootTime {
+				manager.VerboseOutput(verbose, "%s has rebooted", nodeIP)
+				return err
+			}
+
+			manager.VerboseOutput(verbose, "%s hasn't rebooted yet, continuing to wait...", nodeIP)
+		}
+	}
+}
+
+// UpgradeNode tells the node at nodeIP to upgrade to the given installer image.  The node reboots when it's done, so callers will want to wait for it with WaitForReboot, then WaitForVersion.
+func UpgradeNode(ctx context.Context, talosconfig []byte, nodeIP string, image string, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Upgrading %s to %s", nodeIP, image)
+
+	tClient, clientErr := NewClient(ctx, talosconfig, nodeIP)
+	if clientErr != nil {
+		err = clientErr
+		return err
+	}
+
+	defer tClient.Close()
+
+	_, err = tClient.UpgradeWithOptions(ctx, client.WithUpgradeImage(image), client.WithUpgradePreserve(true))
+	if err != nil {
+		err = errors.Wrapf(err, "failed upgrading %s to %s", nodeIP, image)
+		return err
+	}
+
+	return err
+}
+
+// WaitForVersion waits for the node at nodeIP to come back up running the given Talos version.
+func WaitForVersion(ctx context.Context, talosconfig []byte, nodeIP string, version string, timeout time.Duration, verbose bool) (err error) {
+	manager.VerboseOutput(verbose, "Waiting for %s to come up with Talos %s (timeout: %v)", nodeIP, version, timeout)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(UpgradePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeoutCtx.Done():
+			err = errors.Errorf("timeout waiting for %s to run Talos %s after %v", nodeIP, version, timeout)
+			return err
+		case <-ticker.C:
+			current, versionErr := NodeVersion(timeoutCtx, talosconfig, nodeIP)
+			if versionErr != nil {
+				manager.VerboseOutput(verbose, "%s not answering yet, continuing to wait...", nodeIP)
+				continue
+			}
+
+			if current == version {
+				manager.VerboseOutput(verbose, "%s is running Talos %s", nodeIP, version)
+				return err
+			}
+
+			manager.VerboseOutput(verbose, "%s is running Talos %s, continuing to wait...", nodeIP, current)
+		}
+	}
+}
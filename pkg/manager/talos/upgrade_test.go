@@ -0,0 +1,46 @@
+package talos
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestImageVersion(t *testing.T) {
+	cases := []struct {
+		name   string
+		image  string
+		output string
+	}{
+		{
+			name:   "tagged",
+			image:  "ghcr.io/siderolabs/installer:v1.9.5",
+			output: "v1.9.5",
+		},
+		{
+			name:   "tag and digest",
+			image:  "ghcr.io/siderolabs/installer:v1.9.5@sha256:0123456789abcdef",
+			output: "v1.9.5",
+		},
+		{
+			name:   "registry port",
+			image:  "registry.some.domain:5000/siderolabs/installer:v1.10.0",
+			output: "v1.10.0",
+		},
+		{
+			name:   "registry port no tag",
+			image:  "registry.some.domain:5000/siderolabs/installer",
+			output: "",
+		},
+		{
+			name:   "no tag",
+			image:  "ghcr.io/siderolabs/installer",
+			output: "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.output, ImageVersion(tc.image), "image version does not meet expectations")
+		})
+	}
+}
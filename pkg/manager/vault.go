@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -8,14 +9,41 @@ import (
 	"github.com/pkg/errors"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const CloudflareZoneIDEnvVar = "CLOUDFLARE_ZONE_ID"
 const CloudflareAPITokenEnvVar = "CLOUDFLARE_API_TOKEN"
 
+const VaultAuthToken = "token"
+const VaultAuthAppRole = "approle"
+const VaultAuthKubernetes = "kubernetes"
+const VaultAuthJWT = "jwt"
+
+// KubernetesServiceAccountTokenFile is where a pod finds its service account token.
+const KubernetesServiceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultAuthConfig describes how to log in to Vault.
+type VaultAuthConfig struct {
+	Method    string // token, approle, kubernetes, or jwt.  Empty means token.
+	Token     string // token
+	RoleID    string // approle
+	SecretID  string // approle
+	Role      string // kubernetes, jwt
+	JWT       string // jwt.  For kubernetes, defaults to the contents of the service account token file.
+	MountPath string // Mount point of the auth method.  Defaults to the method name.
+}
+
+// VaultClientConfig holds the connection settings for Vault.
+type VaultClientConfig struct {
+	CACert    string // Path to a PEM file with private CA certificates to trust in addition to the system pool.
+	Namespace string // Vault Enterprise namespace.
+}
+
 // VaultAPIConfig creates a vault api config in a standard fashion.
-func VaultAPIConfig(address string) (config *api.Config, err error) {
+func VaultAPIConfig(address string, cacert string) (config *api.Config, err error) {
 	// read the environment and use that over anything
 	config = api.DefaultConfig()
 
@@ -38,13 +66,19 @@ func VaultAPIConfig(address string) (config *api.Config, err error) {
 	}
 
 	// for using private CA's
-	//if cacert != "" {
-	//	ok := rootCAs.AppendCertsFromPEM([]byte(cacert))
-	//	if !ok {
-	//		err = errors.New("Failed to add root cert to system CA bundle")
-	//		return config, err
-	//	}
-	//}
+	if cacert != "" {
+		caBytes, readErr := os.ReadFile(cacert)
+		if readErr != nil {
+			err = errors.Wrapf(readErr, "failed reading CA cert %s", cacert)
+			return config, err
+		}
+
+		ok := rootCAs.AppendCertsFromPEM(caBytes)
+		if !ok {
+			err = errors.New("Failed to add root cert to system CA bundle")
+			return config, err
+		}
+	}
 
 	clientConfig := &tls.Config{
 		RootCAs: rootCAs,
@@ -55,8 +89,9 @@ func VaultAPIConfig(address string) (config *api.Config, err error) {
 	return config, err
 }
 
-func NewVaultClient(token string, verbose bool) (client *api.Client, err error) {
-	apiConfig, apiConfigErr := VaultAPIConfig(os.Getenv("VAULT_ADDR"))
+// NewVaultClient creates a vault client and logs it in with the given auth method.
+func NewVaultClient(clientConfig VaultClientConfig, auth VaultAuthConfig, verbose bool) (client *api.Client, err error) {
+	apiConfig, apiConfigErr := VaultAPIConfig(os.Getenv("VAULT_ADDR"), clientConfig.CACert)
 	if apiConfigErr != nil {
 		err = apiConfigErr
 		return client, err
@@ -72,114 +107,435 @@ func NewVaultClient(token string, verbose bool) (client *api.Client, err error)
 		return client, err
 	}
 
-	client.SetToken(token)
+	if clientConfig.Namespace != "" {
+		VerboseOutput(verbose, "Vault Namespace: %s", clientConfig.Namespace)
+		client.SetNamespace(clientConfig.Namespace)
+	}
+
+	err = VaultLogin(client, auth, verbose)
+	if err != nil {
+		err = errors.Wrapf(err, "failed logging in to vault")
+		return client, err
+	}
 
 	return client, err
 }
 
+// VaultLogin sets the client's token, logging in with the configured auth method if it's not a plain token.
+func VaultLogin(client *api.Client, auth VaultAuthConfig, verbose bool) (err error) {
+	method := auth.Method
+	if method == "" {
+		method = VaultAuthToken
+	}
+
+	if method == VaultAuthToken {
+		client.SetToken(auth.Token)
+		return err
+	}
+
+	mount := strings.Trim(auth.MountPath, "/")
+	if mount == "" {
+		mount = method
+	}
+
+	var loginData map[string]interface{}
+
+	switch method {
+	case VaultAuthAppRole:
+		loginData = map[string]interface{}{
+			"role_id":   auth.RoleID,
+			"secret_id": auth.SecretID,
+		}
+	case VaultAuthKubernetes:
+		jwt := auth.JWT
+		if jwt == "" {
+			jwtBytes, readErr := os.ReadFile(KubernetesServiceAccountTokenFile)
+			if readErr != nil {
+				err = errors.Wrapf(readErr, "failed reading service account token from %s", KubernetesServiceAccountTokenFile)
+				return err
+			}
+
+			jwt = strings.TrimSpace(string(jwtBytes))
+		}
+
+		loginData = map[string]interface{}{
+			"role": auth.Role,
+			"jwt":  jwt,
+		}
+	case VaultAuthJWT:
+		loginData = map[string]interface{}{
+			"role": auth.Role,
+			"jwt":  auth.JWT,
+		}
+	default:
+		err = errors.Errorf("unsupported vault auth method %q", method)
+		return err
+	}
+
+	VerboseOutput(verbose, "Logging in to vault at auth/%s with method %s", mount, method)
+
+	// Login requests must not carry a stale token.
+	client.ClearToken()
+
+	secret, loginErr := client.Logical().Write(fmt.Sprintf("auth/%s/login", mount), loginData)
+	if loginErr != nil {
+		err = errors.Wrapf(loginErr, "failed %s login to vault", method)
+		return err
+	}
+
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		err = errors.Errorf("no token returned from %s login to vault", method)
+		return err
+	}
+
+	client.SetToken(secret.Auth.ClientToken)
+
+	return err
+}
+
+// VaultReloginMinInterval is the least time between logins to Vault by KeepVaultTokenAlive.
+const VaultReloginMinInterval = 30 * time.Second
+
+// KeepVaultTokenAlive renews the client's token in the background until ctx is done.  If the token can't be renewed any more, and the auth method allows it, it logs in again.  Logins are spaced out by VaultReloginDelay, so a token that can't be watched, or a failing login, doesn't hammer Vault.
+func KeepVaultTokenAlive(ctx context.Context, client *api.Client, auth VaultAuthConfig, verbose bool) {
+	for {
+		passStart := time.Now()
+
+		ttl, watchErr := watchVaultToken(ctx, client, verbose)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// A plain token can't be replaced once it's gone.
+		if auth.Method == "" || auth.Method == VaultAuthToken {
+			VerboseOutput(verbose, "Vault token can no longer be renewed: %v", watchErr)
+			return
+		}
+
+		delay := VaultReloginDelay(ttl, time.Since(passStart))
+
+		VerboseOutput(verbose, "Vault token can no longer be renewed (%v).  Logging in again in %v.", watchErr, delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		loginErr := VaultLogin(client, auth, verbose)
+		if loginErr != nil {
+			fmt.Printf("Warning: failed logging in to vault again: %s\n", loginErr)
+		}
+	}
+}
+
+// VaultReloginDelay is how long to wait before logging in again, after watching a token with the given TTL for elapsed.  Logins are at least a third of the TTL, and at least VaultReloginMinInterval, apart.
+func VaultReloginDelay(ttl time.Duration, elapsed time.Duration) (delay time.Duration) {
+	delay = ttl / 3
+	if delay < VaultReloginMinInterval {
+		delay = VaultReloginMinInterval
+	}
+
+	delay -= elapsed
+	if delay < 0 {
+		delay = 0
+	}
+
+	return delay
+}
+
+// watchVaultToken renews the client's current token until it can't be renewed any more, or ctx is done.  ttl is the token's TTL when the watch started, or zero if it couldn't be looked up.
+func watchVaultToken(ctx context.Context, client *api.Client, verbose bool) (ttl time.Duration, err error) {
+	self, lookupErr := client.Auth().Token().LookupSelf()
+	if lookupErr != nil {
+		err = errors.Wrapf(lookupErr, "failed looking up vault token")
+		return ttl, err
+	}
+
+	renewable, _ := self.TokenIsRenewable()
+	ttl, _ = self.TokenTTL()
+
+	if !renewable {
+		// Tokens without a TTL never expire.  Otherwise wait out most of the TTL, so there's time to log in again.
+		wait := ttl * 2 / 3
+		if ttl == 0 {
+			<-ctx.Done()
+			return ttl, err
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+			err = errors.New("vault token is not renewable")
+		}
+
+		return ttl, err
+	}
+
+	watcher, watcherErr := client.NewLifetimeWatcher(&api.LifetimeWatcherInput{
+		Secret: &api.Secret{
+			Auth: &api.SecretAuth{
+				ClientToken:   client.Token(),
+				Renewable:     true,
+				LeaseDuration: int(ttl.Seconds()),
+			},
+		},
+	})
+	if watcherErr != nil {
+		err = errors.Wrapf(watcherErr, "failed creating vault token watcher")
+		return ttl, err
+	}
+
+	go watcher.Start()
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ttl, err
+		case err = <-watcher.DoneCh():
+			return ttl, err
+		case renewal := <-watcher.RenewCh():
+			VerboseOutput(verbose, "Renewed vault token at %s", renewal.RenewedAt.Format(time.RFC3339))
+		}
+	}
+}
+
+// SecretData reads the latest version of the secret at path.
 func SecretData(client *api.Client, path string, verbose bool) (data map[string]interface{}, err error) {
+	data, err = SecretDataVersion(client, path, 0, verbose)
+	return data, err
+}
+
+// SecretDataVersion reads the secret at path, which may be nested any number of levels below its mount.  The mount's KV version is detected, and for KV v2 a version greater than 0 selects that version of the secret.
+func SecretDataVersion(client *api.Client, path string, version int, verbose bool) (data map[string]interface{}, err error) {
 	data = make(map[string]interface{})
 
 	VerboseOutput(verbose, "Reading path: %s", path)
 
-	v2Path, v2PathErr := V2Path(path)
-	if v2PathErr != nil {
-		err = errors.Wrapf(v2PathErr, "failed creating v2 secret path from %q", path)
+	mount, kvVersion, mountErr := KVMount(client, path, verbose)
+	if mountErr != nil {
+		err = errors.Wrapf(mountErr, "failed looking up mount for %q", path)
 		return data, err
 	}
 
-	s, readErr := client.Logical().Read(v2Path)
+	readPath, readPathErr := KVReadPath(mount, path, kvVersion)
+	if readPathErr != nil {
+		err = errors.Wrapf(readPathErr, "failed creating secret path from %q", path)
+		return data, err
+	}
+
+	VerboseOutput(verbose, "Mount %s is KV v%d.  Reading %s", mount, kvVersion, readPath)
+
+	var query map[string][]string
+	if kvVersion == 2 && version > 0 {
+		query = map[string][]string{"version": {strconv.Itoa(version)}}
+	}
+
+	s, readErr := client.Logical().ReadWithData(readPath, query)
 	if readErr != nil {
 		err = errors.Wrapf(readErr, "Failed to lookup path: %s", path)
 		return data, err
 	}
 
-	if s != nil {
-		secretData, ok := s.Data["data"].(map[string]interface{})
-		if ok {
-			for k, v := range secretData {
-				data[k] = v
-			}
-		} else {
+	if s == nil {
+		return data, err
+	}
+
+	secretData := s.Data
+	if kvVersion == 2 {
+		v2Data, ok := s.Data["data"].(map[string]interface{})
+		if !ok {
 			err = errors.New(fmt.Sprintf("unparsable secret found at %s", path))
+			return data, err
 		}
+
+		secretData = v2Data
 	}
 
-	//verboseOutput(verbose, "\n\n")
+	for k, v := range secretData {
+		data[k] = v
+	}
 
 	return data, err
 }
 
-func V2Path(path string) (v2Path string, err error) {
-	parts := strings.Split(path, "/")
-	if len(parts) < 2 {
-		err = errors.New(fmt.Sprintf("Invalid path %q.  Path must consist of a mount and a secret separated by slashes", path))
-		return v2Path, err
+// WriteSecretData writes data to the secret at path, replacing what's there.  Like SecretDataVersion, the mount's KV version is detected.
+func WriteSecretData(client *api.Client, path string, data map[string]interface{}, verbose bool) (err error) {
+	mount, kvVersion, mountErr := KVMount(client, path, verbose)
+	if mountErr != nil {
+		err = errors.Wrapf(mountErr, "failed looking up mount for %q", path)
+		return err
 	}
 
-	mount := parts[0]
-	secretPath := parts[1]
+	writePath, writePathErr := KVReadPath(mount, path, kvVersion)
+	if writePathErr != nil {
+		err = errors.Wrapf(writePathErr, "failed creating secret path from %q", path)
+		return err
+	}
 
-	v2Path = fmt.Sprintf("%s/data/%s", mount, secretPath)
+	VerboseOutput(verbose, "Mount %s is KV v%d.  Writing %s", mount, kvVersion, writePath)
 
-	return v2Path, err
-}
+	body := data
+	if kvVersion == 2 {
+		body = map[string]interface{}{"data": data}
+	}
+
+	_, err = client.Logical().Write(writePath, body)
+	if err != nil {
+		err = errors.Wrapf(err, "Failed to write path: %s", path)
+		return err
+	}
 
-type ConfigData struct {
-	TalosMachineConfig      []byte
-	TalosMachineConfigPatch []byte
-	NodeConfig              []byte
-	CloudflareAPIToken      string
-	CloudflareZoneID        string
+	return err
 }
 
-func ConfigsFromSecret(client *api.Client, mount string, clusterName string, nodeRole string, cloudProvider string, verbose bool) (data ConfigData, err error) {
-	secretPath := fmt.Sprintf("%s/cluster-%s-%s", mount, clusterName, nodeRole)
-	if verbose {
-		fmt.Printf("Loading machine config from %s\n", secretPath)
+// KVMount finds the mount holding path, and the KV version of that mount.  It asks Vault the same way the vault CLI does, falling back to listing sys/mounts.  If neither is permitted, the first path segment is taken to be a KV v2 mount.
+func KVMount(client *api.Client, path string, verbose bool) (mount string, kvVersion int, err error) {
+	path = strings.Trim(path, "/")
+
+	s, readErr := client.Logical().Read(fmt.Sprintf("sys/internal/ui/mounts/%s", path))
+	if readErr == nil && s != nil {
+		mountPath, _ := s.Data["path"].(string)
+		options, _ := s.Data["options"].(map[string]interface{})
+		versionString, _ := options["version"].(string)
+
+		if mountPath != "" {
+			mount = strings.Trim(mountPath, "/")
+			kvVersion = KVVersion(versionString)
+			return mount, kvVersion, err
+		}
 	}
 
-	secretData, secretErr := SecretData(client, secretPath, verbose)
-	if secretErr != nil {
-		err = errors.Wrapf(secretErr, "failed getting secret from path %s", secretPath)
-		return data, err
+	mounts, listErr := client.Sys().ListMounts()
+	if listErr == nil {
+		mountVersions := make(map[string]string)
+		for mountPath, mountOutput := range mounts {
+			mountVersions[mountPath] = mountOutput.Options["version"]
+		}
+
+		var versionString string
+		mount, versionString = LongestMount(path, mountVersions)
+		if mount != "" {
+			kvVersion = KVVersion(versionString)
+			return mount, kvVersion, err
+		}
 	}
 
-	nodeKey := fmt.Sprintf("node-%s.yaml", cloudProvider)
+	VerboseOutput(verbose, "Unable to look up mount for %s.  Assuming KV v2.", path)
 
-	c, ok := secretData["config.yaml"].(string)
-	if !ok {
-		err = errors.New("Could not extract bytes for config.yaml from secret")
-		return data, err
+	mount = strings.Split(path, "/")[0]
+	kvVersion = 2
+
+	return mount, kvVersion, err
+}
+
+// LongestMount returns the longest of the given mounts that path falls under, and the version string of that mount.
+func LongestMount(path string, mountVersions map[string]string) (mount string, versionString string) {
+	path = strings.Trim(path, "/") + "/"
+
+	for mountPath, mountVersion := range mountVersions {
+		candidate := strings.Trim(mountPath, "/")
+		if candidate == "" || !strings.HasPrefix(path, candidate+"/") {
+			continue
+		}
+
+		if len(candidate) > len(mount) {
+			mount = candidate
+			versionString = mountVersion
+		}
 	}
 
-	data.TalosMachineConfig = []byte(c)
+	return mount, versionString
+}
 
-	p, ok := secretData["patch.yaml"].(string)
-	if !ok {
-		err = errors.New("Could not extract bytes for patch.yaml from secret")
-		return data, err
+// KVVersion converts a mount's version option to a KV version.  Mounts without a version option are KV v1.
+func KVVersion(versionString string) (kvVersion int) {
+	kvVersion = 1
+
+	if versionString == "2" {
+		kvVersion = 2
 	}
 
-	data.TalosMachineConfigPatch = []byte(p)
+	return kvVersion
+}
 
-	n, ok := secretData[nodeKey].(string)
-	if !ok {
-		err = errors.New(fmt.Sprintf("Could not extract bytes for %s from secret", nodeKey))
-		return data, err
+// KVReadPath builds the API path for reading or writing the secret at path, which lives under mount.
+func KVReadPath(mount string, path string, kvVersion int) (readPath string, err error) {
+	mount = strings.Trim(mount, "/")
+	path = strings.Trim(path, "/")
+
+	secretPath := strings.TrimPrefix(path, mount+"/")
+	if mount == "" || secretPath == path || secretPath == "" {
+		err = errors.New(fmt.Sprintf("Invalid path %q.  Path must consist of the mount %q and a secret separated by slashes", path, mount))
+		return readPath, err
 	}
 
-	data.NodeConfig = []byte(n)
+	if kvVersion == 2 {
+		readPath = fmt.Sprintf("%s/data/%s", mount, secretPath)
+		return readPath, err
+	}
 
-	zoneIDFromSecret, ok := secretData[CloudflareZoneIDEnvVar].(string)
-	if ok {
-		data.CloudflareZoneID = zoneIDFromSecret
+	readPath = fmt.Sprintf("%s/%s", mount, secretPath)
+
+	return readPath, err
+}
+
+// V2Path converts a path to a KV v2 read path, taking the first segment to be the mount.
+func V2Path(path string) (v2Path string, err error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 {
+		err = errors.New(fmt.Sprintf("Invalid path %q.  Path must consist of a mount and a secret separated by slashes", path))
+		return v2Path, err
 	}
 
-	cfTokenFromSecret, ok := secretData[CloudflareAPITokenEnvVar].(string)
-	if ok {
-		data.CloudflareAPIToken = cfTokenFromSecret
+	v2Path, err = KVReadPath(parts[0], path, 2)
+
+	return v2Path, err
+}
+
+// VaultBackend is a SecretBackend holding secrets in a Vault KV mount.
+type VaultBackend struct {
+	Client  *api.Client
+	Mount   string // KV path the secrets live under, e.g. secret/teams/infra.
+	Version int    // Version of KV v2 secrets to read.  0 reads the latest.
+}
+
+// NewVaultBackend creates a secret backend reading from mount.
+func NewVaultBackend(client *api.Client, mount string, version int) (backend VaultBackend) {
+	backend = VaultBackend{
+		Client:  client,
+		Mount:   strings.TrimRight(mount, "/"),
+		Version: version,
+	}
+
+	return backend
+}
+
+// ReadSecret reads the secret called name from under the backend's mount.
+func (b VaultBackend) ReadSecret(name string, verbose bool) (data map[string]interface{}, err error) {
+	secretPath := fmt.Sprintf("%s/%s", b.Mount, name)
+
+	data, err = SecretDataVersion(b.Client, secretPath, b.Version, verbose)
+	if err != nil {
+		err = errors.Wrapf(err, "failed getting secret from path %s", secretPath)
+		return data, err
 	}
 
 	return data, err
 }
+
+// WriteSecret writes the secret called name under the backend's mount.
+func (b VaultBackend) WriteSecret(name string, data map[string]interface{}, verbose bool) (err error) {
+	secretPath := fmt.Sprintf("%s/%s", b.Mount, name)
+
+	err = WriteSecretData(b.Client, secretPath, data, verbose)
+
+	return err
+}
+
+// ConfigsFromSecret loads the cluster configs for a node role from Vault.
+func ConfigsFromSecret(client *api.Client, mount string, clusterName string, nodeRole string, cloudProvider string, secretVersion int, verbose bool) (data ConfigData, err error) {
+	data, err = ConfigsFromBackend(NewVaultBackend(client, mount, secretVersion), clusterName, nodeRole, cloudProvider, verbose)
+	return data, err
+}
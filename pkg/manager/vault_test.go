@@ -0,0 +1,143 @@
+package manager
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestKVReadPath(t *testing.T) {
+	cases := []struct {
+		name      string
+		mount     string
+		path      string
+		kvVersion int
+		expected  string
+		errs      bool
+	}{
+		{
+			"v2 flat",
+			"secret",
+			"secret/cluster-prod-worker",
+			2,
+			"secret/data/cluster-prod-worker",
+			false,
+		},
+		{
+			"v2 nested",
+			"secret",
+			"secret/teams/infra/cluster-prod-worker",
+			2,
+			"secret/data/teams/infra/cluster-prod-worker",
+			false,
+		},
+		{
+			"v2 nested mount",
+			"teams/infra",
+			"teams/infra/cluster-prod-worker",
+			2,
+			"teams/infra/data/cluster-prod-worker",
+			false,
+		},
+		{
+			"v1 nested",
+			"kv",
+			"kv/teams/infra/cluster-prod-worker",
+			1,
+			"kv/teams/infra/cluster-prod-worker",
+			false,
+		},
+		{
+			"mount only",
+			"secret",
+			"secret",
+			2,
+			"",
+			true,
+		},
+		{
+			"wrong mount",
+			"kv",
+			"secret/cluster-prod-worker",
+			2,
+			"",
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := KVReadPath(tc.mount, tc.path, tc.kvVersion)
+			if tc.errs {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, actual, "read path does not meet expectations")
+		})
+	}
+}
+
+func TestV2Path(t *testing.T) {
+	actual, err := V2Path("secret/teams/infra/cluster-prod-worker")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret/data/teams/infra/cluster-prod-worker", actual, "nested path was truncated")
+
+	_, err = V2Path("secret")
+	assert.Error(t, err)
+}
+
+func TestLongestMount(t *testing.T) {
+	mounts := map[string]string{
+		"secret/":      "2",
+		"teams/":       "1",
+		"teams/infra/": "2",
+		"sys/":         "",
+	}
+
+	cases := []struct {
+		path    string
+		mount   string
+		version string
+	}{
+		{"secret/cluster-prod-worker", "secret", "2"},
+		{"teams/infra/cluster-prod-worker", "teams/infra", "2"},
+		{"teams/other/cluster-prod-worker", "teams", "1"},
+		{"teamsx/cluster-prod-worker", "", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.path, func(t *testing.T) {
+			mount, version := LongestMount(tc.path, mounts)
+			assert.Equal(t, tc.mount, mount, "mount does not meet expectations")
+			assert.Equal(t, tc.version, version, "version does not meet expectations")
+		})
+	}
+}
+
+func TestKVVersion(t *testing.T) {
+	assert.Equal(t, 2, KVVersion("2"))
+	assert.Equal(t, 1, KVVersion("1"))
+	assert.Equal(t, 1, KVVersion(""))
+}
+
+func TestVaultReloginDelay(t *testing.T) {
+	cases := []struct {
+		name     string
+		ttl      time.Duration
+		elapsed  time.Duration
+		expected time.Duration
+	}{
+		{"watch failed at once", 0, 0, VaultReloginMinInterval},
+		{"short ttl", 30 * time.Second, time.Second, VaultReloginMinInterval - time.Second},
+		{"watch ended early", time.Hour, time.Minute, 19 * time.Minute},
+		{"token ran its course", time.Hour, 59 * time.Minute, 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, VaultReloginDelay(tc.ttl, tc.elapsed), "delay does not meet expectations")
+		})
+	}
+}